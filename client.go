@@ -2,6 +2,12 @@ package strongforce
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
 	"github.com/vectrum-io/strongforce/pkg/bus"
 	"github.com/vectrum-io/strongforce/pkg/db"
 	"github.com/vectrum-io/strongforce/pkg/events"
@@ -10,11 +16,59 @@ import (
 	"go.uber.org/zap"
 )
 
+var (
+	ErrAlreadyRunning = errors.New("client is already running")
+)
+
+// forwarderHealthyAfter is how long a forwarder must run before a failure
+// counts as the first one again for the restart backoff.
+const forwarderHealthyAfter = time.Minute
+
+// RestartBackoff decides how long Client.Run waits before restarting a failed
+// forwarder. The delay doubles on every consecutive failure, starting at
+// InitialDelay and capped at MaxDelay. Jitter randomly shortens each delay by
+// up to that fraction (0 to 1) so replicas that failed together do not restart
+// in lockstep.
+type RestartBackoff struct {
+	InitialDelay time.Duration
+	// MaxDelay defaults to bus.DefaultMaxRetryDelay when zero.
+	MaxDelay time.Duration
+	Jitter   float64
+}
+
+// DefaultForwarderRestartBackoff backs off forwarder restarts from one second
+// up to one minute.
+var DefaultForwarderRestartBackoff = RestartBackoff{
+	InitialDelay: time.Second,
+	MaxDelay:     time.Minute,
+	Jitter:       0.2,
+}
+
+// delay returns the wait before restarting after the given consecutive
+// failure. Failures start at 1.
+func (b RestartBackoff) delay(failure uint64) time.Duration {
+	return bus.ExponentialRetryPolicy{
+		InitialDelay: b.InitialDelay,
+		MaxDelay:     b.MaxDelay,
+		Jitter:       b.Jitter,
+	}.RetryDelay(failure)
+}
+
 type Client struct {
-	db           db.DB
-	eventBuilder *events.Builder
-	forwarder    forwarder.Forwarder
-	bus          bus.Bus
+	db                      db.DB
+	eventBuilder            *events.Builder
+	forwarder               forwarder.Forwarder
+	forwarderRestartBackoff RestartBackoff
+	bus                     bus.Bus
+	logger                  *zap.Logger
+	healthThresholds        HealthThresholds
+
+	connectOnce sync.Once
+	connectErr  error
+	connected   atomic.Bool
+	running     atomic.Bool
+	stopping    chan struct{}
+	stopOnce    sync.Once
 }
 
 type Options struct {
@@ -32,21 +86,164 @@ func New(opts ...Option) (*Client, error) {
 	return options.CreateClient()
 }
 
+// Init connects the database and starts the forwarder and the idempotency
+// key cleanup in the background until Shutdown is called. Background errors
+// are logged; use Run to handle them instead.
 func (sf *Client) Init() error {
-	if sf.db != nil {
-		if err := sf.db.Connect(); err != nil {
-			return err
+	return sf.InitContext(context.Background())
+}
+
+// InitContext is like Init, but also stops the background work when ctx ends.
+func (sf *Client) InitContext(ctx context.Context) error {
+	if err := sf.connect(); err != nil {
+		return err
+	}
+
+	go func() {
+		if err := sf.run(ctx); err != nil {
+			sf.logger.Error("failed to run forwarder", zap.Error(err))
 		}
+	}()
+
+	return nil
+}
+
+// Run connects the database unless Init already did, then runs the forwarder
+// and the idempotency key cleanup until ctx ends or Shutdown is called. A
+// failing forwarder is restarted with backoff; Run only returns its error if
+// it wraps forwarder.ErrFatal.
+func (sf *Client) Run(ctx context.Context) error {
+	if err := sf.connect(); err != nil {
+		return err
 	}
 
+	return sf.run(ctx)
+}
+
+// Shutdown tears the client down in dependency order: the forwarder stops
+// accepting direct emits, flushes its queue and stops polling, then
+// subscriptions are drained, the bus is closed and finally the database.
+// When ctx ends early the remaining steps still run, without waiting.
+func (sf *Client) Shutdown(ctx context.Context) error {
+	var errs []error
+
 	if sf.forwarder != nil {
+		stopped := make(chan error, 1)
 		go func() {
-			err := sf.forwarder.Start(context.Background())
-			zap.L().Error("failed to run forwarder: " + err.Error())
+			stopped <- sf.forwarder.Stop()
 		}()
+
+		select {
+		case err := <-stopped:
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to stop forwarder: %w", err))
+			}
+		case <-ctx.Done():
+			errs = append(errs, fmt.Errorf("failed to stop forwarder: %w", ctx.Err()))
+		}
 	}
 
-	return nil
+	// Cancels Run only now, so the forwarder can flush with a live ctx.
+	sf.stopOnce.Do(func() {
+		close(sf.stopping)
+	})
+
+	if closer, ok := sf.bus.(busCloser); ok {
+		if err := closer.Close(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close bus: %w", err))
+		}
+	}
+
+	if sf.db != nil && sf.connected.Load() {
+		if err := sf.db.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close database: %w", err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (sf *Client) connect() error {
+	sf.connectOnce.Do(func() {
+		if sf.db == nil {
+			return
+		}
+
+		sf.connectErr = sf.db.Connect()
+		sf.connected.Store(sf.connectErr == nil)
+	})
+
+	return sf.connectErr
+}
+
+func (sf *Client) run(ctx context.Context) error {
+	if !sf.running.CompareAndSwap(false, true) {
+		return ErrAlreadyRunning
+	}
+	defer sf.running.Store(false)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		select {
+		case <-sf.stopping:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	if ip, ok := sf.db.(idempotencyProvider); ok && ip.IdempotencyStore() != nil {
+		go func() {
+			if err := ip.IdempotencyStore().RunCleanup(ctx, sf.db.Connection()); err != nil {
+				sf.logger.Error("failed to run idempotency key cleanup", zap.Error(err))
+			}
+		}()
+	}
+
+	if sf.forwarder == nil {
+		<-ctx.Done()
+		return nil
+	}
+
+	return sf.superviseForwarder(ctx)
+}
+
+// superviseForwarder runs the forwarder until it stops cleanly or ctx ends,
+// restarting it with backoff when it fails.
+func (sf *Client) superviseForwarder(ctx context.Context) error {
+	var attempt uint64
+	for {
+		startedAt := time.Now()
+		err := sf.forwarder.Start(ctx)
+		if ctx.Err() != nil || err == nil {
+			return nil
+		}
+
+		if errors.Is(err, forwarder.ErrFatal) {
+			return err
+		}
+
+		if time.Since(startedAt) >= forwarderHealthyAfter {
+			attempt = 0
+		}
+		attempt++
+
+		delay := sf.forwarderRestartBackoff.delay(attempt)
+		sf.logger.Warn("forwarder failed, restarting",
+			zap.Error(err),
+			zap.Uint64("attempt", attempt),
+			zap.Duration("delay", delay),
+		)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		}
+	}
 }
 
 func (sf *Client) DB() db.DB {
@@ -0,0 +1,108 @@
+package strongforce
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vectrum-io/strongforce/pkg/forwarder"
+	"go.uber.org/zap"
+)
+
+type fakeForwarder struct {
+	starts  atomic.Int32
+	startFn func(ctx context.Context, attempt int32) error
+	stopped chan struct{}
+}
+
+func newFakeForwarder(startFn func(ctx context.Context, attempt int32) error) *fakeForwarder {
+	return &fakeForwarder{startFn: startFn, stopped: make(chan struct{})}
+}
+
+func (f *fakeForwarder) Start(ctx context.Context) error {
+	return f.startFn(ctx, f.starts.Add(1))
+}
+
+func (f *fakeForwarder) Stop() error {
+	close(f.stopped)
+	return nil
+}
+
+func newTestClient(fw forwarder.Forwarder) *Client {
+	return &Client{
+		forwarder:               fw,
+		forwarderRestartBackoff: RestartBackoff{InitialDelay: time.Millisecond, MaxDelay: time.Millisecond},
+		logger:                  zap.NewNop(),
+		stopping:                make(chan struct{}),
+	}
+}
+
+func TestRunRestartsFailedForwarder(t *testing.T) {
+	fw := newFakeForwarder(func(ctx context.Context, attempt int32) error {
+		if attempt < 3 {
+			return errors.New("dummy")
+		}
+		<-ctx.Done()
+		return nil
+	})
+	client := newTestClient(fw)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- client.Run(ctx)
+	}()
+
+	assert.Eventually(t, func() bool {
+		return fw.starts.Load() == 3
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	assert.NoError(t, <-done)
+}
+
+func TestRunReturnsFatalForwarderError(t *testing.T) {
+	fw := newFakeForwarder(func(ctx context.Context, attempt int32) error {
+		return forwarder.ErrFatal
+	})
+	client := newTestClient(fw)
+
+	assert.ErrorIs(t, client.Run(context.Background()), forwarder.ErrFatal)
+	assert.Equal(t, int32(1), fw.starts.Load())
+}
+
+func TestShutdownStopsRun(t *testing.T) {
+	var fw *fakeForwarder
+	fw = newFakeForwarder(func(ctx context.Context, attempt int32) error {
+		<-fw.stopped
+		return nil
+	})
+	client := newTestClient(fw)
+
+	done := make(chan error)
+	go func() {
+		done <- client.Run(context.Background())
+	}()
+
+	assert.Eventually(t, func() bool {
+		return fw.starts.Load() == 1
+	}, time.Second, time.Millisecond)
+	assert.ErrorIs(t, client.Run(context.Background()), ErrAlreadyRunning)
+
+	assert.NoError(t, client.Shutdown(context.Background()))
+	assert.NoError(t, <-done)
+}
+
+func TestRestartBackoffDelay(t *testing.T) {
+	backoff := RestartBackoff{InitialDelay: time.Second, MaxDelay: time.Minute}
+
+	assert.Equal(t, time.Second, backoff.delay(1))
+	assert.Equal(t, 4*time.Second, backoff.delay(3))
+	assert.Equal(t, time.Minute, backoff.delay(10))
+	assert.Equal(t, time.Minute, backoff.delay(math.MaxUint64))
+	assert.Zero(t, RestartBackoff{}.delay(5))
+}
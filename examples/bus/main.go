@@ -25,7 +25,7 @@ func main() {
 		panic(err)
 	}
 
-	if err := SimpleNATSPubSub(); err != nil {
+	if err := SimpleNATSPubSub(tp); err != nil {
 		panic(err)
 	}
 
@@ -58,7 +58,7 @@ func setupTracing() (*sdktrace.TracerProvider, error) {
 	return tracerProvider, nil
 }
 
-func SimpleNATSPubSub() error {
+func SimpleNATSPubSub(tp *sdktrace.TracerProvider) error {
 	logger, _ := zap.NewDevelopment()
 	tracer := otel.Tracer("test-tracer")
 
@@ -81,6 +81,7 @@ func SimpleNATSPubSub() error {
 				Duplicates:   time.Minute,
 			},
 		},
+		TracerProvider: tp,
 		OTelPropagator: propagation.NewCompositeTextMapPropagator(
 			propagation.TraceContext{},
 			propagation.Baggage{},
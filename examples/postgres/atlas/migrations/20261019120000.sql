@@ -0,0 +1,2 @@
+-- Modify "event_outbox" table
+ALTER TABLE "strongforce"."event_outbox" ADD COLUMN "causation_id" character varying(255) NULL, ADD COLUMN "correlation_id" character varying(255) NULL;
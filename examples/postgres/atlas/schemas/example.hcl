@@ -17,6 +17,14 @@ table "event_outbox" {
     type    = timestamp
     default = sql("CURRENT_TIMESTAMP")
   }
+  column "causation_id" {
+    null = true
+    type = varchar(255)
+  }
+  column "correlation_id" {
+    null = true
+    type = varchar(255)
+  }
   primary_key {
     columns = [column.id]
   }
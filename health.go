@@ -0,0 +1,281 @@
+package strongforce
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/vectrum-io/strongforce/pkg/bus/nats"
+	"github.com/vectrum-io/strongforce/pkg/forwarder"
+)
+
+type HealthStatus string
+
+const (
+	HealthOK        HealthStatus = "ok"
+	HealthDegraded  HealthStatus = "degraded"
+	HealthUnhealthy HealthStatus = "unhealthy"
+)
+
+// worse returns the more severe of s and other.
+func (s HealthStatus) worse(other HealthStatus) HealthStatus {
+	if healthSeverity(other) > healthSeverity(s) {
+		return other
+	}
+	return s
+}
+
+func healthSeverity(s HealthStatus) int {
+	switch s {
+	case HealthDegraded:
+		return 1
+	case HealthUnhealthy:
+		return 2
+	default:
+		return 0
+	}
+}
+
+// HealthThresholds decide when a lagging forwarder makes the client degraded
+// or unhealthy. Zero disables a threshold.
+type HealthThresholds struct {
+	// DegradedPollAge and UnhealthyPollAge apply to the time since the
+	// forwarder last polled the outbox successfully, or since it started if
+	// it has not polled yet. They do not apply to event-driven forwarders
+	// such as the Debezium forwarder, which are idle while the outbox is.
+	DegradedPollAge  time.Duration
+	UnhealthyPollAge time.Duration
+	// DegradedOutboxDepth and UnhealthyOutboxDepth apply to the number of
+	// events waiting in the outbox.
+	DegradedOutboxDepth  int64
+	UnhealthyOutboxDepth int64
+	// DegradedOutboxAge and UnhealthyOutboxAge apply to the age of the oldest
+	// event waiting in the outbox.
+	DegradedOutboxAge  time.Duration
+	UnhealthyOutboxAge time.Duration
+}
+
+var DefaultHealthThresholds = HealthThresholds{
+	DegradedPollAge:    30 * time.Second,
+	UnhealthyPollAge:   2 * time.Minute,
+	DegradedOutboxAge:  time.Minute,
+	UnhealthyOutboxAge: 5 * time.Minute,
+}
+
+// HealthReport is the result of Client.Health. Components that are not
+// configured are omitted.
+type HealthReport struct {
+	Status    HealthStatus     `json:"status"`
+	CheckedAt time.Time        `json:"checked_at"`
+	DB        *DBHealth        `json:"db,omitempty"`
+	Bus       *BusHealth       `json:"bus,omitempty"`
+	Forwarder *ForwarderHealth `json:"forwarder,omitempty"`
+}
+
+type DBHealth struct {
+	Status HealthStatus `json:"status"`
+	Error  string       `json:"error,omitempty"`
+}
+
+type BusHealth struct {
+	Status             HealthStatus         `json:"status"`
+	Errors             []string             `json:"errors,omitempty"`
+	Connection         string               `json:"connection"`
+	JetStreamReachable bool                 `json:"jetstream_reachable"`
+	MissingStreams     []string             `json:"missing_streams,omitempty"`
+	Subscriptions      []SubscriptionHealth `json:"subscriptions"`
+}
+
+type SubscriptionHealth struct {
+	Consumer string `json:"consumer"`
+	Stream   string `json:"stream"`
+	Running  bool   `json:"running"`
+}
+
+type ForwarderHealth struct {
+	Status  HealthStatus `json:"status"`
+	Error   string       `json:"error,omitempty"`
+	Running bool         `json:"running"`
+	// Standby is set on replicas waiting for leadership, which do not poll.
+	Standby    bool       `json:"standby"`
+	LastPollAt *time.Time `json:"last_poll_at,omitempty"`
+	// OutboxDepth and OldestEventAgeSeconds are omitted if the forwarder
+	// cannot report them.
+	OutboxDepth           *int64   `json:"outbox_depth,omitempty"`
+	OldestEventAgeSeconds *float64 `json:"oldest_event_age_seconds,omitempty"`
+}
+
+// busHealthChecker is implemented by bus backends that can report their
+// health.
+type busHealthChecker interface {
+	Health(ctx context.Context) nats.Health
+}
+
+// Health checks the database, the bus and the forwarder and reports the
+// worst status among them, judging the forwarder by the thresholds set with
+// WithHealthThresholds. Checks are bounded by ctx.
+func (sf *Client) Health(ctx context.Context) *HealthReport {
+	report := &HealthReport{
+		Status:    HealthOK,
+		CheckedAt: time.Now(),
+	}
+
+	if sf.db != nil {
+		report.DB = sf.dbHealth(ctx)
+		report.Status = report.Status.worse(report.DB.Status)
+	}
+
+	if checker, ok := sf.bus.(busHealthChecker); ok {
+		report.Bus = busHealth(checker.Health(ctx))
+		report.Status = report.Status.worse(report.Bus.Status)
+	}
+
+	if reporter, ok := sf.forwarder.(forwarder.StatusReporter); ok {
+		report.Forwarder = sf.forwarderHealth(ctx, reporter)
+		report.Status = report.Status.worse(report.Forwarder.Status)
+	}
+
+	return report
+}
+
+// HealthHandler serves Client.Health as JSON, with status 503 when the client
+// is unhealthy and 200 otherwise, so it can back a Kubernetes readiness
+// probe.
+func (sf *Client) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := sf.Health(r.Context())
+
+		statusCode := http.StatusOK
+		if report.Status == HealthUnhealthy {
+			statusCode = http.StatusServiceUnavailable
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(statusCode)
+		_ = json.NewEncoder(w).Encode(report)
+	})
+}
+
+func (sf *Client) dbHealth(ctx context.Context) *DBHealth {
+	if !sf.connected.Load() {
+		return &DBHealth{Status: HealthUnhealthy, Error: "not connected"}
+	}
+
+	if err := sf.db.Connection().PingContext(ctx); err != nil {
+		return &DBHealth{Status: HealthUnhealthy, Error: err.Error()}
+	}
+
+	return &DBHealth{Status: HealthOK}
+}
+
+func busHealth(health nats.Health) *BusHealth {
+	report := &BusHealth{
+		Status:             HealthOK,
+		Connection:         string(health.Connection),
+		JetStreamReachable: health.JetStreamErr == nil,
+		MissingStreams:     health.MissingStreams,
+		Subscriptions:      make([]SubscriptionHealth, 0, len(health.Subscriptions)),
+	}
+
+	switch health.Connection {
+	case nats.ConnectionConnected:
+	case nats.ConnectionReconnecting:
+		report.Status = HealthDegraded
+	default:
+		report.Status = HealthUnhealthy
+	}
+
+	if health.JetStreamErr != nil {
+		report.Status = report.Status.worse(HealthUnhealthy)
+		report.Errors = append(report.Errors, health.JetStreamErr.Error())
+	}
+
+	if len(health.MissingStreams) > 0 {
+		report.Status = report.Status.worse(HealthUnhealthy)
+	}
+
+	streams := make([]string, 0, len(health.StreamErrs))
+	for stream := range health.StreamErrs {
+		streams = append(streams, stream)
+	}
+	sort.Strings(streams)
+	for _, stream := range streams {
+		report.Status = report.Status.worse(HealthUnhealthy)
+		report.Errors = append(report.Errors, health.StreamErrs[stream].Error())
+	}
+
+	for _, subscription := range health.Subscriptions {
+		if !subscription.Running {
+			report.Status = report.Status.worse(HealthDegraded)
+		}
+		report.Subscriptions = append(report.Subscriptions, SubscriptionHealth{
+			Consumer: subscription.Consumer,
+			Stream:   subscription.Stream,
+			Running:  subscription.Running,
+		})
+	}
+
+	return report
+}
+
+func (sf *Client) forwarderHealth(ctx context.Context, reporter forwarder.StatusReporter) *ForwarderHealth {
+	thresholds := sf.healthThresholds
+	status, err := reporter.Status(ctx)
+
+	report := &ForwarderHealth{
+		Status:  HealthOK,
+		Running: status.Running,
+		Standby: status.Standby,
+	}
+
+	if err != nil {
+		report.Status = HealthDegraded
+		report.Error = err.Error()
+	}
+
+	if !status.Running {
+		report.Status = HealthUnhealthy
+	} else if !status.Standby && !status.EventDriven {
+		progressAt := status.StartedAt
+		if status.LastPollAt.After(progressAt) {
+			progressAt = status.LastPollAt
+		}
+		report.Status = report.Status.worse(durationStatus(time.Since(progressAt), thresholds.DegradedPollAge, thresholds.UnhealthyPollAge))
+	}
+
+	if !status.LastPollAt.IsZero() {
+		report.LastPollAt = &status.LastPollAt
+	}
+
+	if status.Outbox != nil {
+		depth := status.Outbox.Depth
+		age := status.Outbox.OldestEventAge.Seconds()
+		report.OutboxDepth = &depth
+		report.OldestEventAgeSeconds = &age
+
+		report.Status = report.Status.worse(countStatus(depth, thresholds.DegradedOutboxDepth, thresholds.UnhealthyOutboxDepth))
+		report.Status = report.Status.worse(durationStatus(status.Outbox.OldestEventAge, thresholds.DegradedOutboxAge, thresholds.UnhealthyOutboxAge))
+	}
+
+	return report
+}
+
+func durationStatus(value, degraded, unhealthy time.Duration) HealthStatus {
+	return countStatus(int64(value), int64(degraded), int64(unhealthy))
+}
+
+// countStatus compares value against thresholds, ignoring those that are
+// zero.
+func countStatus(value, degraded, unhealthy int64) HealthStatus {
+	switch {
+	case unhealthy > 0 && value >= unhealthy:
+		return HealthUnhealthy
+	case degraded > 0 && value >= degraded:
+		return HealthDegraded
+	default:
+		return HealthOK
+	}
+}
@@ -0,0 +1,211 @@
+package strongforce
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vectrum-io/strongforce/pkg/bus/nats"
+	"github.com/vectrum-io/strongforce/pkg/forwarder"
+)
+
+type statusForwarder struct {
+	*fakeForwarder
+	status forwarder.Status
+	err    error
+}
+
+func (f *statusForwarder) Status(ctx context.Context) (forwarder.Status, error) {
+	return f.status, f.err
+}
+
+func newHealthTestClient(status forwarder.Status, err error) *Client {
+	client := newTestClient(&statusForwarder{
+		fakeForwarder: newFakeForwarder(nil),
+		status:        status,
+		err:           err,
+	})
+	client.healthThresholds = HealthThresholds{
+		DegradedPollAge:      time.Minute,
+		UnhealthyPollAge:     time.Hour,
+		DegradedOutboxDepth:  10,
+		UnhealthyOutboxDepth: 100,
+	}
+	return client
+}
+
+func TestHealthForwarder(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name   string
+		status forwarder.Status
+		err    error
+		want   HealthStatus
+	}{
+		{
+			name: "not running",
+			want: HealthUnhealthy,
+		},
+		{
+			name:   "recently started",
+			status: forwarder.Status{Running: true, StartedAt: now},
+			want:   HealthOK,
+		},
+		{
+			name:   "recently polled",
+			status: forwarder.Status{Running: true, StartedAt: now.Add(-2 * time.Hour), LastPollAt: now},
+			want:   HealthOK,
+		},
+		{
+			name:   "poll lagging",
+			status: forwarder.Status{Running: true, StartedAt: now.Add(-2 * time.Minute)},
+			want:   HealthDegraded,
+		},
+		{
+			name:   "poll stalled",
+			status: forwarder.Status{Running: true, StartedAt: now.Add(-2 * time.Hour), LastPollAt: now.Add(-90 * time.Minute)},
+			want:   HealthUnhealthy,
+		},
+		{
+			name:   "event-driven idle",
+			status: forwarder.Status{Running: true, EventDriven: true, StartedAt: now.Add(-2 * time.Hour), LastPollAt: now.Add(-90 * time.Minute)},
+			want:   HealthOK,
+		},
+		{
+			name:   "standby",
+			status: forwarder.Status{Running: true, Standby: true, StartedAt: now.Add(-2 * time.Hour)},
+			want:   HealthOK,
+		},
+		{
+			name:   "outbox backing up",
+			status: forwarder.Status{Running: true, StartedAt: now, Outbox: &forwarder.OutboxStatus{Depth: 50}},
+			want:   HealthDegraded,
+		},
+		{
+			name:   "outbox full",
+			status: forwarder.Status{Running: true, StartedAt: now, Outbox: &forwarder.OutboxStatus{Depth: 100}},
+			want:   HealthUnhealthy,
+		},
+		{
+			name:   "status error",
+			status: forwarder.Status{Running: true, StartedAt: now},
+			err:    errors.New("dummy"),
+			want:   HealthDegraded,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := newHealthTestClient(tt.status, tt.err).Health(context.Background())
+
+			if !assert.NotNil(t, report.Forwarder) {
+				return
+			}
+			assert.Equal(t, tt.want, report.Forwarder.Status)
+			assert.Equal(t, tt.want, report.Status)
+			assert.Nil(t, report.DB)
+			assert.Nil(t, report.Bus)
+		})
+	}
+}
+
+func TestHealthBus(t *testing.T) {
+	tests := []struct {
+		name   string
+		health nats.Health
+		want   HealthStatus
+	}{
+		{
+			name: "healthy",
+			health: nats.Health{
+				Connection:    nats.ConnectionConnected,
+				Subscriptions: []nats.SubscriptionHealth{{Consumer: "c", Stream: "s", Running: true}},
+			},
+			want: HealthOK,
+		},
+		{
+			name:   "reconnecting",
+			health: nats.Health{Connection: nats.ConnectionReconnecting},
+			want:   HealthDegraded,
+		},
+		{
+			name:   "closed",
+			health: nats.Health{Connection: nats.ConnectionClosed},
+			want:   HealthUnhealthy,
+		},
+		{
+			name:   "jetstream unreachable",
+			health: nats.Health{Connection: nats.ConnectionConnected, JetStreamErr: errors.New("dummy")},
+			want:   HealthUnhealthy,
+		},
+		{
+			name:   "missing stream",
+			health: nats.Health{Connection: nats.ConnectionConnected, MissingStreams: []string{"s"}},
+			want:   HealthUnhealthy,
+		},
+		{
+			name:   "stopped subscription",
+			health: nats.Health{Connection: nats.ConnectionConnected, Subscriptions: []nats.SubscriptionHealth{{Consumer: "c", Stream: "s"}}},
+			want:   HealthDegraded,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, busHealth(tt.health).Status)
+		})
+	}
+}
+
+func TestHealthHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     forwarder.Status
+		wantCode   int
+		wantStatus HealthStatus
+	}{
+		{
+			name:       "ok",
+			status:     forwarder.Status{Running: true, StartedAt: time.Now()},
+			wantCode:   http.StatusOK,
+			wantStatus: HealthOK,
+		},
+		{
+			name:       "degraded",
+			status:     forwarder.Status{Running: true, StartedAt: time.Now(), Outbox: &forwarder.OutboxStatus{Depth: 10}},
+			wantCode:   http.StatusOK,
+			wantStatus: HealthDegraded,
+		},
+		{
+			name:       "unhealthy",
+			wantCode:   http.StatusServiceUnavailable,
+			wantStatus: HealthUnhealthy,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			newHealthTestClient(tt.status, nil).HealthHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+			assert.Equal(t, tt.wantCode, recorder.Code)
+			assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+
+			var report HealthReport
+			if !assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &report)) {
+				return
+			}
+			assert.Equal(t, tt.wantStatus, report.Status)
+			if !assert.NotNil(t, report.Forwarder) {
+				return
+			}
+			assert.Equal(t, tt.status.Running, report.Forwarder.Running)
+		})
+	}
+}
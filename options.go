@@ -1,6 +1,7 @@
 package strongforce
 
 import (
+	"context"
 	"errors"
 	"fmt"
 
@@ -9,6 +10,7 @@ import (
 	"github.com/vectrum-io/strongforce/pkg/db/postgres"
 	"github.com/vectrum-io/strongforce/pkg/events"
 	"github.com/vectrum-io/strongforce/pkg/forwarder"
+	"github.com/vectrum-io/strongforce/pkg/idempotency"
 	"github.com/vectrum-io/strongforce/pkg/outbox"
 	"go.uber.org/zap"
 )
@@ -20,18 +22,43 @@ type outboxProvider interface {
 	Outbox() *outbox.Outbox
 }
 
+// idempotencyProvider is implemented by db backends that support idempotency
+// keys, so the client can run their cleanup job.
+type idempotencyProvider interface {
+	IdempotencyStore() *idempotency.Store
+}
+
+// busCloser is implemented by bus backends that hold connections and
+// subscriptions to release on Client.Shutdown.
+type busCloser interface {
+	Close(ctx context.Context) error
+}
+
 var (
 	ErrNoDB  = errors.New("no database configured")
 	ErrNoBus = errors.New("no bus configured")
+	// ErrLogicalMessagePrefixMismatch is returned when an outbox emits
+	// logical messages without a replication forwarder reading messages of
+	// the same prefix, or a replication forwarder reads messages no outbox
+	// emits. Either way no event would be forwarded.
+	ErrLogicalMessagePrefixMismatch = errors.New("outbox LogicalMessagePrefix and replication forwarder MessagePrefix differ")
+	// ErrMultipleForwarders is returned when more than one of WithForwarder,
+	// WithDebeziumForwarder, WithReplicationForwarder and WithBinlogForwarder
+	// is used. A client runs a single forwarder.
+	ErrMultipleForwarders = errors.New("more than one forwarder configured")
 )
 
 type clientOptions struct {
-	mysqlOptions             *mysql.Options
-	postgresOptions          *postgres.Options
-	forwarderOptions         *forwarder.Options
-	debeziumForwarderOptions *forwarder.DebeziumOptions
-	natsOptions              *nats.Options
-	logger                   *zap.Logger
+	mysqlOptions                *mysql.Options
+	postgresOptions             *postgres.Options
+	forwarderOptions            *forwarder.Options
+	debeziumForwarderOptions    *forwarder.DebeziumOptions
+	replicationForwarderOptions *forwarder.ReplicationOptions
+	binlogForwarderOptions      *forwarder.BinlogOptions
+	natsOptions                 *nats.Options
+	forwarderRestartBackoff     *RestartBackoff
+	healthThresholds            *HealthThresholds
+	logger                      *zap.Logger
 }
 
 type Option func(o *clientOptions)
@@ -72,9 +99,72 @@ func WithDebeziumForwarder(options *forwarder.DebeziumOptions) Option {
 	}
 }
 
+// WithReplicationForwarder forwards events from a Postgres logical
+// replication slot instead of polling the outbox. Requires WithPostgres.
+func WithReplicationForwarder(options *forwarder.ReplicationOptions) Option {
+	return func(o *clientOptions) {
+		o.replicationForwarderOptions = options
+	}
+}
+
+// WithBinlogForwarder forwards events by reading the MySQL binary log
+// instead of polling the outbox. Requires WithMySQL.
+func WithBinlogForwarder(options *forwarder.BinlogOptions) Option {
+	return func(o *clientOptions) {
+		o.binlogForwarderOptions = options
+	}
+}
+
+// WithForwarderRestartBackoff sets the backoff between forwarder restarts in
+// Client.Run. Defaults to DefaultForwarderRestartBackoff.
+func WithForwarderRestartBackoff(backoff RestartBackoff) Option {
+	return func(o *clientOptions) {
+		o.forwarderRestartBackoff = &backoff
+	}
+}
+
+// WithHealthThresholds sets when a lagging forwarder makes Client.Health
+// report degraded or unhealthy. Defaults to DefaultHealthThresholds.
+func WithHealthThresholds(thresholds HealthThresholds) Option {
+	return func(o *clientOptions) {
+		o.healthThresholds = &thresholds
+	}
+}
+
 func (co *clientOptions) CreateClient() (*Client, error) {
+	forwarders := 0
+	for _, configured := range []bool{
+		co.forwarderOptions != nil,
+		co.debeziumForwarderOptions != nil,
+		co.replicationForwarderOptions != nil,
+		co.binlogForwarderOptions != nil,
+	} {
+		if configured {
+			forwarders++
+		}
+	}
+	if forwarders > 1 {
+		return nil, fmt.Errorf("cannot create forwarder: %w", ErrMultipleForwarders)
+	}
+
+	if co.logger == nil {
+		co.logger = zap.L()
+	}
+
+	if co.forwarderRestartBackoff == nil {
+		co.forwarderRestartBackoff = &DefaultForwarderRestartBackoff
+	}
+
+	if co.healthThresholds == nil {
+		co.healthThresholds = &DefaultHealthThresholds
+	}
+
 	client := &Client{
-		eventBuilder: &events.Builder{},
+		eventBuilder:            &events.Builder{},
+		forwarderRestartBackoff: *co.forwarderRestartBackoff,
+		healthThresholds:        *co.healthThresholds,
+		logger:                  co.logger,
+		stopping:                make(chan struct{}),
 	}
 
 	if co.mysqlOptions != nil {
@@ -101,6 +191,16 @@ func (co *clientOptions) CreateClient() (*Client, error) {
 		client.bus = natsBus
 	}
 
+	if op, ok := client.db.(outboxProvider); ok && op.Outbox() != nil {
+		prefix := op.Outbox().LogicalMessagePrefix()
+		if prefix != "" && co.replicationForwarderOptions == nil {
+			return nil, fmt.Errorf("logical messages require a replication forwarder: %w", ErrLogicalMessagePrefixMismatch)
+		}
+		if co.replicationForwarderOptions != nil && co.replicationForwarderOptions.MessagePrefix != prefix {
+			return nil, fmt.Errorf("cannot create forwarder: %w", ErrLogicalMessagePrefixMismatch)
+		}
+	}
+
 	if co.forwarderOptions != nil {
 		if client.db == nil {
 			return nil, fmt.Errorf("cannot create forwarder: %w", ErrNoDB)
@@ -141,5 +241,37 @@ func (co *clientOptions) CreateClient() (*Client, error) {
 		client.forwarder = fw
 	}
 
+	if co.replicationForwarderOptions != nil {
+		if client.db == nil {
+			return nil, fmt.Errorf("cannot create forwarder: %w", ErrNoDB)
+		}
+
+		if co.natsOptions == nil {
+			return nil, fmt.Errorf("cannot create forwarder: %w", ErrNoBus)
+		}
+
+		fw, err := forwarder.NewReplicationForwarder(client.db, client.bus, co.replicationForwarderOptions)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create replication forwarder: %w", err)
+		}
+		client.forwarder = fw
+	}
+
+	if co.binlogForwarderOptions != nil {
+		if client.db == nil {
+			return nil, fmt.Errorf("cannot create forwarder: %w", ErrNoDB)
+		}
+
+		if co.natsOptions == nil {
+			return nil, fmt.Errorf("cannot create forwarder: %w", ErrNoBus)
+		}
+
+		fw, err := forwarder.NewBinlogForwarder(client.db, client.bus, co.binlogForwarderOptions)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create binlog forwarder: %w", err)
+		}
+		client.forwarder = fw
+	}
+
 	return client, nil
 }
@@ -0,0 +1,60 @@
+package strongforce
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vectrum-io/strongforce/pkg/db/postgres"
+	"github.com/vectrum-io/strongforce/pkg/forwarder"
+	"github.com/vectrum-io/strongforce/pkg/outbox"
+)
+
+func TestCreateClientLogicalMessagePrefixMismatch(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		prefix    string
+		forwarder Option
+	}{
+		{"no forwarder", "strongforce", func(o *clientOptions) {}},
+		{"polling forwarder", "strongforce", WithForwarder(&forwarder.Options{})},
+		{"debezium forwarder", "strongforce", WithDebeziumForwarder(&forwarder.DebeziumOptions{})},
+		{"different prefix", "strongforce", WithReplicationForwarder(&forwarder.ReplicationOptions{MessagePrefix: "other"})},
+		{"forwarder prefix only", "", WithReplicationForwarder(&forwarder.ReplicationOptions{MessagePrefix: "strongforce"})},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := New(
+				WithPostgres(&postgres.Options{
+					DSN:           "postgres://localhost/strongforce",
+					OutboxOptions: &outbox.Options{LogicalMessagePrefix: tc.prefix},
+				}),
+				tc.forwarder,
+			)
+			assert.ErrorIs(t, err, ErrLogicalMessagePrefixMismatch)
+		})
+	}
+
+	_, err := New(
+		WithPostgres(&postgres.Options{
+			DSN:           "postgres://localhost/strongforce",
+			OutboxOptions: &outbox.Options{LogicalMessagePrefix: "strongforce"},
+		}),
+		WithReplicationForwarder(&forwarder.ReplicationOptions{MessagePrefix: "strongforce"}),
+	)
+	assert.NotErrorIs(t, err, ErrLogicalMessagePrefixMismatch)
+}
+
+func TestCreateClientMultipleForwarders(t *testing.T) {
+	_, err := New(
+		WithPostgres(&postgres.Options{DSN: "postgres://localhost/strongforce"}),
+		WithForwarder(&forwarder.Options{DirectEmit: true}),
+		WithReplicationForwarder(&forwarder.ReplicationOptions{}),
+	)
+	assert.ErrorIs(t, err, ErrMultipleForwarders)
+
+	_, err = New(
+		WithPostgres(&postgres.Options{DSN: "postgres://localhost/strongforce"}),
+		WithDebeziumForwarder(&forwarder.DebeziumOptions{}),
+		WithBinlogForwarder(&forwarder.BinlogOptions{}),
+	)
+	assert.ErrorIs(t, err, ErrMultipleForwarders)
+}
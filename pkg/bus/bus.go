@@ -21,20 +21,68 @@ type SubscriberInfo interface {
 	HasPendingMessages() bool
 }
 
+const (
+	CausationIdHeader   = "Strongforce-Causation-Id"
+	CorrelationIdHeader = "Strongforce-Correlation-Id"
+	// OriginalMessageIdHeader carries the id of the message a redriven
+	// message was republished from. InboundMessage.Id prefers it over the
+	// message's own id, so inboxes deduplicate redriven messages.
+	OriginalMessageIdHeader = "Strongforce-Original-Message-Id"
+)
+
+// PublishFunc publishes a message to the bus. Bus.Publish satisfies it.
+type PublishFunc func(ctx context.Context, message *OutboundMessage) error
+
 type OutboundMessage struct {
 	Id      string
 	Subject string
 	Data    []byte
+	// Headers are attached to the message in addition to the tracing headers
+	// injected by the bus implementation.
+	Headers map[string]string
 }
 
 type InboundMessage struct {
-	MessageCtx   context.Context
-	Id           string
-	Subject      string
-	Data         []byte
-	Ack          func() error
-	Nak          func(retryAfter time.Duration) error
+	MessageCtx    context.Context
+	Id            string
+	Subject       string
+	Data          []byte
+	CausationId   string
+	CorrelationId string
+	// Stream, Consumer, StreamSequence and NumDelivered describe the JetStream
+	// delivery. They are zero for messages received without JetStream.
+	Stream         string
+	Consumer       string
+	StreamSequence uint64
+	NumDelivered   uint64
+	Ack            func() error
+	Nak            func(retryAfter time.Duration) error
+	// Term tells the server to stop redelivering the message.
+	Term func() error
+	// InProgress resets the server's AckWait timer for the message.
+	InProgress   func() error
 	deserializer serialization.Serializer
+	pattern      string
+	params       map[string]string
+}
+
+// Pattern returns the handler pattern the message was routed by. It is empty
+// outside of a handler invocation.
+func (im *InboundMessage) Pattern() string {
+	return im.pattern
+}
+
+// Param returns the subject token captured by the named wildcard name in the
+// handler pattern, e.g. "id" for "orders.{tenant}.{id}.created". It is empty
+// if the pattern has no such wildcard.
+func (im *InboundMessage) Param(name string) string {
+	return im.params[name]
+}
+
+// Params returns all values captured by named wildcards in the handler
+// pattern, keyed by name.
+func (im *InboundMessage) Params() map[string]string {
+	return im.params
 }
 
 func (im *InboundMessage) Unmarshal(dst interface{}) error {
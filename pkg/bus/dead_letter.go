@@ -0,0 +1,96 @@
+package bus
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Headers attached to dead-lettered messages. They record where the message
+// came from so it can be inspected and redriven to its original subject.
+const (
+	DeadLetterSubjectHeader   = "Strongforce-Dlq-Subject"
+	DeadLetterMessageIdHeader = "Strongforce-Dlq-Message-Id"
+	DeadLetterStreamHeader    = "Strongforce-Dlq-Stream"
+	DeadLetterSequenceHeader  = "Strongforce-Dlq-Stream-Sequence"
+	DeadLetterConsumerHeader  = "Strongforce-Dlq-Consumer"
+	DeadLetterAttemptsHeader  = "Strongforce-Dlq-Attempts"
+	DeadLetterErrorHeader     = "Strongforce-Dlq-Error"
+)
+
+// maxDeadLetterErrorLength bounds the error header; panic errors carry a full
+// stack trace that has no business in a message header.
+const maxDeadLetterErrorLength = 1024
+
+var (
+	ErrMessageDeadLettered = errors.New("message moved to dead-letter subject")
+)
+
+type deadLetter struct {
+	subject string
+	publish PublishFunc
+}
+
+// EnableDeadLetter makes the subscription republish messages to subject once
+// their final delivery attempt (maxDeliveries) fails or a handler returns a
+// Permanent error, and ack the original.
+// Bus implementations call it when WithDeadLetter is set; maxDeliveries <= 0
+// means unlimited redeliveries, so only Permanent errors are dead-lettered.
+// It also sets the subscription's SetMaxDeliveries.
+func (s *Subscription) EnableDeadLetter(subject string, maxDeliveries int, publish PublishFunc) {
+	s.deadLetter = &deadLetter{
+		subject: subject,
+		publish: publish,
+	}
+	s.SetMaxDeliveries(maxDeliveries)
+}
+
+func (dl *deadLetter) send(message InboundMessage, handlerErr error) error {
+	ctx := message.MessageCtx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	headers := map[string]string{
+		DeadLetterSubjectHeader:   message.Subject,
+		DeadLetterMessageIdHeader: message.Id,
+		DeadLetterStreamHeader:    message.Stream,
+		DeadLetterSequenceHeader:  strconv.FormatUint(message.StreamSequence, 10),
+		DeadLetterConsumerHeader:  message.Consumer,
+		DeadLetterAttemptsHeader:  strconv.FormatUint(message.NumDelivered, 10),
+		DeadLetterErrorHeader:     headerValue(handlerErr.Error(), maxDeadLetterErrorLength),
+	}
+	if message.CausationId != "" {
+		headers[CausationIdHeader] = message.CausationId
+	}
+	if message.CorrelationId != "" {
+		headers[CorrelationIdHeader] = message.CorrelationId
+	}
+
+	return dl.publish(ctx, &OutboundMessage{
+		Id:      deadLetterMessageId(message),
+		Subject: dl.subject,
+		Data:    message.Data,
+		Headers: headers,
+	})
+}
+
+// deadLetterMessageId derives a stable id so a retried dead-letter publish is
+// deduplicated by the dead-letter stream.
+func deadLetterMessageId(message InboundMessage) string {
+	if message.Id == "" {
+		return ""
+	}
+	return message.Id + "-dlq"
+}
+
+// headerValue strips line breaks, which would corrupt the NATS header block,
+// and truncates s to maxLength bytes.
+func headerValue(s string, maxLength int) string {
+	s = strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ").Replace(s)
+	if len(s) > maxLength {
+		s = s[:maxLength]
+	}
+	return s
+}
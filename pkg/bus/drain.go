@@ -0,0 +1,162 @@
+package bus
+
+import (
+	"context"
+	"sync"
+)
+
+type drain struct {
+	startOnce     sync.Once
+	interruptOnce sync.Once
+	// started is closed when Drain is called; interrupted when its deadline
+	// is hit.
+	started     chan struct{}
+	interrupted chan struct{}
+
+	mu sync.Mutex
+	// inFlight holds the messages whose handlers are running, so an
+	// interrupted drain can nak them.
+	inFlight map[*inFlightMessage]struct{}
+}
+
+// inFlightMessage is a message whose handlers are running.
+type inFlightMessage struct {
+	message InboundMessage
+	cancel  context.CancelFunc
+	// nakked is set once an interrupted drain nakked the message, which its
+	// handlers must then no longer settle.
+	nakked bool
+}
+
+func newDrain() *drain {
+	return &drain{
+		started:     make(chan struct{}),
+		interrupted: make(chan struct{}),
+		inFlight:    make(map[*inFlightMessage]struct{}),
+	}
+}
+
+// Drain stops fetching new messages, lets the workers finish the messages
+// they are handling and the ones already buffered, and returns once all
+// workers have exited. If ctx ends first, ctx's error is returned and every
+// message not settled yet is nakked for immediate redelivery instead of
+// waiting for AckWait: the buffered ones, and the ones whose handlers are
+// still running, whose ctx is cancelled and whose outcome is then discarded.
+// Messages buffered for a subscription that was never started are nakked.
+func (s *Subscription) Drain(ctx context.Context) error {
+	s.drain.startOnce.Do(func() {
+		s.Stop()
+		close(s.drain.started)
+	})
+
+	done := make(chan struct{})
+	go func() {
+		s.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		s.nakBuffered()
+		return nil
+	case <-ctx.Done():
+		s.drain.interruptOnce.Do(func() {
+			close(s.drain.interrupted)
+		})
+		s.nakInFlight()
+		s.nakBuffered()
+		return ctx.Err()
+	}
+}
+
+// handleBuffered handles the messages left in the buffer until it is empty or
+// the drain is interrupted.
+func (s *Subscription) handleBuffered() {
+	for {
+		select {
+		case <-s.drain.interrupted:
+			return
+		default:
+		}
+
+		select {
+		case message := <-s.inboundMessages:
+			s.processMessage(message)
+		default:
+			return
+		}
+	}
+}
+
+// nakBuffered naks the messages left in the buffer so the server redelivers
+// them without waiting for AckWait.
+func (s *Subscription) nakBuffered() {
+	for {
+		select {
+		case message := <-s.inboundMessages:
+			if message.Nak != nil {
+				s.nak(message, 0)
+			}
+		default:
+			return
+		}
+	}
+}
+
+// beginInFlight tracks message while its handlers run and returns the ctx
+// they run with, which an interrupted drain cancels. It reports false, having
+// nakked the message, if the drain was interrupted already.
+func (s *Subscription) beginInFlight(message InboundMessage) (context.Context, *inFlightMessage, bool) {
+	ctx := message.MessageCtx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	s.drain.mu.Lock()
+	defer s.drain.mu.Unlock()
+
+	select {
+	case <-s.drain.interrupted:
+		if message.Nak != nil {
+			s.nak(message, 0)
+		}
+		return nil, nil, false
+	default:
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	flight := &inFlightMessage{message: message, cancel: cancel}
+	s.drain.inFlight[flight] = struct{}{}
+	return ctx, flight, true
+}
+
+// endInFlight stops tracking flight once its handlers have returned. It
+// reports whether they may still settle the message, i.e. whether no
+// interrupted drain nakked it.
+func (s *Subscription) endInFlight(flight *inFlightMessage) bool {
+	s.drain.mu.Lock()
+	defer s.drain.mu.Unlock()
+
+	delete(s.drain.inFlight, flight)
+	flight.cancel()
+	return !flight.nakked
+}
+
+// nakInFlight cancels the handlers of the messages in flight and naks the
+// messages so the server redelivers them without waiting for AckWait.
+func (s *Subscription) nakInFlight() {
+	s.drain.mu.Lock()
+	var nakked []InboundMessage
+	for flight := range s.drain.inFlight {
+		flight.cancel()
+		if flight.message.Nak != nil {
+			flight.nakked = true
+			nakked = append(nakked, flight.message)
+		}
+	}
+	s.drain.mu.Unlock()
+
+	for _, message := range nakked {
+		s.nak(message, 0)
+	}
+}
@@ -0,0 +1,101 @@
+package bus
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDrainHandlesBufferedMessages(t *testing.T) {
+	mockCtx := &mockContext{}
+	mockCtx.On("Stop").Once()
+	mockChan := make(chan InboundMessage, 4)
+	sub := NewSubscription(mockChan, 2, nil, mockCtx.Stop)
+
+	release := make(chan struct{})
+	assert.NoError(t, sub.AddHandler("test.*", func(ctx context.Context, message InboundMessage) error {
+		<-release
+		return nil
+	}))
+
+	var messages []*mockMessage
+	for _, id := range []string{"1", "2", "3", "4"} {
+		msg := createMockMessage(id, "test.a")
+		msg.On("Ack").Once().Return(nil)
+		messages = append(messages, msg)
+		mockChan <- *msg.msg
+	}
+
+	sub.Start(context.Background())
+	assert.True(t, sub.IsRunning())
+
+	close(release)
+	assert.NoError(t, sub.Drain(context.Background()))
+	assert.False(t, sub.IsRunning())
+
+	mockCtx.AssertExpectations(t)
+	for _, msg := range messages {
+		msg.AssertExpectations(t)
+	}
+}
+
+func TestDrainNaksUnsettledMessagesOnDeadline(t *testing.T) {
+	mockCtx := &mockContext{}
+	mockCtx.On("Stop").Once()
+	mockChan := make(chan InboundMessage, 2)
+	sub := NewSubscription(mockChan, 1, nil, mockCtx.Stop)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handlerCtx := make(chan context.Context, 1)
+	assert.NoError(t, sub.AddHandler("test.*", func(ctx context.Context, message InboundMessage) error {
+		handlerCtx <- ctx
+		close(started)
+		// blocks past the drain's deadline
+		<-release
+		return nil
+	}))
+
+	inFlight := createMockMessage("1", "test.a")
+	inFlight.On("Nak", time.Duration(0)).Once().Return(nil)
+	buffered := createMockMessage("2", "test.a")
+	buffered.On("Nak", time.Duration(0)).Once().Return(nil)
+
+	mockChan <- *inFlight.msg
+	sub.Start(context.Background())
+	<-started
+	mockChan <- *buffered.msg
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, sub.Drain(ctx), context.DeadlineExceeded)
+
+	// both are redelivered right away, not after AckWait
+	inFlight.AssertExpectations(t)
+	buffered.AssertExpectations(t)
+	assert.ErrorIs(t, (<-handlerCtx).Err(), context.Canceled)
+	assert.True(t, sub.IsRunning())
+
+	// the handler's late result does not settle the nakked message again
+	close(release)
+	assert.NoError(t, sub.Drain(context.Background()))
+	assert.False(t, sub.IsRunning())
+	inFlight.AssertNotCalled(t, "Ack")
+	buffered.AssertNotCalled(t, "Ack")
+}
+
+func TestIsRunningReflectsAllWorkers(t *testing.T) {
+	mockCtx := &mockContext{}
+	sub := NewSubscription(make(chan InboundMessage), 4, nil, mockCtx.Stop)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sub.Start(ctx)
+	assert.True(t, sub.IsRunning())
+
+	cancel()
+	assert.Eventually(t, func() bool {
+		return !sub.IsRunning()
+	}, time.Second, time.Millisecond)
+}
@@ -0,0 +1,69 @@
+package bus
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+type heartbeat struct {
+	interval           time.Duration
+	maxHandlerDuration time.Duration
+}
+
+// SetHeartbeat makes the subscription call InProgress on a message every
+// interval while its handlers run, resetting the server's AckWait timer, and
+// cancel the handler ctx after maxHandlerDuration. Zero disables either part.
+// Bus implementations call it when WithHeartbeat is set.
+func (s *Subscription) SetHeartbeat(interval time.Duration, maxHandlerDuration time.Duration) {
+	s.heartbeat = &heartbeat{
+		interval:           interval,
+		maxHandlerDuration: maxHandlerDuration,
+	}
+}
+
+// startHeartbeat returns the ctx, derived from ctx, that handlers of message
+// run with and a func that stops the heartbeat and releases the ctx once they
+// have returned.
+func (s *Subscription) startHeartbeat(ctx context.Context, message InboundMessage) (context.Context, func()) {
+	if s.heartbeat == nil {
+		return ctx, func() {}
+	}
+
+	cancel := func() {}
+	if s.heartbeat.maxHandlerDuration > 0 {
+		ctx, cancel = context.WithTimeout(ctx, s.heartbeat.maxHandlerDuration)
+	}
+
+	if s.heartbeat.interval <= 0 || message.InProgress == nil {
+		return ctx, cancel
+	}
+
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(s.heartbeat.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := message.InProgress(); err != nil && s.onError != nil {
+					s.onError(fmt.Errorf("failed to mark message %s in progress: %w", message.Id, err))
+				}
+			case <-ctx.Done():
+				return
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	return ctx, func() {
+		close(stop)
+		<-stopped
+		cancel()
+	}
+}
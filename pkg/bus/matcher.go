@@ -14,9 +14,13 @@ var (
 // same as in nats: https://github.com/nats-io/nats.go/blob/610da835da9546f9132cf4d566aa80d1e95ef93b/jetstream/jetstream.go#L216
 var subjectRegexp = regexp.MustCompile(`^[^ >]*>?$`)
 
+// paramNameRegexp restricts the names of named wildcards such as {tenant}.
+var paramNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
 // MatchSubject checks whether a given subject matches a given pattern.
 // The pattern can be expressed in the same syntax as in NATS.
 // For more information about valid patterns check: https://docs.nats.io/nats-concepts/subjects#wildcards
+// Named wildcards such as {id} match like "*".
 func MatchSubject(subject, pattern string) bool {
 	subjectTokens := strings.Split(subject, ".")
 	patternTokens := strings.Split(pattern, ".")
@@ -33,9 +37,51 @@ func ValidatePattern(pattern string) error {
 		return fmt.Errorf("%w: %s", ErrInvalidSubjectPattern, pattern)
 	}
 
+	names := make(map[string]struct{})
+	for _, token := range strings.Split(pattern, ".") {
+		if !strings.ContainsAny(token, "{}") {
+			continue
+		}
+
+		name, ok := paramName(token)
+		if !ok || !paramNameRegexp.MatchString(name) {
+			return fmt.Errorf("%w: invalid named wildcard %s in %s", ErrInvalidSubjectPattern, token, pattern)
+		}
+
+		if _, ok := names[name]; ok {
+			return fmt.Errorf("%w: duplicate named wildcard %s in %s", ErrInvalidSubjectPattern, token, pattern)
+		}
+		names[name] = struct{}{}
+	}
+
 	return nil
 }
 
+// SubjectFilter translates named wildcards in pattern to "*", yielding a
+// subject filter NATS accepts.
+func SubjectFilter(pattern string) string {
+	if !strings.Contains(pattern, "{") {
+		return pattern
+	}
+
+	tokens := strings.Split(pattern, ".")
+	for i, token := range tokens {
+		if _, ok := paramName(token); ok {
+			tokens[i] = "*"
+		}
+	}
+
+	return strings.Join(tokens, ".")
+}
+
+// paramName returns the name of a named wildcard token such as {id}.
+func paramName(token string) (string, bool) {
+	if len(token) < 2 || token[0] != '{' || token[len(token)-1] != '}' {
+		return "", false
+	}
+	return token[1 : len(token)-1], true
+}
+
 func matchTokens(subjectTokens, patternTokens []string) bool {
 	// If there are no more tokens in the pattern, and no more tokens in the subject,
 	// then it is a match.
@@ -60,8 +106,8 @@ func matchTokens(subjectTokens, patternTokens []string) bool {
 		return true
 	}
 
-	// If the pattern token is "*", it matches any single subject token.
-	if patternTokens[0] == "*" {
+	// If the pattern token is "*" or a named wildcard, it matches any single subject token.
+	if isWildcardToken(patternTokens[0]) {
 		return matchTokens(subjectTokens[1:], patternTokens[1:])
 	}
 
@@ -16,6 +16,13 @@ func TestInvalidPatterns(t *testing.T) {
 		{"foo.>bar", ErrInvalidSubjectPattern},
 		{"foo.>.baz", ErrInvalidSubjectPattern},
 		{"foo.>.>", ErrInvalidSubjectPattern},
+		{"orders.{tenant}.{id}.created", nil},
+		{"orders.{tenant}.>", nil},
+		{"orders.{}.created", ErrInvalidSubjectPattern},
+		{"orders.{1id}.created", ErrInvalidSubjectPattern},
+		{"orders.{id.created", ErrInvalidSubjectPattern},
+		{"orders.x{id}.created", ErrInvalidSubjectPattern},
+		{"orders.{id}.{id}", ErrInvalidSubjectPattern},
 	}
 
 	for _, test := range tests {
@@ -47,7 +54,9 @@ func TestMatch(t *testing.T) {
 		{"foo.bar.baz", "foo.*.>", true},
 		{"foo.bar.baz", ">", true},
 		{"foo", "*", true},
+		{"orders.eu.1.created", "orders.{tenant}.{id}.created", true},
 		// fail cases
+		{"orders.eu.created", "orders.{tenant}.{id}.created", false},
 		{"foo.bar.baz", "foo.*.*.baz", false},
 		{"foo", "foo.bar", false},
 		{"foo.bar.baz", "foo.*.*.*", false},
@@ -63,3 +72,9 @@ func TestMatch(t *testing.T) {
 		})
 	}
 }
+
+func TestSubjectFilter(t *testing.T) {
+	assert.Equal(t, "orders.*.*.created", SubjectFilter("orders.{tenant}.{id}.created"))
+	assert.Equal(t, "orders.*.>", SubjectFilter("orders.{tenant}.>"))
+	assert.Equal(t, "orders.created", SubjectFilter("orders.created"))
+}
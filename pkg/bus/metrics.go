@@ -0,0 +1,255 @@
+package bus
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Metrics holds the OpenTelemetry instruments used by subscriptions and
+// publishers. It is safe to share a single *Metrics across subscriptions — all
+// operations on the underlying instruments are concurrency-safe.
+//
+// Use NewMetrics to construct against a MeterProvider. Attach it to a
+// subscription with SetMetrics and to a publisher with InstrumentPublish.
+type Metrics struct {
+	PublishedMessages      metric.Int64Counter
+	PublishErrors          metric.Int64Counter
+	PublishDurationSeconds metric.Float64Histogram
+	ReceivedMessages       metric.Int64Counter
+	HandlerDurationSeconds metric.Float64Histogram
+	HandlerErrors          metric.Int64Counter
+	HandlerPanics          metric.Int64Counter
+	Acks                   metric.Int64Counter
+	Naks                   metric.Int64Counter
+	Terms                  metric.Int64Counter
+	RoutingFailures        metric.Int64Counter
+	InFlightWorkers        metric.Int64UpDownCounter
+}
+
+// latencyBuckets are shared by the publish and handler histograms.
+var latencyBuckets = []float64{
+	0.001, 0.002, 0.004, 0.008, 0.016, 0.032,
+	0.064, 0.128, 0.256, 0.512, 1.024, 2.048,
+	4.096, 8.192, 16.384, 32.768,
+}
+
+// NewMetrics constructs the bus OTel instruments against the provided
+// MeterProvider.
+//
+// Returns the first instrument-creation error so the caller can surface it
+// during client setup.
+func NewMetrics(mp metric.MeterProvider) (*Metrics, error) {
+	if mp == nil {
+		return nil, fmt.Errorf("nil MeterProvider")
+	}
+	meter := mp.Meter(instrumentationName)
+
+	publishedMessages, err := meter.Int64Counter(
+		"strongforce.bus.publish.messages",
+		metric.WithDescription("Messages published to the bus, including failed attempts."),
+	)
+	if err != nil {
+		return nil, err
+	}
+	publishErrors, err := meter.Int64Counter(
+		"strongforce.bus.publish.errors",
+		metric.WithDescription("Publishes that returned an error."),
+	)
+	if err != nil {
+		return nil, err
+	}
+	publishDuration, err := meter.Float64Histogram(
+		"strongforce.bus.publish.duration",
+		metric.WithDescription("Wall time from publish to server acknowledgement."),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(latencyBuckets...),
+	)
+	if err != nil {
+		return nil, err
+	}
+	receivedMessages, err := meter.Int64Counter(
+		"strongforce.bus.received.messages",
+		metric.WithDescription("Messages picked up by a subscription worker."),
+	)
+	if err != nil {
+		return nil, err
+	}
+	handlerDuration, err := meter.Float64Histogram(
+		"strongforce.bus.handler.duration",
+		metric.WithDescription("Wall time spent in a message handler, including failed invocations."),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(latencyBuckets...),
+	)
+	if err != nil {
+		return nil, err
+	}
+	handlerErrors, err := meter.Int64Counter(
+		"strongforce.bus.handler.errors",
+		metric.WithDescription("Handler invocations that returned an error."),
+	)
+	if err != nil {
+		return nil, err
+	}
+	handlerPanics, err := meter.Int64Counter(
+		"strongforce.bus.handler.panics",
+		metric.WithDescription("Handler invocations that panicked."),
+	)
+	if err != nil {
+		return nil, err
+	}
+	acks, err := meter.Int64Counter(
+		"strongforce.bus.acks",
+		metric.WithDescription("Messages acked, including dead-lettered messages."),
+	)
+	if err != nil {
+		return nil, err
+	}
+	naks, err := meter.Int64Counter(
+		"strongforce.bus.naks",
+		metric.WithDescription("Failed messages nakked for delayed redelivery."),
+	)
+	if err != nil {
+		return nil, err
+	}
+	terms, err := meter.Int64Counter(
+		"strongforce.bus.terms",
+		metric.WithDescription("Messages terminated after a permanent handler error."),
+	)
+	if err != nil {
+		return nil, err
+	}
+	routingFailures, err := meter.Int64Counter(
+		"strongforce.bus.routing.failures",
+		metric.WithDescription("Messages that matched no handler pattern."),
+	)
+	if err != nil {
+		return nil, err
+	}
+	inFlightWorkers, err := meter.Int64UpDownCounter(
+		"strongforce.bus.workers.in_flight",
+		metric.WithDescription("Subscription workers currently handling a message."),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Metrics{
+		PublishedMessages:      publishedMessages,
+		PublishErrors:          publishErrors,
+		PublishDurationSeconds: publishDuration,
+		ReceivedMessages:       receivedMessages,
+		HandlerDurationSeconds: handlerDuration,
+		HandlerErrors:          handlerErrors,
+		HandlerPanics:          handlerPanics,
+		Acks:                   acks,
+		Naks:                   naks,
+		Terms:                  terms,
+		RoutingFailures:        routingFailures,
+		InFlightWorkers:        inFlightWorkers,
+	}, nil
+}
+
+// messageAttributes labels consumer-side metrics. The subject is left out on
+// purpose: subjects often embed entity ids and would explode cardinality. The
+// handler pattern is bounded by the registered handlers, so it is included
+// when the message is being handled.
+func messageAttributes(message InboundMessage) metric.MeasurementOption {
+	attributes := []attribute.KeyValue{
+		attribute.String("stream", message.Stream),
+		attribute.String("consumer", message.Consumer),
+	}
+	if message.pattern != "" {
+		attributes = append(attributes, attribute.String("pattern", message.pattern))
+	}
+	return metric.WithAttributes(attributes...)
+}
+
+type publishedStreamKey struct{}
+
+// SetPublishedStream reports the stream a publish was stored in, so
+// InstrumentPublish can label its metrics with it. Bus implementations call it
+// with the ctx their publish func was called with once the stream acked the
+// message; it is a no-op for uninstrumented publishes.
+func SetPublishedStream(ctx context.Context, stream string) {
+	if ctx == nil {
+		return
+	}
+	if published, ok := ctx.Value(publishedStreamKey{}).(*string); ok {
+		*published = stream
+	}
+}
+
+// publishAttributes labels publish metrics. As on the consumer side, the
+// subject is left out. The stream is empty for publishes that failed before
+// a stream acked them.
+func publishAttributes(stream string) metric.MeasurementOption {
+	return metric.WithAttributes(attribute.String("stream", stream))
+}
+
+// The methods below are nil-safe so call sites need no `if m != nil` guards.
+
+func (m *Metrics) observePublish(ctx context.Context, stream string, seconds float64, err error) {
+	if m == nil {
+		return
+	}
+	m.PublishedMessages.Add(ctx, 1, publishAttributes(stream))
+	m.PublishDurationSeconds.Record(ctx, seconds, publishAttributes(stream))
+	if err != nil {
+		m.PublishErrors.Add(ctx, 1, publishAttributes(stream))
+	}
+}
+
+func (m *Metrics) incReceived(ctx context.Context, message InboundMessage) {
+	if m != nil {
+		m.ReceivedMessages.Add(ctx, 1, messageAttributes(message))
+	}
+}
+
+func (m *Metrics) observeHandlerDuration(ctx context.Context, message InboundMessage, seconds float64, err error) {
+	if m == nil {
+		return
+	}
+	m.HandlerDurationSeconds.Record(ctx, seconds, messageAttributes(message))
+	if err != nil {
+		m.HandlerErrors.Add(ctx, 1, messageAttributes(message))
+	}
+}
+
+func (m *Metrics) incHandlerPanics(ctx context.Context, message InboundMessage) {
+	if m != nil {
+		m.HandlerPanics.Add(ctx, 1, messageAttributes(message))
+	}
+}
+
+func (m *Metrics) incAcks(ctx context.Context, message InboundMessage) {
+	if m != nil {
+		m.Acks.Add(ctx, 1, messageAttributes(message))
+	}
+}
+
+func (m *Metrics) incNaks(ctx context.Context, message InboundMessage) {
+	if m != nil {
+		m.Naks.Add(ctx, 1, messageAttributes(message))
+	}
+}
+
+func (m *Metrics) incTerms(ctx context.Context, message InboundMessage) {
+	if m != nil {
+		m.Terms.Add(ctx, 1, messageAttributes(message))
+	}
+}
+
+func (m *Metrics) incRoutingFailures(ctx context.Context, message InboundMessage) {
+	if m != nil {
+		m.RoutingFailures.Add(ctx, 1, messageAttributes(message))
+	}
+}
+
+func (m *Metrics) addInFlightWorkers(ctx context.Context, message InboundMessage, delta int64) {
+	if m != nil {
+		m.InFlightWorkers.Add(ctx, delta, messageAttributes(message))
+	}
+}
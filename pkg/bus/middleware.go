@@ -0,0 +1,220 @@
+package bus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.27.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// instrumentationName is the scope attached to spans and metrics created by
+// this package.
+const instrumentationName = "github.com/vectrum-io/strongforce/pkg/bus"
+
+var (
+	ErrHandlerPanicked = errors.New("handler panicked")
+)
+
+// Middleware wraps a HandlerFunc with cross-cutting behaviour. Middleware
+// registered first runs outermost.
+type Middleware func(next HandlerFunc) HandlerFunc
+
+// PublishInterceptor wraps a PublishFunc, the publishing counterpart of
+// Middleware.
+type PublishInterceptor func(next PublishFunc) PublishFunc
+
+// ChainMiddleware wraps fn so that middleware[0] runs first.
+func ChainMiddleware(fn HandlerFunc, middleware ...Middleware) HandlerFunc {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		fn = middleware[i](fn)
+	}
+	return fn
+}
+
+// ChainPublish wraps publish so that interceptors[0] runs first.
+func ChainPublish(publish PublishFunc, interceptors ...PublishInterceptor) PublishFunc {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		publish = interceptors[i](publish)
+	}
+	return publish
+}
+
+// Recover converts a handler panic into an error wrapping ErrHandlerPanicked,
+// so the message is left un-acked for redelivery instead of crashing the
+// process. Every subscription installs it as its outermost middleware.
+func Recover() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, message InboundMessage) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = fmt.Errorf("%w: %v\n%s", ErrHandlerPanicked, r, debug.Stack())
+				}
+			}()
+
+			return next(ctx, message)
+		}
+	}
+}
+
+// Timeout cancels the handler ctx after d.
+func Timeout(d time.Duration) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, message InboundMessage) error {
+			if ctx == nil {
+				ctx = context.Background()
+			}
+
+			ctx, cancel := context.WithTimeout(ctx, d)
+			defer cancel()
+
+			return next(ctx, message)
+		}
+	}
+}
+
+// Logging logs every handled message at debug level and every handler error
+// at warn level, with the message's id, subject and handling duration.
+func Logging(logger *zap.Logger) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, message InboundMessage) error {
+			start := time.Now()
+			err := next(ctx, message)
+
+			fields := []zap.Field{
+				zap.String("id", message.Id),
+				zap.String("subject", message.Subject),
+				zap.Duration("duration", time.Since(start)),
+			}
+
+			if err != nil {
+				logger.Warn("message handler failed", append(fields, zap.Error(err))...)
+				return err
+			}
+
+			logger.Debug("message handled", fields...)
+			return nil
+		}
+	}
+}
+
+// Tracing wraps every handler invocation in a consumer span following the
+// OpenTelemetry messaging conventions. attributes are added to every span,
+// e.g. messaging.system for the bus implementation. Handler errors and
+// panics are recorded on the span; panics are re-raised for Recover to
+// handle.
+//
+// The span is a child of the producer span when its context was propagated.
+// If the producer was not sampled, the span starts a new trace linked to the
+// producer instead, so the consumer's sampler decides on its own.
+func Tracing(tp trace.TracerProvider, attributes ...attribute.KeyValue) Middleware {
+	tracer := tp.Tracer(instrumentationName)
+
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, message InboundMessage) (err error) {
+			if ctx == nil {
+				ctx = context.Background()
+			}
+
+			ctx, span := tracer.Start(ctx, "process "+message.Subject, processSpanOptions(ctx, message, attributes)...)
+			defer func() {
+				if r := recover(); r != nil {
+					span.RecordError(fmt.Errorf("%w: %v", ErrHandlerPanicked, r), trace.WithStackTrace(true))
+					span.SetStatus(codes.Error, ErrHandlerPanicked.Error())
+					span.End()
+					panic(r)
+				}
+
+				if err != nil {
+					span.RecordError(err)
+					span.SetStatus(codes.Error, err.Error())
+				}
+				span.End()
+			}()
+
+			return next(ctx, message)
+		}
+	}
+}
+
+func processSpanOptions(ctx context.Context, message InboundMessage, attributes []attribute.KeyValue) []trace.SpanStartOption {
+	spanAttributes := []attribute.KeyValue{
+		semconv.MessagingOperationName("process"),
+		semconv.MessagingOperationTypeProcess,
+		semconv.MessagingDestinationName(message.Subject),
+		semconv.MessagingMessageBodySize(len(message.Data)),
+	}
+	if message.Id != "" {
+		spanAttributes = append(spanAttributes, semconv.MessagingMessageID(message.Id))
+	}
+	if message.pattern != "" {
+		spanAttributes = append(spanAttributes, semconv.MessagingDestinationTemplate(message.pattern))
+	}
+	if message.Consumer != "" {
+		spanAttributes = append(spanAttributes, semconv.MessagingConsumerGroupName(message.Consumer))
+	}
+
+	opts := []trace.SpanStartOption{
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(append(spanAttributes, attributes...)...),
+	}
+
+	producer := trace.SpanContextFromContext(ctx)
+	if producer.IsValid() && producer.IsRemote() && !producer.IsSampled() {
+		opts = append(opts, trace.WithNewRoot(), trace.WithLinks(trace.Link{SpanContext: producer}))
+	}
+
+	return opts
+}
+
+// InstrumentPublish records publish count, errors and latency into m,
+// labelled by the stream that next reports with SetPublishedStream.
+func InstrumentPublish(m *Metrics) PublishInterceptor {
+	return func(next PublishFunc) PublishFunc {
+		return func(ctx context.Context, message *OutboundMessage) error {
+			if ctx == nil {
+				ctx = context.Background()
+			}
+
+			var stream string
+			ctx = context.WithValue(ctx, publishedStreamKey{}, &stream)
+
+			start := time.Now()
+			err := next(ctx, message)
+			m.observePublish(ctx, stream, time.Since(start).Seconds(), err)
+
+			return err
+		}
+	}
+}
+
+// Instrument records handler duration, errors and panics into m. Panics are
+// counted and re-raised for Recover to handle.
+func Instrument(m *Metrics) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, message InboundMessage) error {
+			if ctx == nil {
+				ctx = context.Background()
+			}
+
+			start := time.Now()
+			defer func() {
+				if r := recover(); r != nil {
+					m.incHandlerPanics(ctx, message)
+					panic(r)
+				}
+			}()
+
+			err := next(ctx, message)
+			m.observeHandlerDuration(ctx, message, time.Since(start).Seconds(), err)
+
+			return err
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package bus
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestChainMiddlewareOrder(t *testing.T) {
+	var calls []string
+	record := func(name string) Middleware {
+		return func(next HandlerFunc) HandlerFunc {
+			return func(ctx context.Context, message InboundMessage) error {
+				calls = append(calls, name)
+				return next(ctx, message)
+			}
+		}
+	}
+
+	fn := ChainMiddleware(func(ctx context.Context, message InboundMessage) error {
+		calls = append(calls, "handler")
+		return nil
+	}, record("first"), record("second"))
+
+	assert.NoError(t, fn(context.Background(), InboundMessage{}))
+	assert.Equal(t, []string{"first", "second", "handler"}, calls)
+}
+
+func TestChainPublishOrder(t *testing.T) {
+	var calls []string
+	record := func(name string) PublishInterceptor {
+		return func(next PublishFunc) PublishFunc {
+			return func(ctx context.Context, message *OutboundMessage) error {
+				calls = append(calls, name)
+				return next(ctx, message)
+			}
+		}
+	}
+
+	publish := ChainPublish(func(ctx context.Context, message *OutboundMessage) error {
+		calls = append(calls, "publish")
+		return nil
+	}, record("first"), record("second"))
+
+	assert.NoError(t, publish(context.Background(), &OutboundMessage{}))
+	assert.Equal(t, []string{"first", "second", "publish"}, calls)
+}
+
+func TestSubscriptionUseWrapsExistingHandlers(t *testing.T) {
+	mockCtx := &mockContext{}
+	sub := NewSubscription(make(chan InboundMessage, 1), 1, nil, mockCtx.Stop)
+
+	err := sub.AddHandler("test.*", func(ctx context.Context, message InboundMessage) error {
+		return nil
+	})
+	assert.NoError(t, err)
+
+	wrapped := false
+	sub.Use(func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, message InboundMessage) error {
+			wrapped = true
+			return next(ctx, message)
+		}
+	})
+
+	msg := createMockMessage("1", "test.a")
+	msg.On("Ack").Once().Return(nil)
+
+	sub.handleMessage(*msg.msg)
+
+	assert.True(t, wrapped)
+	msg.AssertExpectations(t)
+}
+
+func TestTimeoutMiddleware(t *testing.T) {
+	fn := Timeout(time.Millisecond)(func(ctx context.Context, message InboundMessage) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	assert.ErrorIs(t, fn(context.Background(), InboundMessage{}), context.DeadlineExceeded)
+}
+
+func TestInstrumentMiddleware(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	metrics, err := NewMetrics(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	assert.NoError(t, err)
+
+	failing := ChainMiddleware(func(ctx context.Context, message InboundMessage) error {
+		return errors.New("dummy")
+	}, Instrument(metrics))
+	panicking := ChainMiddleware(func(ctx context.Context, message InboundMessage) error {
+		panic("boom")
+	}, Recover(), Instrument(metrics))
+
+	assert.Error(t, failing(context.Background(), InboundMessage{}))
+	assert.ErrorIs(t, panicking(context.Background(), InboundMessage{}), ErrHandlerPanicked)
+
+	sums := collectSums(t, reader)
+	assert.Equal(t, int64(1), sums["strongforce.bus.handler.errors"])
+	assert.Equal(t, int64(1), sums["strongforce.bus.handler.panics"])
+}
+
+func TestInstrumentPublish(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	metrics, err := NewMetrics(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	assert.NoError(t, err)
+
+	publish := ChainPublish(func(ctx context.Context, message *OutboundMessage) error {
+		if message.Id == "fail" {
+			return errors.New("dummy")
+		}
+		SetPublishedStream(ctx, "orders")
+		return nil
+	}, InstrumentPublish(metrics))
+
+	assert.NoError(t, publish(context.Background(), &OutboundMessage{Id: "ok"}))
+	assert.Error(t, publish(context.Background(), &OutboundMessage{Id: "fail"}))
+
+	sums := collectSums(t, reader)
+	assert.Equal(t, int64(2), sums["strongforce.bus.publish.messages"])
+	assert.Equal(t, int64(1), sums["strongforce.bus.publish.errors"])
+
+	var rm metricdata.ResourceMetrics
+	assert.NoError(t, reader.Collect(context.Background(), &rm))
+	streams := map[string]int64{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if sum, ok := m.Data.(metricdata.Sum[int64]); ok && m.Name == "strongforce.bus.publish.messages" {
+				for _, dp := range sum.DataPoints {
+					stream, _ := dp.Attributes.Value("stream")
+					streams[stream.AsString()] += dp.Value
+				}
+			}
+		}
+	}
+	assert.Equal(t, map[string]int64{"orders": 1, "": 1}, streams)
+}
+
+// collectSums reads all int64 sums from reader, keyed by instrument name and
+// summed across attribute sets.
+func collectSums(t *testing.T, reader *sdkmetric.ManualReader) map[string]int64 {
+	var rm metricdata.ResourceMetrics
+	assert.NoError(t, reader.Collect(context.Background(), &rm))
+
+	sums := map[string]int64{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if sum, ok := m.Data.(metricdata.Sum[int64]); ok {
+				for _, dp := range sum.DataPoints {
+					sums[m.Name] += dp.Value
+				}
+			}
+		}
+	}
+
+	return sums
+}
+
+func TestTracingMiddleware(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	failing := ChainMiddleware(func(ctx context.Context, message InboundMessage) error {
+		assert.True(t, trace.SpanContextFromContext(ctx).IsValid())
+		return errors.New("dummy")
+	}, Tracing(tp, attribute.String("messaging.system", "test")))
+	panicking := ChainMiddleware(func(ctx context.Context, message InboundMessage) error {
+		panic("boom")
+	}, Recover(), Tracing(tp))
+
+	message := InboundMessage{Id: "1", Subject: "test.a", Consumer: "consumer", pattern: "test.*"}
+	assert.Error(t, failing(context.Background(), message))
+	assert.ErrorIs(t, panicking(context.Background(), message), ErrHandlerPanicked)
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 2)
+
+	assert.Equal(t, "process test.a", spans[0].Name())
+	assert.Equal(t, trace.SpanKindConsumer, spans[0].SpanKind())
+	assert.Equal(t, codes.Error, spans[0].Status().Code)
+	assert.Contains(t, spans[0].Attributes(), attribute.String("messaging.system", "test"))
+	assert.Contains(t, spans[0].Attributes(), attribute.String("messaging.message.id", "1"))
+	assert.Contains(t, spans[0].Attributes(), attribute.String("messaging.destination.template", "test.*"))
+	assert.Contains(t, spans[0].Attributes(), attribute.String("messaging.consumer.group.name", "consumer"))
+
+	assert.Equal(t, codes.Error, spans[1].Status().Code)
+	assert.Len(t, spans[1].Events(), 1)
+}
+
+func TestTracingMiddlewareLinksUnsampledProducer(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	producer := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{1},
+		SpanID:  trace.SpanID{1},
+		Remote:  true,
+	})
+	sampledProducer := producer.WithTraceFlags(trace.FlagsSampled)
+
+	fn := ChainMiddleware(func(ctx context.Context, message InboundMessage) error {
+		return nil
+	}, Tracing(tp))
+
+	assert.NoError(t, fn(trace.ContextWithRemoteSpanContext(context.Background(), producer), InboundMessage{}))
+	assert.NoError(t, fn(trace.ContextWithRemoteSpanContext(context.Background(), sampledProducer), InboundMessage{}))
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 2)
+
+	assert.NotEqual(t, producer.TraceID(), spans[0].SpanContext().TraceID())
+	assert.Len(t, spans[0].Links(), 1)
+	assert.Equal(t, producer.SpanID(), spans[0].Links()[0].SpanContext.SpanID())
+
+	assert.Equal(t, sampledProducer.TraceID(), spans[1].SpanContext().TraceID())
+	assert.Equal(t, sampledProducer.SpanID(), spans[1].Parent().SpanID())
+	assert.Empty(t, spans[1].Links())
+}
@@ -2,28 +2,52 @@ package nats
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"github.com/nats-io/nats.go"
 	"github.com/vectrum-io/strongforce/pkg/bus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.27.0"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
+const instrumentationName = "github.com/vectrum-io/strongforce/pkg/bus/nats"
+
+// messagingSystem is the messaging.system span attribute for this bus.
+var messagingSystem = semconv.MessagingSystemKey.String("nats")
+
 type Broadcaster struct {
+	conn           *nats.Conn
+	ownsConn       bool
 	jetStream      nats.JetStreamContext
 	logger         *zap.SugaredLogger
 	otelPropagator propagation.TextMapPropagator
+	tracer         trace.Tracer
 }
 
 type BroadcasterOptions struct {
-	NATSAddress    string
+	NATSAddress string
+	// Conn is used instead of connecting to NATSAddress. Close flushes it but
+	// leaves it open.
+	Conn           *nats.Conn
 	Logger         *zap.SugaredLogger
 	OTelPropagator propagation.TextMapPropagator
+	// TracerProvider creates a producer span for every broadcast. Nil disables
+	// spans; the propagator still forwards the caller's trace context.
+	TracerProvider trace.TracerProvider
 }
 
 func NewBroadcaster(opts *BroadcasterOptions) (*Broadcaster, error) {
-	nc, err := nats.Connect(opts.NATSAddress)
-	if err != nil {
-		return nil, err
+	nc := opts.Conn
+	if nc == nil {
+		var err error
+		nc, err = nats.Connect(opts.NATSAddress)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	js, err := nc.JetStream(nats.PublishAsyncMaxPending(256))
@@ -31,28 +55,83 @@ func NewBroadcaster(opts *BroadcasterOptions) (*Broadcaster, error) {
 		return nil, err
 	}
 
+	var tracer trace.Tracer
+	if opts.TracerProvider != nil {
+		tracer = opts.TracerProvider.Tracer(instrumentationName)
+	}
+
 	return &Broadcaster{
+		conn:           nc,
+		ownsConn:       opts.Conn == nil,
 		jetStream:      js,
 		logger:         opts.Logger,
 		otelPropagator: opts.OTelPropagator,
+		tracer:         tracer,
 	}, nil
 }
 
-func (nb *Broadcaster) Broadcast(ctx context.Context, message *bus.OutboundMessage) error {
+func (nb *Broadcaster) Broadcast(ctx context.Context, message *bus.OutboundMessage) (err error) {
 	nb.logger.Debugf("Broadcasting event to %+v", message.Subject)
 
+	if nb.tracer != nil {
+		var span trace.Span
+		ctx, span = nb.tracer.Start(ctx, "publish "+message.Subject,
+			trace.WithSpanKind(trace.SpanKindProducer),
+			trace.WithAttributes(publishSpanAttributes(message)...),
+		)
+		defer func() {
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			span.End()
+		}()
+	}
+
 	headers := nats.Header{}
+	for key, value := range message.Headers {
+		headers.Set(key, value)
+	}
 
 	// inject otel metadata into nats message headers
 	if nb.otelPropagator != nil {
 		nb.otelPropagator.Inject(ctx, propagation.HeaderCarrier(headers))
 	}
 
-	_, err := nb.jetStream.PublishMsg(&nats.Msg{
+	ack, err := nb.jetStream.PublishMsg(&nats.Msg{
 		Header:  headers,
 		Subject: message.Subject,
 		Data:    message.Data,
 	}, nats.MsgId(message.Id))
+	if err != nil {
+		return err
+	}
+
+	bus.SetPublishedStream(ctx, ack.Stream)
+	return nil
+}
+
+// Close flushes pending publishes and closes the connection unless it was
+// passed in as BroadcasterOptions.Conn.
+func (nb *Broadcaster) Close() error {
+	err := nb.conn.Flush()
+	if nb.ownsConn {
+		nb.conn.Close()
+	}
 
-	return err
+	if err != nil && !errors.Is(err, nats.ErrConnectionClosed) {
+		return fmt.Errorf("failed to flush nats connection: %w", err)
+	}
+	return nil
+}
+
+func publishSpanAttributes(message *bus.OutboundMessage) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		messagingSystem,
+		semconv.MessagingOperationName("publish"),
+		semconv.MessagingOperationTypePublish,
+		semconv.MessagingDestinationName(message.Subject),
+		semconv.MessagingMessageID(message.Id),
+		semconv.MessagingMessageBodySize(len(message.Data)),
+	}
 }
@@ -7,22 +7,62 @@ import (
 	"github.com/nats-io/nats.go"
 	"github.com/nats-io/nats.go/jetstream"
 	"github.com/vectrum-io/strongforce/pkg/bus"
+	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
+	"sync"
 )
 
 type Bus struct {
+	conn        *nats.Conn
+	ownsConn    bool
 	subscriber  *Subscriber
 	broadcaster *Broadcaster
+	publish     bus.PublishFunc
+	metrics     *bus.Metrics
 	options     *Options
 	logger      *zap.SugaredLogger
+	// stopStatusLog stops logging the state changes of Options.Conn.
+	stopStatusLog func()
+
+	subscriptionsMu sync.Mutex
+	subscriptions   []trackedSubscription
+}
+
+type trackedSubscription struct {
+	consumer     string
+	stream       string
+	subscription *bus.Subscription
 }
 
 type Options struct {
-	NATSAddress    string
-	Logger         *zap.Logger
-	Streams        []nats.StreamConfig
+	NATSAddress string
+	// Connection configures the connection to NATSAddress, shared by
+	// publishing, subscriptions and Migrate.
+	Connection ConnectionOptions
+	// Conn is used instead of connecting to NATSAddress; Connection is
+	// ignored. The bus neither closes it nor installs its handlers, but logs
+	// its state changes until Close.
+	Conn    *nats.Conn
+	Logger  *zap.Logger
+	Streams []nats.StreamConfig
+	// Consumers are durable consumers created and updated by Migrate.
+	Consumers      []ConsumerConfig
 	OTelPropagator propagation.TextMapPropagator
+	// Middleware is installed on every subscription created by Subscribe,
+	// before any middleware added with Subscription.Use.
+	Middleware []bus.Middleware
+	// PublishInterceptors wrap every Publish, including dead-letter and
+	// redrive publishes.
+	PublishInterceptors []bus.PublishInterceptor
+	// MeterProvider enables OpenTelemetry metrics for publishes and for every
+	// subscription created by Subscribe. Nil disables them.
+	MeterProvider metric.MeterProvider
+	// TracerProvider enables OpenTelemetry producer spans for publishes and
+	// process spans around every handler invocation. Nil disables them;
+	// OTelPropagator still forwards trace context.
+	TracerProvider trace.TracerProvider
 }
 
 func New(options *Options) (*Bus, error) {
@@ -30,33 +70,73 @@ func New(options *Options) (*Bus, error) {
 		options.Logger = zap.L()
 	}
 
+	conn := options.Conn
+	if conn == nil {
+		var err error
+		conn, err = options.Connection.connect(options.NATSAddress, options.Logger.Sugar())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// closes the connection when New fails after opening it
+	closeConn := func(err error) error {
+		if options.Conn == nil {
+			conn.Close()
+		}
+		return err
+	}
+
 	subscriber, err := NewSubscriber(&SubscriberOptions{
-		NATSAddress:    options.NATSAddress,
+		Conn:           conn,
 		OTelPropagator: options.OTelPropagator,
 	})
 	if err != nil {
-		return nil, err
+		return nil, closeConn(err)
 	}
 
 	broadcaster, err := NewBroadcaster(&BroadcasterOptions{
-		NATSAddress:    options.NATSAddress,
+		Conn:           conn,
 		Logger:         options.Logger.Sugar(),
 		OTelPropagator: options.OTelPropagator,
+		TracerProvider: options.TracerProvider,
 	})
 	if err != nil {
-		return nil, err
+		return nil, closeConn(err)
+	}
+
+	var metrics *bus.Metrics
+	publishInterceptors := options.PublishInterceptors
+	if options.MeterProvider != nil {
+		metrics, err = bus.NewMetrics(options.MeterProvider)
+		if err != nil {
+			return nil, closeConn(fmt.Errorf("failed to create bus metrics: %w", err))
+		}
+
+		// innermost, so the latency covers the broadcast alone
+		publishInterceptors = append(append([]bus.PublishInterceptor{}, publishInterceptors...), bus.InstrumentPublish(metrics))
+	}
+
+	stopStatusLog := func() {}
+	if options.Conn != nil {
+		stopStatusLog = logStatusChanges(conn, options.Logger.Sugar())
 	}
 
 	return &Bus{
-		subscriber:  subscriber,
-		broadcaster: broadcaster,
-		options:     options,
-		logger:      options.Logger.Sugar(),
+		conn:          conn,
+		ownsConn:      options.Conn == nil,
+		subscriber:    subscriber,
+		broadcaster:   broadcaster,
+		publish:       bus.ChainPublish(broadcaster.Broadcast, publishInterceptors...),
+		metrics:       metrics,
+		options:       options,
+		logger:        options.Logger.Sugar(),
+		stopStatusLog: stopStatusLog,
 	}, nil
 }
 
 func (b *Bus) Publish(ctx context.Context, message *bus.OutboundMessage) error {
-	return b.broadcaster.Broadcast(ctx, message)
+	return b.publish(ctx, message)
 }
 
 func (b *Bus) Subscribe(ctx context.Context, subscriberName string, stream string, opts ...bus.SubscribeOption) (*bus.Subscription, error) {
@@ -93,58 +173,80 @@ func (b *Bus) Subscribe(ctx context.Context, subscriberName string, stream strin
 	}
 
 	subscription, err := b.subscriber.Subscribe(ctx, stream, &SubscribeOpts{
-		ConsumerName:    subscriberName,
-		DurableName:     durableName,
-		CreateConsumer:  true,
-		DeliverPolicy:   &deliverPolicy,
-		FilterSubjects:  subscriptionOptions.FilterSubjects,
-		MaxDeliverTries: subscriptionOptions.MaxDeliveryTries,
-		MaxAckPending:   concurrency,
-		Concurrency:     concurrency,
-		AckWait:         subscriptionOptions.AckWait,
-		Deserializer:    subscriptionOptions.Deserializer,
+		ConsumerName:       subscriberName,
+		DurableName:        durableName,
+		CreateConsumer:     true,
+		DeliverPolicy:      &deliverPolicy,
+		FilterSubjects:     subscriptionOptions.FilterSubjects,
+		MaxDeliverTries:    subscriptionOptions.MaxDeliveryTries,
+		MaxAckPending:      concurrency,
+		Concurrency:        concurrency,
+		AckWait:            subscriptionOptions.AckWait,
+		Deserializer:       subscriptionOptions.Deserializer,
+		DeadLetterSubject:  subscriptionOptions.DeadLetterSubject,
+		DeadLetterPublish:  b.Publish,
+		RetryPolicy:        subscriptionOptions.RetryPolicy,
+		HeartbeatInterval:  subscriptionOptions.HeartbeatInterval,
+		MaxHandlerDuration: subscriptionOptions.MaxHandlerDuration,
+		RoutingMode:        subscriptionOptions.RoutingMode,
+		TracerProvider:     b.options.TracerProvider,
+		Metrics:            b.metrics,
 	})
 	if err != nil {
 		return nil, err
 	}
 
+	subscription.Use(b.options.Middleware...)
+
+	b.subscriptionsMu.Lock()
+	b.subscriptions = append(b.subscriptions, trackedSubscription{
+		consumer:     subscriberName,
+		stream:       stream,
+		subscription: subscription,
+	})
+	b.subscriptionsMu.Unlock()
+
 	return subscription, nil
 }
 
-func (b *Bus) Migrate(ctx context.Context) error {
-	conn, err := nats.Connect(b.options.NATSAddress)
-	if err != nil {
-		return fmt.Errorf("failed to connect to nats: %w", err)
+// Close drains every subscription created by Subscribe, then flushes and
+// closes the NATS connection unless it was passed in as Options.Conn.
+// Subscriptions still draining when ctx ends have their
+// buffered and in-flight messages nakked; see bus.Subscription.Drain.
+func (b *Bus) Close(ctx context.Context) error {
+	b.subscriptionsMu.Lock()
+	subscriptions := b.subscriptions
+	b.subscriptions = nil
+	b.subscriptionsMu.Unlock()
+
+	var errs []error
+	for _, tracked := range subscriptions {
+		if err := tracked.subscription.Drain(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("failed to drain subscription: %w", err))
+		}
 	}
 
-	js, err := conn.JetStream()
-	if err != nil {
-		return fmt.Errorf("failed to get jetstream context: %w", err)
+	if err := b.broadcaster.Close(); err != nil {
+		errs = append(errs, err)
 	}
+	if b.ownsConn {
+		b.conn.Close()
+	}
+	b.stopStatusLog()
 
-	for _, streamConfig := range b.options.Streams {
-		b.logger.Infof("validating nats stream %s", streamConfig.Name)
-		_, err := js.StreamInfo(streamConfig.Name)
-		if err != nil {
-			if !errors.Is(err, nats.ErrStreamNotFound) {
-				return fmt.Errorf("failed to get stream info: %w", err)
-			}
-
-			// create new stream
-			b.logger.Infof("creating new stream %s", streamConfig.Name)
-			if _, err := js.AddStream(&streamConfig); err != nil {
-				return fmt.Errorf("failed to add stream: %w", err)
-			}
-			continue
-		}
+	return errors.Join(errs...)
+}
 
-		b.logger.Infof("updating existing stream %s", streamConfig.Name)
-		if _, err := js.UpdateStream(&streamConfig); err != nil {
-			return fmt.Errorf("failed to update stream: %w", err)
-		}
-	}
+// Migrate creates and updates the streams in Options.Streams and the
+// consumers in Options.Consumers. See MigrateWithOptions.
+func (b *Bus) Migrate(ctx context.Context) error {
+	_, err := b.MigrateWithOptions(ctx, MigrationOptions{})
+	return err
+}
 
-	return nil
+// Status returns the state of the NATS connection.
+func (b *Bus) Status() nats.Status {
+	return b.conn.Status()
 }
 
 func (b *Bus) SubscriberInfo(ctx context.Context, stream string, consumerName string) (bus.SubscriberInfo, error) {
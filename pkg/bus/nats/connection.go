@@ -0,0 +1,207 @@
+package nats
+
+import (
+	"crypto/tls"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+)
+
+// ConnectionOptions configure the connection the bus opens to NATSAddress.
+// Zero values keep the nats.go defaults.
+type ConnectionOptions struct {
+	// Name identifies the connection in server monitoring.
+	Name string
+
+	// CredentialsFile is a .creds file holding a user JWT and NKey seed.
+	CredentialsFile string
+	// UserJWT and NKeySeed authenticate with a decentralized JWT directly,
+	// without a credentials file.
+	UserJWT  string
+	NKeySeed string
+	// NKeySeedFile authenticates with a bare NKey.
+	NKeySeedFile string
+	// User and Password, or Token, authenticate against a server with
+	// static credentials. They are ignored when the NATS address carries
+	// credentials itself.
+	User     string
+	Password string
+	Token    string
+
+	// TLSConfig secures the connection. RootCAs and ClientCert/ClientKey are
+	// shortcuts for file-based configs and are applied on top of it.
+	TLSConfig  *tls.Config
+	RootCAs    []string
+	ClientCert string
+	ClientKey  string
+
+	// MaxReconnects bounds reconnect attempts; negative retries forever.
+	// Pass nats.NoReconnect in Extra to disable reconnects.
+	MaxReconnects   int
+	ReconnectWait   time.Duration
+	ReconnectJitter time.Duration
+	ConnectTimeout  time.Duration
+	PingInterval    time.Duration
+	// RetryOnFailedConnect keeps retrying the initial connect in the
+	// background instead of failing New.
+	RetryOnFailedConnect bool
+
+	// The handlers are called after the bus logs the state change.
+	DisconnectErrHandler nats.ConnErrHandler
+	ReconnectHandler     nats.ConnHandler
+	ClosedHandler        nats.ConnHandler
+	ErrorHandler         nats.ErrHandler
+
+	// Extra is applied last and can override anything above.
+	Extra []nats.Option
+}
+
+// connect opens a connection to address configured by co, logging its state
+// changes to logger.
+func (co *ConnectionOptions) connect(address string, logger *zap.SugaredLogger) (*nats.Conn, error) {
+	conn, err := nats.Connect(address, co.natsOptions(logger)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to nats: %w", err)
+	}
+
+	return conn, nil
+}
+
+func (co *ConnectionOptions) natsOptions(logger *zap.SugaredLogger) []nats.Option {
+	var opts []nats.Option
+
+	if co.Name != "" {
+		opts = append(opts, nats.Name(co.Name))
+	}
+
+	if co.CredentialsFile != "" {
+		opts = append(opts, nats.UserCredentials(co.CredentialsFile))
+	}
+	if co.UserJWT != "" {
+		opts = append(opts, nats.UserJWTAndSeed(co.UserJWT, co.NKeySeed))
+	}
+	if co.NKeySeedFile != "" {
+		opt, err := nats.NkeyOptionFromSeed(co.NKeySeedFile)
+		if err != nil {
+			// surfaces on connect, like the other file-based options
+			opt = func(*nats.Options) error {
+				return fmt.Errorf("failed to load nkey seed: %w", err)
+			}
+		}
+		opts = append(opts, opt)
+	}
+	if co.User != "" {
+		opts = append(opts, nats.UserInfo(co.User, co.Password))
+	}
+	if co.Token != "" {
+		opts = append(opts, nats.Token(co.Token))
+	}
+
+	if co.TLSConfig != nil {
+		opts = append(opts, nats.Secure(co.TLSConfig.Clone()))
+	}
+	if len(co.RootCAs) > 0 {
+		opts = append(opts, nats.RootCAs(co.RootCAs...))
+	}
+	if co.ClientCert != "" || co.ClientKey != "" {
+		opts = append(opts, nats.ClientCert(co.ClientCert, co.ClientKey))
+	}
+
+	if co.MaxReconnects != 0 {
+		opts = append(opts, nats.MaxReconnects(co.MaxReconnects))
+	}
+	if co.ReconnectWait > 0 {
+		opts = append(opts, nats.ReconnectWait(co.ReconnectWait))
+	}
+	if co.ReconnectJitter > 0 {
+		opts = append(opts, nats.ReconnectJitter(co.ReconnectJitter, co.ReconnectJitter))
+	}
+	if co.ConnectTimeout > 0 {
+		opts = append(opts, nats.Timeout(co.ConnectTimeout))
+	}
+	if co.PingInterval > 0 {
+		opts = append(opts, nats.PingInterval(co.PingInterval))
+	}
+	if co.RetryOnFailedConnect {
+		opts = append(opts, nats.RetryOnFailedConnect(true))
+	}
+
+	opts = append(opts,
+		nats.DisconnectErrHandler(func(conn *nats.Conn, err error) {
+			if err != nil {
+				logger.Warnf("disconnected from nats: %s", err.Error())
+			} else {
+				logger.Infof("disconnected from nats")
+			}
+			if co.DisconnectErrHandler != nil {
+				co.DisconnectErrHandler(conn, err)
+			}
+		}),
+		nats.ReconnectHandler(func(conn *nats.Conn) {
+			logger.Infof("reconnected to nats at %s", conn.ConnectedUrlRedacted())
+			if co.ReconnectHandler != nil {
+				co.ReconnectHandler(conn)
+			}
+		}),
+		nats.ClosedHandler(func(conn *nats.Conn) {
+			logger.Infof("nats connection closed")
+			if co.ClosedHandler != nil {
+				co.ClosedHandler(conn)
+			}
+		}),
+		nats.ErrorHandler(func(conn *nats.Conn, subscription *nats.Subscription, err error) {
+			if subscription != nil {
+				logger.Errorf("nats error on subscription %s: %s", subscription.Subject, err.Error())
+			} else {
+				logger.Errorf("nats error: %s", err.Error())
+			}
+			if co.ErrorHandler != nil {
+				co.ErrorHandler(conn, subscription, err)
+			}
+		}),
+	)
+
+	return append(opts, co.Extra...)
+}
+
+// logStatusChanges logs the state changes of a connection the bus did not
+// open. It uses a status listener, so the handlers its owner installed stay
+// in place. The returned func stops logging.
+func logStatusChanges(conn *nats.Conn, logger *zap.SugaredLogger) func() {
+	statuses := conn.StatusChanged()
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case status, ok := <-statuses:
+				if !ok {
+					return
+				}
+				switch status {
+				case nats.CONNECTED:
+					logger.Infof("connected to nats at %s", conn.ConnectedUrlRedacted())
+				case nats.DISCONNECTED:
+					logger.Warnf("disconnected from nats")
+				case nats.RECONNECTING:
+					logger.Infof("reconnecting to nats")
+				case nats.CLOSED:
+					logger.Infof("nats connection closed")
+				}
+			}
+		}
+	}()
+
+	var stopOnce sync.Once
+	return func() {
+		stopOnce.Do(func() {
+			close(done)
+			conn.RemoveStatusListener(statuses)
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package nats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestLogStatusChanges(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+
+	conn, err := nats.Connect("nats://127.0.0.1:1", nats.RetryOnFailedConnect(true), nats.ReconnectWait(time.Hour))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	stop := logStatusChanges(conn, zap.New(core).Sugar())
+	defer stop()
+
+	conn.Close()
+
+	assert.Eventually(t, func() bool {
+		return logs.FilterMessage("nats connection closed").Len() == 1
+	}, time.Second, 10*time.Millisecond)
+}
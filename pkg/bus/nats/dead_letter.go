@@ -0,0 +1,112 @@
+package nats
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/vectrum-io/strongforce/pkg/bus"
+)
+
+// redriveBatchSize is how many dead-lettered messages are fetched per round
+// trip while redriving.
+const redriveBatchSize = 64
+
+// Redrive republishes dead-lettered messages from stream to the subject they
+// originally failed on and deletes them from the dead-letter stream. An empty
+// filterSubject redrives every message in the stream; limit <= 0 redrives all
+// of them. It returns the number of redriven messages.
+//
+// Redriven messages are published with a new JetStream message id so the
+// original stream's duplicate window does not swallow them, and carry the
+// original id in bus.OriginalMessageIdHeader, which InboundMessage.Id
+// prefers, so inboxes still deduplicate them.
+//
+// A redriven message is delivered to every consumer of its subject, not only
+// to the one it was dead-lettered by; consumers that already handled the
+// original should deduplicate it with an inbox.
+func (b *Bus) Redrive(ctx context.Context, stream string, filterSubject string, limit int) (int, error) {
+	dlqStream, err := b.subscriber.jetStream.Stream(ctx, stream)
+	if err != nil {
+		return 0, fmt.Errorf("dead letter stream not found at jetstream: %w", err)
+	}
+
+	consumerConfig := jetstream.OrderedConsumerConfig{}
+	if filterSubject != "" {
+		consumerConfig.FilterSubjects = []string{filterSubject}
+	}
+
+	consumer, err := dlqStream.OrderedConsumer(ctx, consumerConfig)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create redrive consumer: %w", err)
+	}
+
+	redriven := 0
+	for limit <= 0 || redriven < limit {
+		batchSize := redriveBatchSize
+		if limit > 0 && limit-redriven < batchSize {
+			batchSize = limit - redriven
+		}
+
+		batch, err := consumer.FetchNoWait(batchSize)
+		if err != nil {
+			return redriven, fmt.Errorf("failed to fetch dead-lettered messages: %w", err)
+		}
+
+		fetched := 0
+		for msg := range batch.Messages() {
+			fetched++
+			if err := b.redriveMessage(ctx, dlqStream, msg); err != nil {
+				return redriven, err
+			}
+			redriven++
+		}
+
+		if err := batch.Error(); err != nil {
+			return redriven, fmt.Errorf("failed to fetch dead-lettered messages: %w", err)
+		}
+
+		if fetched == 0 {
+			break
+		}
+	}
+
+	return redriven, nil
+}
+
+func (b *Bus) redriveMessage(ctx context.Context, dlqStream jetstream.Stream, msg jetstream.Msg) error {
+	metadata, err := msg.Metadata()
+	if err != nil {
+		return fmt.Errorf("failed to read dead-lettered message metadata: %w", err)
+	}
+
+	originalSubject := msg.Headers().Get(bus.DeadLetterSubjectHeader)
+	if originalSubject == "" {
+		return fmt.Errorf("dead-lettered message %d has no %s header", metadata.Sequence.Stream, bus.DeadLetterSubjectHeader)
+	}
+
+	originalId := msg.Headers().Get(bus.DeadLetterMessageIdHeader)
+	headers := map[string]string{bus.OriginalMessageIdHeader: originalId}
+	for _, key := range []string{bus.CausationIdHeader, bus.CorrelationIdHeader} {
+		if value := msg.Headers().Get(key); value != "" {
+			headers[key] = value
+		}
+	}
+
+	message := &bus.OutboundMessage{
+		Id:      fmt.Sprintf("%s-redrive-%d", originalId, metadata.Sequence.Stream),
+		Subject: originalSubject,
+		Data:    msg.Data(),
+		Headers: headers,
+	}
+
+	if err := b.Publish(ctx, message); err != nil {
+		return fmt.Errorf("failed to redrive message %d: %w", metadata.Sequence.Stream, err)
+	}
+
+	if err := dlqStream.DeleteMsg(ctx, metadata.Sequence.Stream); err != nil {
+		return fmt.Errorf("failed to delete redriven message %d: %w", metadata.Sequence.Stream, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,94 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// ConnectionState is the state of the bus's NATS connection.
+type ConnectionState string
+
+const (
+	ConnectionConnecting   ConnectionState = "CONNECTING"
+	ConnectionConnected    ConnectionState = "CONNECTED"
+	ConnectionReconnecting ConnectionState = "RECONNECTING"
+	ConnectionDisconnected ConnectionState = "DISCONNECTED"
+	ConnectionClosed       ConnectionState = "CLOSED"
+	ConnectionDrainingSubs ConnectionState = "DRAINING_SUBS"
+	ConnectionDrainingPubs ConnectionState = "DRAINING_PUBS"
+)
+
+// connectionState names a nats.Status as the ConnectionState of the same
+// name.
+func connectionState(status nats.Status) ConnectionState {
+	return ConnectionState(status.String())
+}
+
+// Health is a point-in-time view of the bus, used by health checks.
+type Health struct {
+	// Connection is the state of the NATS connection, e.g.
+	// ConnectionConnected or ConnectionReconnecting.
+	Connection ConnectionState
+	// JetStreamErr is set when the JetStream account info cannot be read.
+	JetStreamErr error
+	// MissingStreams lists configured streams that do not exist.
+	MissingStreams []string
+	// StreamErrs holds errors other than not found, per configured stream.
+	StreamErrs    map[string]error
+	Subscriptions []SubscriptionHealth
+}
+
+type SubscriptionHealth struct {
+	Consumer string
+	Stream   string
+	Running  bool
+}
+
+// Health checks the connection, JetStream, the configured Options.Streams
+// and the subscriptions created by Subscribe.
+func (b *Bus) Health(ctx context.Context) Health {
+	health := Health{
+		Connection: connectionState(b.conn.Status()),
+	}
+
+	if _, err := b.subscriber.jetStream.AccountInfo(ctx); err != nil {
+		health.JetStreamErr = fmt.Errorf("failed to get jetstream account info: %w", err)
+		// stream lookups would fail the same way
+		return b.subscriptionsHealth(health)
+	}
+
+	for _, streamConfig := range b.options.Streams {
+		if _, err := b.subscriber.jetStream.Stream(ctx, streamConfig.Name); err != nil {
+			if errors.Is(err, jetstream.ErrStreamNotFound) {
+				health.MissingStreams = append(health.MissingStreams, streamConfig.Name)
+				continue
+			}
+
+			if health.StreamErrs == nil {
+				health.StreamErrs = make(map[string]error)
+			}
+			health.StreamErrs[streamConfig.Name] = fmt.Errorf("failed to get stream: %w", err)
+		}
+	}
+
+	return b.subscriptionsHealth(health)
+}
+
+func (b *Bus) subscriptionsHealth(health Health) Health {
+	b.subscriptionsMu.Lock()
+	defer b.subscriptionsMu.Unlock()
+
+	for _, tracked := range b.subscriptions {
+		health.Subscriptions = append(health.Subscriptions, SubscriptionHealth{
+			Consumer: tracked.consumer,
+			Stream:   tracked.stream,
+			Running:  tracked.subscription.IsRunning(),
+		})
+	}
+
+	return health
+}
@@ -0,0 +1,22 @@
+package nats
+
+import (
+	"testing"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnectionState(t *testing.T) {
+	for status, state := range map[nats.Status]ConnectionState{
+		nats.CONNECTING:    ConnectionConnecting,
+		nats.CONNECTED:     ConnectionConnected,
+		nats.RECONNECTING:  ConnectionReconnecting,
+		nats.DISCONNECTED:  ConnectionDisconnected,
+		nats.CLOSED:        ConnectionClosed,
+		nats.DRAINING_SUBS: ConnectionDrainingSubs,
+		nats.DRAINING_PUBS: ConnectionDrainingPubs,
+	} {
+		assert.Equal(t, state, connectionState(status))
+	}
+}
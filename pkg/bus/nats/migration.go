@@ -0,0 +1,502 @@
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/hashicorp/go-version"
+	"github.com/nats-io/nats.go"
+)
+
+var (
+	ErrInvalidConsumerConfig = errors.New("invalid consumer config")
+	// ErrChangeNotInPlace is returned by Migrate when a declared stream or
+	// consumer differs from the existing one in a way JetStream cannot update.
+	ErrChangeNotInPlace = errors.New("change cannot be applied in place")
+	// ErrPruneUnsupported is returned by Migrate when pruning against a
+	// server that cannot store ManagedMetadataKey.
+	ErrPruneUnsupported = errors.New("prune is not supported")
+)
+
+// metadataVersion is the first server version that stores stream and
+// consumer metadata.
+var metadataVersion = version.Must(version.NewVersion("2.10.0"))
+
+// ConsumerConfig declares a durable consumer on Stream for Migrate.
+type ConsumerConfig struct {
+	Stream string
+	nats.ConsumerConfig
+}
+
+// ManagedMetadataKey marks the streams and consumers Migrate created or
+// updated, so that Prune leaves those of other applications alone.
+const ManagedMetadataKey = "strongforce.managed"
+
+type MigrationOptions struct {
+	// DryRun plans the migration without applying it.
+	DryRun bool
+	// Prune deletes streams that are not in Options.Streams and durable
+	// consumers of declared streams that are not in Options.Consumers. Only
+	// streams and consumers carrying ManagedMetadataKey are deleted, so ones
+	// created by other applications or by Subscribe are kept. Requires nats
+	// 2.10 or later.
+	Prune bool
+}
+
+type MigrationAction string
+
+const (
+	MigrationCreate MigrationAction = "create"
+	MigrationUpdate MigrationAction = "update"
+	MigrationDelete MigrationAction = "delete"
+)
+
+// MigrationChange is a planned change to a stream, or to a consumer if
+// Consumer is set.
+type MigrationChange struct {
+	Action   MigrationAction
+	Stream   string
+	Consumer string
+	// Fields lists the differing config fields of an update.
+	Fields []FieldChange
+
+	streamConfig   *nats.StreamConfig
+	consumerConfig *nats.ConsumerConfig
+}
+
+type FieldChange struct {
+	Field string
+	From  string
+	To    string
+	// InPlace is false for changes JetStream rejects on an existing stream or
+	// consumer, such as the storage type.
+	InPlace bool
+}
+
+// MigrationPlan lists the changes Migrate applies, in order: stream creates
+// and updates, consumer creates and updates, then consumer and stream
+// deletes.
+type MigrationPlan struct {
+	Changes []MigrationChange
+}
+
+func (mc MigrationChange) String() string {
+	target := "stream " + mc.Stream
+	if mc.Consumer != "" {
+		target = "consumer " + mc.Stream + "/" + mc.Consumer
+	}
+
+	var sb strings.Builder
+	sb.WriteString(string(mc.Action) + " " + target)
+	for _, field := range mc.Fields {
+		sb.WriteString(fmt.Sprintf("\n  %s: %s -> %s", field.Field, field.From, field.To))
+		if !field.InPlace {
+			sb.WriteString(" (not in place)")
+		}
+	}
+	return sb.String()
+}
+
+func (mp *MigrationPlan) String() string {
+	if len(mp.Changes) == 0 {
+		return "no changes"
+	}
+
+	lines := make([]string, len(mp.Changes))
+	for i, change := range mp.Changes {
+		lines[i] = change.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// notInPlaceErr returns an error listing the changes JetStream cannot apply,
+// or nil if there are none.
+func (mp *MigrationPlan) notInPlaceErr() error {
+	var refused []string
+	for _, change := range mp.Changes {
+		for _, field := range change.Fields {
+			if !field.InPlace {
+				target := change.Stream
+				if change.Consumer != "" {
+					target += "/" + change.Consumer
+				}
+				refused = append(refused, fmt.Sprintf("%s %s (%s -> %s)", target, field.Field, field.From, field.To))
+			}
+		}
+	}
+
+	if len(refused) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %s; delete and recreate them instead", ErrChangeNotInPlace, strings.Join(refused, ", "))
+}
+
+// MigrateWithOptions reconciles JetStream with Options.Streams and
+// Options.Consumers and returns the planned changes. Nothing is applied if
+// any change cannot be made in place. Fields left at their zero value in a
+// declaration keep the server's value.
+func (b *Bus) MigrateWithOptions(ctx context.Context, options MigrationOptions) (*MigrationPlan, error) {
+	js, err := b.conn.JetStream()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get jetstream context: %w", err)
+	}
+
+	plan, err := b.planMigration(ctx, js, options.Prune)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := plan.notInPlaceErr(); err != nil {
+		return plan, err
+	}
+
+	if options.DryRun {
+		return plan, nil
+	}
+
+	for _, change := range plan.Changes {
+		b.logger.Infof("migrating: %s", change.String())
+		if err := applyMigrationChange(ctx, js, change); err != nil {
+			return plan, err
+		}
+	}
+
+	return plan, nil
+}
+
+func (b *Bus) planMigration(ctx context.Context, js nats.JetStreamContext, prune bool) (*MigrationPlan, error) {
+	plan := &MigrationPlan{}
+
+	natsVersion, err := b.subscriber.serverVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	// older servers drop metadata, so nothing can be tagged
+	tagged := !natsVersion.LessThan(metadataVersion)
+	if prune && !tagged {
+		return nil, fmt.Errorf("%w: nats %s does not store the metadata that marks managed streams and consumers", ErrPruneUnsupported, natsVersion.String())
+	}
+	tag := func(declared, actual map[string]string) map[string]string {
+		if !tagged {
+			return declared
+		}
+		return managedMetadata(declared, actual)
+	}
+
+	declaredStreams := make(map[string]bool, len(b.options.Streams))
+	createdStreams := make(map[string]bool)
+	for _, streamConfig := range b.options.Streams {
+		declaredStreams[streamConfig.Name] = true
+
+		info, err := js.StreamInfo(streamConfig.Name, nats.Context(ctx))
+		if err != nil {
+			if !errors.Is(err, nats.ErrStreamNotFound) {
+				return nil, fmt.Errorf("failed to get stream info: %w", err)
+			}
+
+			streamConfig.Metadata = tag(streamConfig.Metadata, nil)
+			createdStreams[streamConfig.Name] = true
+			plan.Changes = append(plan.Changes, MigrationChange{
+				Action:       MigrationCreate,
+				Stream:       streamConfig.Name,
+				streamConfig: &streamConfig,
+			})
+			continue
+		}
+
+		streamConfig.Metadata = tag(streamConfig.Metadata, info.Config.Metadata)
+		if fields := diffStreamConfig(info.Config, streamConfig); len(fields) > 0 {
+			plan.Changes = append(plan.Changes, MigrationChange{
+				Action:       MigrationUpdate,
+				Stream:       streamConfig.Name,
+				Fields:       fields,
+				streamConfig: &streamConfig,
+			})
+		}
+	}
+
+	declaredConsumers := make(map[string]bool, len(b.options.Consumers))
+	for _, consumerConfig := range b.options.Consumers {
+		if err := consumerConfig.validate(); err != nil {
+			return nil, err
+		}
+		declaredConsumers[consumerConfig.Stream+"/"+consumerConfig.Durable] = true
+
+		declaredMetadata := consumerConfig.Metadata
+		consumerConfig.Metadata = tag(declaredMetadata, nil)
+		change := MigrationChange{
+			Action:         MigrationCreate,
+			Stream:         consumerConfig.Stream,
+			Consumer:       consumerConfig.Durable,
+			consumerConfig: &consumerConfig.ConsumerConfig,
+		}
+
+		if createdStreams[consumerConfig.Stream] {
+			plan.Changes = append(plan.Changes, change)
+			continue
+		}
+
+		info, err := js.ConsumerInfo(consumerConfig.Stream, consumerConfig.Durable, nats.Context(ctx))
+		if err != nil {
+			if !errors.Is(err, nats.ErrConsumerNotFound) {
+				return nil, fmt.Errorf("failed to get consumer info: %w", err)
+			}
+			plan.Changes = append(plan.Changes, change)
+			continue
+		}
+
+		consumerConfig.Metadata = tag(declaredMetadata, info.Config.Metadata)
+		if fields := diffConsumerConfig(info.Config, consumerConfig.ConsumerConfig); len(fields) > 0 {
+			change.Action = MigrationUpdate
+			change.Fields = fields
+			plan.Changes = append(plan.Changes, change)
+		}
+	}
+
+	if !prune {
+		return plan, nil
+	}
+
+	for _, streamConfig := range b.options.Streams {
+		if createdStreams[streamConfig.Name] {
+			continue
+		}
+
+		stream, err := b.subscriber.jetStream.Stream(ctx, streamConfig.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get stream: %w", err)
+		}
+
+		consumers := stream.ListConsumers(ctx)
+		for info := range consumers.Info() {
+			if info.Config.Durable == "" || !isManaged(info.Config.Metadata) || declaredConsumers[streamConfig.Name+"/"+info.Config.Durable] {
+				continue
+			}
+			plan.Changes = append(plan.Changes, MigrationChange{
+				Action:   MigrationDelete,
+				Stream:   streamConfig.Name,
+				Consumer: info.Config.Durable,
+			})
+		}
+		if err := consumers.Err(); err != nil {
+			return nil, fmt.Errorf("failed to list consumers: %w", err)
+		}
+	}
+
+	streams := b.subscriber.jetStream.ListStreams(ctx)
+	for info := range streams.Info() {
+		if declaredStreams[info.Config.Name] || !isManaged(info.Config.Metadata) {
+			continue
+		}
+		plan.Changes = append(plan.Changes, MigrationChange{
+			Action: MigrationDelete,
+			Stream: info.Config.Name,
+		})
+	}
+	if err := streams.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list streams: %w", err)
+	}
+
+	return plan, nil
+}
+
+func applyMigrationChange(ctx context.Context, js nats.JetStreamContext, change MigrationChange) error {
+	var err error
+	switch {
+	case change.Consumer == "" && change.Action == MigrationCreate:
+		_, err = js.AddStream(change.streamConfig, nats.Context(ctx))
+	case change.Consumer == "" && change.Action == MigrationUpdate:
+		_, err = js.UpdateStream(change.streamConfig, nats.Context(ctx))
+	case change.Consumer == "" && change.Action == MigrationDelete:
+		err = js.DeleteStream(change.Stream, nats.Context(ctx))
+	case change.Action == MigrationCreate:
+		_, err = js.AddConsumer(change.Stream, change.consumerConfig, nats.Context(ctx))
+	case change.Action == MigrationUpdate:
+		_, err = js.UpdateConsumer(change.Stream, change.consumerConfig, nats.Context(ctx))
+	case change.Action == MigrationDelete:
+		err = js.DeleteConsumer(change.Stream, change.Consumer, nats.Context(ctx))
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to %s: %w", strings.SplitN(change.String(), "\n", 2)[0], err)
+	}
+	return nil
+}
+
+func (cc ConsumerConfig) validate() error {
+	if cc.Stream == "" {
+		return fmt.Errorf("%w: consumer %s has no stream", ErrInvalidConsumerConfig, cc.Durable)
+	}
+	if cc.Durable == "" {
+		return fmt.Errorf("%w: consumer on stream %s has no durable name", ErrInvalidConsumerConfig, cc.Stream)
+	}
+	if cc.Name != "" && cc.Name != cc.Durable {
+		return fmt.Errorf("%w: consumer name %s differs from durable name %s", ErrInvalidConsumerConfig, cc.Name, cc.Durable)
+	}
+	return nil
+}
+
+// serverDefaultedStreamFields are filled in by the server when left zero.
+var serverDefaultedStreamFields = []string{
+	"Subjects", "MaxConsumers", "MaxMsgs", "MaxBytes", "MaxMsgsPerSubject",
+	"MaxMsgSize", "Replicas", "Duplicates", "FirstSeq", "Metadata",
+}
+
+// serverDefaultedConsumerFields are filled in by the server when left zero.
+var serverDefaultedConsumerFields = []string{
+	"Name", "AckWait", "MaxDeliver", "MaxWaiting", "MaxAckPending",
+	"Replicas", "Metadata",
+}
+
+func diffStreamConfig(actual, desired nats.StreamConfig) []FieldChange {
+	actual.Metadata = userMetadata(actual.Metadata)
+	inheritZeroFields(&desired, actual, serverDefaultedStreamFields)
+
+	return diffConfig(actual, desired, func(field string) bool {
+		switch field {
+		case "Storage", "MaxConsumers", "Mirror", "Template":
+			return false
+		case "Retention":
+			// limits and interest can be swapped, work queues cannot
+			return actual.Retention != nats.WorkQueuePolicy && desired.Retention != nats.WorkQueuePolicy
+		case "Sealed":
+			return !actual.Sealed
+		case "DenyDelete":
+			return !actual.DenyDelete
+		case "DenyPurge":
+			return !actual.DenyPurge
+		default:
+			return true
+		}
+	})
+}
+
+func diffConsumerConfig(actual, desired nats.ConsumerConfig) []FieldChange {
+	actual.Metadata = userMetadata(actual.Metadata)
+	normalizeFilterSubjects(&actual)
+	normalizeFilterSubjects(&desired)
+	inheritZeroFields(&desired, actual, serverDefaultedConsumerFields)
+
+	return diffConfig(actual, desired, func(field string) bool {
+		switch field {
+		case "Durable", "DeliverPolicy", "OptStartSeq", "OptStartTime", "AckPolicy", "ReplayPolicy", "MaxWaiting", "MemoryStorage":
+			return false
+		case "DeliverSubject":
+			// push consumers cannot become pull consumers and vice versa
+			return (actual.DeliverSubject == "") == (desired.DeliverSubject == "")
+		default:
+			return true
+		}
+	})
+}
+
+// diffConfig compares the exported fields of two configs of the same struct
+// type. inPlace reports whether a differing field can be updated.
+func diffConfig(actual, desired any, inPlace func(field string) bool) []FieldChange {
+	actualValue := reflect.ValueOf(actual)
+	desiredValue := reflect.ValueOf(desired)
+
+	var fields []FieldChange
+	for i := 0; i < actualValue.NumField(); i++ {
+		field := actualValue.Type().Field(i)
+		if !field.IsExported() || equalConfigValues(actualValue.Field(i), desiredValue.Field(i)) {
+			continue
+		}
+
+		fields = append(fields, FieldChange{
+			Field:   field.Name,
+			From:    formatConfigValue(actualValue.Field(i)),
+			To:      formatConfigValue(desiredValue.Field(i)),
+			InPlace: inPlace(field.Name),
+		})
+	}
+	return fields
+}
+
+// equalConfigValues treats nil and empty slices and maps as equal.
+func equalConfigValues(a, b reflect.Value) bool {
+	switch a.Kind() {
+	case reflect.Slice, reflect.Map:
+		if a.Len() == 0 && b.Len() == 0 {
+			return true
+		}
+	}
+	return reflect.DeepEqual(a.Interface(), b.Interface())
+}
+
+func formatConfigValue(v reflect.Value) string {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return "<nil>"
+		}
+		v = v.Elem()
+	}
+
+	// enums such as DeliverPolicy only name themselves in JSON
+	if _, ok := v.Interface().(fmt.Stringer); !ok {
+		if marshaler, ok := v.Interface().(json.Marshaler); ok {
+			if data, err := marshaler.MarshalJSON(); err == nil {
+				return strings.Trim(string(data), `"`)
+			}
+		}
+	}
+	return fmt.Sprintf("%v", v.Interface())
+}
+
+// inheritZeroFields copies the named fields from actual into desired where
+// desired has the zero value.
+func inheritZeroFields[T any](desired *T, actual T, fields []string) {
+	desiredValue := reflect.ValueOf(desired).Elem()
+	actualValue := reflect.ValueOf(actual)
+	for _, name := range fields {
+		field := desiredValue.FieldByName(name)
+		if field.IsZero() || (field.Kind() == reflect.Slice || field.Kind() == reflect.Map) && field.Len() == 0 {
+			field.Set(actualValue.FieldByName(name))
+		}
+	}
+}
+
+// managedMetadata returns the declared metadata tagged with
+// ManagedMetadataKey. Undeclared metadata keeps the server's value, like
+// other fields left at their zero value.
+func managedMetadata(declared, actual map[string]string) map[string]string {
+	if len(declared) == 0 {
+		declared = userMetadata(actual)
+	}
+
+	metadata := make(map[string]string, len(declared)+1)
+	for key, value := range declared {
+		metadata[key] = value
+	}
+	metadata[ManagedMetadataKey] = "true"
+	return metadata
+}
+
+func isManaged(metadata map[string]string) bool {
+	return metadata[ManagedMetadataKey] == "true"
+}
+
+// userMetadata drops the metadata the server adds itself.
+func userMetadata(metadata map[string]string) map[string]string {
+	filtered := make(map[string]string, len(metadata))
+	for key, value := range metadata {
+		if !strings.HasPrefix(key, "_nats.") {
+			filtered[key] = value
+		}
+	}
+	return filtered
+}
+
+// normalizeFilterSubjects stores a single filter subject in FilterSubject,
+// whichever field it was declared in.
+func normalizeFilterSubjects(config *nats.ConsumerConfig) {
+	if config.FilterSubject == "" && len(config.FilterSubjects) == 1 {
+		config.FilterSubject = config.FilterSubjects[0]
+		config.FilterSubjects = nil
+	}
+}
@@ -0,0 +1,151 @@
+package nats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffStreamConfigIgnoresServerDefaults(t *testing.T) {
+	actual := nats.StreamConfig{
+		Name:         "orders",
+		Subjects:     []string{"orders"},
+		MaxConsumers: -1,
+		MaxMsgs:      -1,
+		MaxBytes:     -1,
+		MaxMsgSize:   -1,
+		Replicas:     1,
+		Duplicates:   2 * time.Minute,
+		Metadata:     map[string]string{"_nats.ver": "2.11.0"},
+	}
+
+	assert.Empty(t, diffStreamConfig(actual, nats.StreamConfig{Name: "orders"}))
+}
+
+func TestDiffStreamConfig(t *testing.T) {
+	actual := nats.StreamConfig{Name: "orders", Subjects: []string{"orders.>"}}
+	desired := nats.StreamConfig{Name: "orders", Subjects: []string{"orders.>"}, MaxAge: time.Hour}
+
+	assert.Equal(t, []FieldChange{
+		{Field: "MaxAge", From: "0s", To: "1h0m0s", InPlace: true},
+	}, diffStreamConfig(actual, desired))
+}
+
+func TestDiffStreamConfigNotInPlace(t *testing.T) {
+	tests := []struct {
+		name    string
+		actual  nats.StreamConfig
+		desired nats.StreamConfig
+		field   string
+		inPlace bool
+	}{
+		{
+			name:    "storage",
+			actual:  nats.StreamConfig{Storage: nats.FileStorage},
+			desired: nats.StreamConfig{Storage: nats.MemoryStorage},
+			field:   "Storage",
+		},
+		{
+			name:    "retention to work queue",
+			actual:  nats.StreamConfig{Retention: nats.LimitsPolicy},
+			desired: nats.StreamConfig{Retention: nats.WorkQueuePolicy},
+			field:   "Retention",
+		},
+		{
+			name:    "retention to interest",
+			actual:  nats.StreamConfig{Retention: nats.LimitsPolicy},
+			desired: nats.StreamConfig{Retention: nats.InterestPolicy},
+			field:   "Retention",
+			inPlace: true,
+		},
+		{
+			name:    "allow deletes",
+			actual:  nats.StreamConfig{DenyDelete: true},
+			desired: nats.StreamConfig{},
+			field:   "DenyDelete",
+		},
+		{
+			name:    "deny deletes",
+			actual:  nats.StreamConfig{},
+			desired: nats.StreamConfig{DenyDelete: true},
+			field:   "DenyDelete",
+			inPlace: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields := diffStreamConfig(tt.actual, tt.desired)
+			if assert.Len(t, fields, 1) {
+				assert.Equal(t, tt.field, fields[0].Field)
+				assert.Equal(t, tt.inPlace, fields[0].InPlace)
+			}
+		})
+	}
+}
+
+func TestDiffConsumerConfig(t *testing.T) {
+	actual := nats.ConsumerConfig{
+		Durable:       "worker",
+		Name:          "worker",
+		AckPolicy:     nats.AckExplicitPolicy,
+		AckWait:       30 * time.Second,
+		MaxDeliver:    -1,
+		MaxWaiting:    512,
+		MaxAckPending: 1000,
+		FilterSubject: "orders.>",
+	}
+
+	desired := nats.ConsumerConfig{
+		Durable:        "worker",
+		AckPolicy:      nats.AckExplicitPolicy,
+		FilterSubjects: []string{"orders.>"},
+	}
+	assert.Empty(t, diffConsumerConfig(actual, desired))
+
+	desired.MaxDeliver = 5
+	desired.DeliverPolicy = nats.DeliverNewPolicy
+	assert.Equal(t, []FieldChange{
+		{Field: "DeliverPolicy", From: "all", To: "new", InPlace: false},
+		{Field: "MaxDeliver", From: "-1", To: "5", InPlace: true},
+	}, diffConsumerConfig(actual, desired))
+}
+
+func TestMigrationPlanNotInPlaceErr(t *testing.T) {
+	plan := &MigrationPlan{Changes: []MigrationChange{
+		{Action: MigrationCreate, Stream: "payments"},
+		{Action: MigrationUpdate, Stream: "orders", Fields: []FieldChange{
+			{Field: "MaxAge", From: "0s", To: "1h0m0s", InPlace: true},
+		}},
+	}}
+	assert.NoError(t, plan.notInPlaceErr())
+
+	plan.Changes = append(plan.Changes, MigrationChange{Action: MigrationUpdate, Stream: "orders", Fields: []FieldChange{
+		{Field: "Storage", From: "File", To: "Memory"},
+	}})
+	assert.ErrorIs(t, plan.notInPlaceErr(), ErrChangeNotInPlace)
+	assert.ErrorContains(t, plan.notInPlaceErr(), "orders Storage (File -> Memory)")
+}
+
+func TestConsumerConfigValidate(t *testing.T) {
+	assert.NoError(t, ConsumerConfig{Stream: "orders", ConsumerConfig: nats.ConsumerConfig{Durable: "worker"}}.validate())
+	assert.ErrorIs(t, ConsumerConfig{ConsumerConfig: nats.ConsumerConfig{Durable: "worker"}}.validate(), ErrInvalidConsumerConfig)
+	assert.ErrorIs(t, ConsumerConfig{Stream: "orders"}.validate(), ErrInvalidConsumerConfig)
+	assert.ErrorIs(t, ConsumerConfig{Stream: "orders", ConsumerConfig: nats.ConsumerConfig{Durable: "worker", Name: "other"}}.validate(), ErrInvalidConsumerConfig)
+}
+
+func TestManagedMetadata(t *testing.T) {
+	// undeclared metadata keeps the server's value
+	assert.Equal(t, map[string]string{"team": "billing", ManagedMetadataKey: "true"},
+		managedMetadata(nil, map[string]string{"team": "billing", "_nats.ver": "2.11.0"}))
+
+	declared := map[string]string{"team": "orders"}
+	assert.Equal(t, map[string]string{"team": "orders", ManagedMetadataKey: "true"},
+		managedMetadata(declared, map[string]string{"team": "billing"}))
+	assert.Equal(t, map[string]string{"team": "orders"}, declared)
+
+	assert.True(t, isManaged(managedMetadata(nil, nil)))
+	assert.False(t, isManaged(map[string]string{"team": "orders"}))
+}
@@ -7,20 +7,26 @@ import (
 	"github.com/nats-io/nats.go"
 	"github.com/nats-io/nats.go/jetstream"
 	"github.com/vectrum-io/strongforce/pkg/bus"
+	"github.com/vectrum-io/strongforce/pkg/events"
 	"github.com/vectrum-io/strongforce/pkg/serialization"
 	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"sync"
 	"time"
 )
 
 type Subscriber struct {
 	jetStream      jetstream.JetStream
 	conn           *nats.Conn
+	ownsConn       bool
 	otelPropagator propagation.TextMapPropagator
-	natsVersion    *version.Version
 }
 
 type SubscriberOptions struct {
-	NATSAddress    string
+	NATSAddress string
+	// Conn is used instead of connecting to NATSAddress. Close leaves it
+	// open.
+	Conn           *nats.Conn
 	OTelPropagator propagation.TextMapPropagator
 }
 
@@ -44,6 +50,21 @@ type SubscribeOpts struct {
 	// AckWait overrides JetStream's per-message AckWait (default 30 s on the
 	// server). Zero leaves the server default in place.
 	AckWait time.Duration
+	// DeadLetterSubject receives messages whose final delivery failed, using
+	// DeadLetterPublish. Empty disables dead-lettering.
+	DeadLetterSubject string
+	DeadLetterPublish bus.PublishFunc
+	RetryPolicy       bus.RetryPolicy
+	RoutingMode       bus.RoutingMode
+	// HeartbeatInterval and MaxHandlerDuration configure in-progress
+	// heartbeats for long-running handlers. Zero disables them.
+	HeartbeatInterval  time.Duration
+	MaxHandlerDuration time.Duration
+	// TracerProvider creates a process span around every handler invocation.
+	// Nil disables spans.
+	TracerProvider trace.TracerProvider
+	// Metrics records delivery and handler metrics. Nil disables them.
+	Metrics *bus.Metrics
 }
 
 func (so *SubscribeOpts) validate(natsVersion *version.Version) error {
@@ -68,6 +89,17 @@ func (so *SubscribeOpts) validate(natsVersion *version.Version) error {
 		so.Deserializer = serialization.NewProtobufSerializer()
 	}
 
+	// named wildcards are a bus extension NATS does not understand
+	filterSubjects := make([]string, len(so.FilterSubjects))
+	for i, filterSubject := range so.FilterSubjects {
+		filterSubjects[i] = bus.SubjectFilter(filterSubject)
+	}
+	so.FilterSubjects = filterSubjects
+
+	if so.DeadLetterSubject != "" && so.DeadLetterPublish == nil {
+		return fmt.Errorf("dead letter subject %s requires a publish func", so.DeadLetterSubject)
+	}
+
 	// only nats >= 2.10 supports multiple filter subjects
 	if natsVersion.LessThan(version.Must(version.NewVersion("2.10.0"))) {
 		if len(so.FilterSubjects) > 1 {
@@ -101,11 +133,15 @@ func (so *SubscribeBroadcastOpts) validate() error {
 }
 
 func NewSubscriber(opts *SubscriberOptions) (*Subscriber, error) {
-	nc, err := nats.Connect(
-		opts.NATSAddress,
-	)
-	if err != nil {
-		return nil, err
+	nc := opts.Conn
+	if nc == nil {
+		var err error
+		nc, err = nats.Connect(
+			opts.NATSAddress,
+		)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	js, err := jetstream.New(nc)
@@ -113,19 +149,41 @@ func NewSubscriber(opts *SubscriberOptions) (*Subscriber, error) {
 		return nil, err
 	}
 
-	natsVersion, err := version.NewVersion(nc.ConnectedServerVersion())
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse nats version: %w", err)
-	}
-
 	return &Subscriber{
 		jetStream:      js,
 		conn:           nc,
+		ownsConn:       opts.Conn == nil,
 		otelPropagator: opts.OTelPropagator,
-		natsVersion:    natsVersion,
 	}, nil
 }
 
+// serverVersion returns the version of the server the connection is
+// currently connected to. It is resolved on every call, because a connection
+// that retries its initial connect has no server yet, and a reconnect can
+// land on a server with another version.
+func (ns *Subscriber) serverVersion() (*version.Version, error) {
+	serverVersion := ns.conn.ConnectedServerVersion()
+	if serverVersion == "" {
+		return nil, fmt.Errorf("failed to get nats version: %w", nats.ErrDisconnected)
+	}
+
+	natsVersion, err := version.NewVersion(serverVersion)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse nats version: %w", err)
+	}
+
+	return natsVersion, nil
+}
+
+// Close closes the connection unless it was passed in as
+// SubscriberOptions.Conn. Drain subscriptions before closing to settle their
+// in-flight messages.
+func (ns *Subscriber) Close() {
+	if ns.ownsConn {
+		ns.conn.Close()
+	}
+}
+
 func (ns *Subscriber) SubscribeBroadcast(ctx context.Context, subject string, opts *SubscribeBroadcastOpts) (*bus.Subscription, error) {
 	if opts == nil {
 		opts = &SubscribeBroadcastOpts{}
@@ -136,9 +194,10 @@ func (ns *Subscriber) SubscribeBroadcast(ctx context.Context, subject string, op
 	}
 
 	msgChan := make(chan bus.InboundMessage, opts.MessageBuffer)
+	handoff := newHandoff(msgChan)
 
 	subscription, err := ns.conn.Subscribe(subject, func(msg *nats.Msg) {
-		ns.handleNATSMessage(ctx, msg, msgChan)
+		ns.handleNATSMessage(ctx, msg, handoff)
 	})
 	if err != nil {
 		return nil, err
@@ -149,6 +208,7 @@ func (ns *Subscriber) SubscribeBroadcast(ctx context.Context, subject string, op
 	// callers historically expected sequential handling and they aren't the
 	// throughput-critical path.
 	return bus.NewSubscription(msgChan, 1, opts.Deserializer, func() {
+		handoff.stop()
 		_ = subscription.Drain()
 		_ = subscription.Unsubscribe()
 	}), nil
@@ -159,7 +219,12 @@ func (ns *Subscriber) Subscribe(ctx context.Context, streamName string, opts *Su
 		opts = &SubscribeOpts{}
 	}
 
-	if err := opts.validate(ns.natsVersion); err != nil {
+	natsVersion, err := ns.serverVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := opts.validate(natsVersion); err != nil {
 		return nil, fmt.Errorf("failed to validate options: %w", err)
 	}
 
@@ -197,49 +262,167 @@ func (ns *Subscriber) Subscribe(ctx context.Context, streamName string, opts *Su
 		consumer = newConsumer
 	}
 
+	handoff := newHandoff(msgChan)
 	consumeCtx, err := consumer.Consume(func(msg jetstream.Msg) {
-		ns.handleJetStreamMessage(ctx, msg, msgChan)
+		ns.handleJetStreamMessage(ctx, msg, handoff)
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	return bus.NewSubscription(msgChan, opts.Concurrency, opts.Deserializer, func() {
+	subscription := bus.NewSubscription(msgChan, opts.Concurrency, opts.Deserializer, func() {
+		handoff.stop()
 		consumeCtx.Stop()
-	}), nil
+	})
+
+	subscription.SetMaxDeliveries(opts.MaxDeliverTries)
+
+	if opts.DeadLetterSubject != "" {
+		subscription.EnableDeadLetter(opts.DeadLetterSubject, opts.MaxDeliverTries, opts.DeadLetterPublish)
+	}
+
+	if opts.RetryPolicy != nil {
+		subscription.SetRetryPolicy(opts.RetryPolicy)
+	}
+
+	if opts.HeartbeatInterval > 0 || opts.MaxHandlerDuration > 0 {
+		subscription.SetHeartbeat(opts.HeartbeatInterval, opts.MaxHandlerDuration)
+	}
+
+	subscription.SetRoutingMode(opts.RoutingMode)
+
+	if opts.TracerProvider != nil {
+		subscription.SetTracerProvider(opts.TracerProvider, messagingSystem)
+	}
+
+	if opts.Metrics != nil {
+		subscription.SetMetrics(opts.Metrics)
+	}
+
+	return subscription, nil
 }
 
-func (ns *Subscriber) handleNATSMessage(parentCtx context.Context, msg *nats.Msg, msgChan chan bus.InboundMessage) {
-	msgChan <- bus.InboundMessage{
-		MessageCtx: ns.getMessageCtx(parentCtx, msg.Header),
-		Id:         msg.Header.Get(nats.MsgIdHdr),
-		Subject:    msg.Subject,
-		Data:       msg.Data,
+func (ns *Subscriber) handleNATSMessage(parentCtx context.Context, msg *nats.Msg, handoff *handoff) {
+	handoff.send(bus.InboundMessage{
+		MessageCtx:    ns.getMessageCtx(parentCtx, msg.Header),
+		Id:            messageId(msg.Header),
+		Subject:       msg.Subject,
+		Data:          msg.Data,
+		CausationId:   msg.Header.Get(bus.CausationIdHeader),
+		CorrelationId: msg.Header.Get(bus.CorrelationIdHeader),
 		Ack: func() error {
 			return msg.Ack()
 		},
 		Nak: func(delay time.Duration) error {
 			return msg.NakWithDelay(delay)
 		},
-	}
+		Term: func() error {
+			return msg.Term()
+		},
+		InProgress: func() error {
+			return msg.InProgress()
+		},
+	})
 }
 
-func (ns *Subscriber) handleJetStreamMessage(parentCtx context.Context, msg jetstream.Msg, msgChan chan bus.InboundMessage) {
-	msgChan <- bus.InboundMessage{
-		MessageCtx: ns.getMessageCtx(parentCtx, msg.Headers()),
-		Id:         msg.Headers().Get(jetstream.MsgIDHeader),
-		Subject:    msg.Subject(),
-		Data:       msg.Data(),
+func (ns *Subscriber) handleJetStreamMessage(parentCtx context.Context, msg jetstream.Msg, handoff *handoff) {
+	// Metadata only fails for messages without a JetStream reply subject,
+	// which a consumer never delivers; fall back to zero delivery info.
+	metadata, err := msg.Metadata()
+	if err != nil {
+		metadata = &jetstream.MsgMetadata{}
+	}
+
+	handoff.send(bus.InboundMessage{
+		MessageCtx:     ns.getMessageCtx(parentCtx, msg.Headers()),
+		Id:             messageId(msg.Headers()),
+		Subject:        msg.Subject(),
+		Data:           msg.Data(),
+		CausationId:    msg.Headers().Get(bus.CausationIdHeader),
+		CorrelationId:  msg.Headers().Get(bus.CorrelationIdHeader),
+		Stream:         metadata.Stream,
+		Consumer:       metadata.Consumer,
+		StreamSequence: metadata.Sequence.Stream,
+		NumDelivered:   metadata.NumDelivered,
 		Ack: func() error {
 			return msg.Ack()
 		},
 		Nak: func(delay time.Duration) error {
 			return msg.NakWithDelay(delay)
 		},
+		Term: func() error {
+			return msg.Term()
+		},
+		InProgress: func() error {
+			return msg.InProgress()
+		},
+	})
+}
+
+// handoff passes messages from NATS callbacks to a subscription's buffer.
+// Once the subscription is stopped, callbacks blocked on a full buffer return
+// instead of leaking, and nak their message so it is redelivered right away
+// rather than after AckWait; the subscription's drain has already nakked the
+// buffer by then.
+type handoff struct {
+	messages chan bus.InboundMessage
+	stopped  chan struct{}
+	stopOnce sync.Once
+}
+
+func newHandoff(messages chan bus.InboundMessage) *handoff {
+	return &handoff{
+		messages: messages,
+		stopped:  make(chan struct{}),
+	}
+}
+
+func (h *handoff) send(message bus.InboundMessage) {
+	select {
+	case <-h.stopped:
+		h.reject(message)
+		return
+	default:
+	}
+
+	select {
+	case h.messages <- message:
+	case <-h.stopped:
+		h.reject(message)
+	}
+}
+
+func (h *handoff) stop() {
+	h.stopOnce.Do(func() {
+		close(h.stopped)
+	})
+}
+
+// reject naks a message that arrived after the subscription stopped. Core
+// NATS messages cannot be nakked, so the error is ignored.
+func (h *handoff) reject(message bus.InboundMessage) {
+	if message.Nak != nil {
+		_ = message.Nak(0)
 	}
 }
 
+// messageId returns the id of a message, which is the id of the original
+// message for redriven ones.
+func messageId(header nats.Header) string {
+	if id := header.Get(bus.OriginalMessageIdHeader); id != "" {
+		return id
+	}
+	return header.Get(nats.MsgIdHdr)
+}
+
+// getMessageCtx derives the handler ctx for a message: it carries the
+// message's id and correlation id so events emitted by the handler are linked
+// to it, plus the producer's trace context when a propagator is configured.
 func (ns *Subscriber) getMessageCtx(ctx context.Context, header nats.Header) context.Context {
+	if id := header.Get(nats.MsgIdHdr); id != "" {
+		ctx = events.ContextWithCause(ctx, id, header.Get(bus.CorrelationIdHeader))
+	}
+
 	if ns.otelPropagator == nil {
 		return ctx
 	}
@@ -0,0 +1,70 @@
+package nats
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/vectrum-io/strongforce/pkg/bus"
+)
+
+func TestHandoffNaksAfterStop(t *testing.T) {
+	h := newHandoff(make(chan bus.InboundMessage, 1))
+
+	nakked := make(chan time.Duration, 2)
+	message := bus.InboundMessage{Nak: func(delay time.Duration) error {
+		nakked <- delay
+		return nil
+	}}
+
+	h.send(message)
+	assert.Len(t, h.messages, 1)
+
+	// the buffer is full, so the send blocks until the subscription stops
+	blocked := make(chan struct{})
+	go func() {
+		h.send(message)
+		close(blocked)
+	}()
+
+	h.stop()
+	select {
+	case <-blocked:
+	case <-time.After(time.Second):
+		assert.Fail(t, "send still blocked after stop")
+		return
+	}
+	assert.Equal(t, time.Duration(0), <-nakked)
+
+	h.send(message)
+	assert.Equal(t, time.Duration(0), <-nakked)
+	assert.Len(t, h.messages, 1)
+}
+
+func TestSubscriberResolvesVersionOnSubscribe(t *testing.T) {
+	// nothing listens on the port, so the connection keeps retrying
+	conn, err := nats.Connect("nats://127.0.0.1:1", nats.RetryOnFailedConnect(true), nats.ReconnectWait(time.Hour))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+
+	subscriber, err := NewSubscriber(&SubscriberOptions{Conn: conn})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = subscriber.Subscribe(context.Background(), "stream", &SubscribeOpts{})
+	assert.ErrorIs(t, err, nats.ErrDisconnected)
+}
+
+func TestMessageIdPrefersOriginalId(t *testing.T) {
+	header := nats.Header{}
+	header.Set(nats.MsgIdHdr, "1-redrive-7")
+	assert.Equal(t, "1-redrive-7", messageId(header))
+
+	header.Set(bus.OriginalMessageIdHeader, "1")
+	assert.Equal(t, "1", messageId(header))
+}
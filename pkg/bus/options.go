@@ -39,6 +39,22 @@ type SubscriptionOptions struct {
 	// 30 s — e.g. a probe with a long timeout — to prevent JetStream from
 	// redelivering a message that's still being processed.
 	AckWait time.Duration
+	// DeadLetterSubject receives messages whose final delivery attempt (see
+	// MaxDeliveryTries) failed. Empty disables dead-lettering. The subject
+	// must be bound to a stream.
+	DeadLetterSubject string
+	// RetryPolicy naks failed messages with a delay based on the delivery
+	// attempt. Nil leaves them un-acked until AckWait expires.
+	RetryPolicy RetryPolicy
+	// HeartbeatInterval is how often a running handler's message is marked
+	// in progress. Zero disables heartbeats.
+	HeartbeatInterval time.Duration
+	// MaxHandlerDuration cancels the handler ctx after this long. Zero means
+	// no limit.
+	MaxHandlerDuration time.Duration
+	// RoutingMode decides which handlers a message matching several patterns
+	// is routed to. The zero value is RouteFanOut.
+	RoutingMode RoutingMode
 }
 
 type DeliveryPolicy int
@@ -114,3 +130,44 @@ func WithDeserializer(deserializer serialization.Serializer) SubscribeOption {
 		options.Deserializer = deserializer
 	}
 }
+
+// WithDeadLetter republishes messages to subject after their final delivery
+// attempt failed or a handler returned a Permanent error, instead of letting
+// them silently stop being redelivered.
+// The dead-lettered message carries the original subject, stream sequence,
+// consumer, attempt count and last handler error as headers.
+func WithDeadLetter(subject string) SubscribeOption {
+	return func(options *SubscriptionOptions) {
+		options.DeadLetterSubject = subject
+	}
+}
+
+// WithRetryPolicy naks failed messages with a delay chosen by policy, so they
+// are redelivered without waiting for the full AckWait. Handlers can override
+// the delay for a single attempt by returning RetryAfter.
+func WithRetryPolicy(policy RetryPolicy) SubscribeOption {
+	return func(options *SubscriptionOptions) {
+		options.RetryPolicy = policy
+	}
+}
+
+// WithHeartbeat marks a message in progress every interval while its handler
+// runs, resetting the AckWait timer, and cancels the handler ctx after
+// maxHandlerDuration (zero means no limit). This allows a short AckWait for
+// fast failover while still supporting long-running handlers. interval must
+// be shorter than AckWait.
+func WithHeartbeat(interval time.Duration, maxHandlerDuration time.Duration) SubscribeOption {
+	return func(options *SubscriptionOptions) {
+		options.HeartbeatInterval = interval
+		options.MaxHandlerDuration = maxHandlerDuration
+	}
+}
+
+// WithRoutingMode decides which handlers a message matching several patterns
+// is routed to: all of them (RouteFanOut, the default), the earliest
+// registered (RouteFirstMatch) or the most specific (RouteMostSpecific).
+func WithRoutingMode(mode RoutingMode) SubscribeOption {
+	return func(options *SubscriptionOptions) {
+		options.RoutingMode = mode
+	}
+}
@@ -0,0 +1,49 @@
+package bus
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrMessageTerminated = errors.New("message terminated")
+)
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return fmt.Sprintf("permanent failure: %s", e.err.Error())
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks a handler error as one that will never succeed on retry,
+// such as an undecodable payload. The subscription terminates the message
+// immediately (or dead-letters it, when configured) instead of redelivering
+// it until MaxDeliveryTries is exhausted. When another handler of the same
+// message failed with a transient error, the message is retried instead.
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err or any error it wraps was marked Permanent.
+func IsPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
+
+// allPermanent reports whether every handler error was marked Permanent. A
+// message that also failed transiently in another handler is retried for that
+// handler's sake.
+func allPermanent(errs []error) bool {
+	for _, err := range errs {
+		if !IsPermanent(err) {
+			return false
+		}
+	}
+	return len(errs) > 0
+}
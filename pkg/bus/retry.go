@@ -0,0 +1,110 @@
+package bus
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// RetryPolicy decides how long a message whose handler failed waits before
+// JetStream redelivers it.
+type RetryPolicy interface {
+	// RetryDelay returns the redelivery delay after the given delivery attempt
+	// failed. Attempts start at 1.
+	RetryDelay(attempt uint64) time.Duration
+}
+
+// FixedRetryPolicy redelivers after the same delay on every attempt.
+type FixedRetryPolicy struct {
+	Delay time.Duration
+}
+
+func (p FixedRetryPolicy) RetryDelay(uint64) time.Duration {
+	return p.Delay
+}
+
+// DefaultMaxRetryDelay caps ExponentialRetryPolicy delays when MaxDelay is
+// zero.
+const DefaultMaxRetryDelay = time.Hour
+
+// ExponentialRetryPolicy multiplies the delay on every attempt, starting at
+// InitialDelay and capped at MaxDelay. Jitter randomly shortens each delay by
+// up to that fraction (0 to 1) so messages that failed together do not retry
+// in lockstep.
+type ExponentialRetryPolicy struct {
+	InitialDelay time.Duration
+	// MaxDelay defaults to DefaultMaxRetryDelay when zero.
+	MaxDelay time.Duration
+	// Multiplier defaults to 2 when zero.
+	Multiplier float64
+	Jitter     float64
+}
+
+func (p ExponentialRetryPolicy) RetryDelay(attempt uint64) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+
+	if p.InitialDelay <= 0 {
+		return 0
+	}
+
+	multiplier := p.Multiplier
+	if multiplier == 0 {
+		multiplier = 2
+	}
+
+	maxDelay := p.MaxDelay
+	if maxDelay <= 0 {
+		maxDelay = DefaultMaxRetryDelay
+	}
+
+	// capped before the conversion, which overflows for large attempts
+	delay := float64(p.InitialDelay) * math.Pow(multiplier, float64(attempt-1))
+	if delay > float64(maxDelay) {
+		delay = float64(maxDelay)
+	}
+
+	if p.Jitter > 0 {
+		delay -= delay * math.Min(p.Jitter, 1) * rand.Float64()
+	}
+
+	return time.Duration(delay)
+}
+
+type retryAfterError struct {
+	delay time.Duration
+	err   error
+}
+
+func (e *retryAfterError) Error() string {
+	return fmt.Sprintf("retry after %s: %s", e.delay, e.err.Error())
+}
+
+func (e *retryAfterError) Unwrap() error {
+	return e.err
+}
+
+// RetryAfter wraps a handler error to request redelivery after d, overriding
+// the subscription's retry policy for this attempt.
+func RetryAfter(d time.Duration, err error) error {
+	return &retryAfterError{delay: d, err: err}
+}
+
+// retryDelay picks the redelivery delay for a failed message. An explicit
+// RetryAfter wins over the policy; ok is false when neither applies and the
+// message should wait for AckWait to expire.
+func retryDelay(policy RetryPolicy, message InboundMessage, handlerErr error) (delay time.Duration, ok bool) {
+	var retryAfter *retryAfterError
+	if errors.As(handlerErr, &retryAfter) {
+		return retryAfter.delay, true
+	}
+
+	if policy == nil {
+		return 0, false
+	}
+
+	return policy.RetryDelay(message.NumDelivered), true
+}
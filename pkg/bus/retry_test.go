@@ -0,0 +1,80 @@
+package bus
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFixedRetryPolicy(t *testing.T) {
+	policy := FixedRetryPolicy{Delay: time.Second}
+
+	assert.Equal(t, time.Second, policy.RetryDelay(1))
+	assert.Equal(t, time.Second, policy.RetryDelay(10))
+}
+
+func TestExponentialRetryPolicy(t *testing.T) {
+	policy := ExponentialRetryPolicy{
+		InitialDelay: 100 * time.Millisecond,
+		MaxDelay:     time.Second,
+	}
+
+	tests := []struct {
+		attempt  uint64
+		expected time.Duration
+	}{
+		{0, 100 * time.Millisecond},
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		{50, time.Second},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, policy.RetryDelay(test.attempt))
+	}
+}
+
+func TestExponentialRetryPolicyLargeAttempt(t *testing.T) {
+	policy := ExponentialRetryPolicy{InitialDelay: time.Second}
+
+	// uncapped, 2^1999 seconds overflow a time.Duration
+	assert.Equal(t, DefaultMaxRetryDelay, policy.RetryDelay(2000))
+	assert.Equal(t, DefaultMaxRetryDelay, policy.RetryDelay(math.MaxUint64))
+
+	policy.MaxDelay = 10 * time.Minute
+	assert.Equal(t, 10*time.Minute, policy.RetryDelay(2000))
+
+	assert.Zero(t, ExponentialRetryPolicy{}.RetryDelay(2000))
+}
+
+func TestExponentialRetryPolicyJitter(t *testing.T) {
+	policy := ExponentialRetryPolicy{
+		InitialDelay: time.Second,
+		Jitter:       0.5,
+	}
+
+	for i := 0; i < 100; i++ {
+		delay := policy.RetryDelay(1)
+		assert.LessOrEqual(t, delay, time.Second)
+		assert.GreaterOrEqual(t, delay, 500*time.Millisecond)
+	}
+}
+
+func TestRetryAfterOverridesPolicy(t *testing.T) {
+	handlerErr := errors.New("dummy")
+	err := RetryAfter(5*time.Second, handlerErr)
+	assert.ErrorIs(t, err, handlerErr)
+
+	delay, ok := retryDelay(FixedRetryPolicy{Delay: time.Second}, InboundMessage{NumDelivered: 1}, errors.Join(err))
+	assert.True(t, ok)
+	assert.Equal(t, 5*time.Second, delay)
+
+	_, ok = retryDelay(nil, InboundMessage{NumDelivered: 1}, handlerErr)
+	assert.False(t, ok)
+}
@@ -0,0 +1,228 @@
+package bus
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// routerCacheSize bounds the number of subjects whose matches are cached.
+// Subjects often embed entity ids, so the cache evicts an arbitrary entry
+// once full rather than growing without bound.
+const routerCacheSize = 1024
+
+// router matches subjects against handler patterns using a token trie, so the
+// cost of a lookup depends on the subject's depth rather than on the number
+// of registered patterns. It is safe for concurrent use.
+type router struct {
+	mu   sync.RWMutex
+	root *routerNode
+	// seq numbers routes in registration order.
+	seq uint64
+
+	cacheMu sync.Mutex
+	cache   map[string][]route
+}
+
+type routerNode struct {
+	literals map[string]*routerNode
+	wildcard *routerNode
+	// routes end at this node; fullWildcardRoutes end in ">" below it.
+	routes             []route
+	fullWildcardRoutes []route
+}
+
+func newRouter() *router {
+	return &router{
+		root:  &routerNode{},
+		cache: make(map[string][]route),
+	}
+}
+
+// add registers handler for pattern. It returns false if pattern is already
+// registered.
+func (r *router) add(pattern string, handler HandlerFunc) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	node := r.root
+	tokens := strings.Split(pattern, ".")
+	for i, token := range tokens {
+		if token == ">" && i == len(tokens)-1 {
+			if indexOfRoute(node.fullWildcardRoutes, pattern) >= 0 {
+				return false
+			}
+
+			r.seq++
+			node.fullWildcardRoutes = append(node.fullWildcardRoutes, newRoute(pattern, handler, r.seq))
+			r.clearCache()
+			return true
+		}
+
+		node = node.child(token)
+	}
+
+	if indexOfRoute(node.routes, pattern) >= 0 {
+		return false
+	}
+
+	r.seq++
+	node.routes = append(node.routes, newRoute(pattern, handler, r.seq))
+	r.clearCache()
+	return true
+}
+
+// remove unregisters pattern. Removing an unknown pattern is a no-op.
+func (r *router) remove(pattern string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.root.remove(strings.Split(pattern, "."), pattern) {
+		r.clearCache()
+	}
+}
+
+// match returns the routes whose pattern matches subject, in registration
+// order. The returned slice is shared with the cache and must not be
+// modified.
+func (r *router) match(subject string) []route {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	r.cacheMu.Lock()
+	routes, ok := r.cache[subject]
+	r.cacheMu.Unlock()
+	if ok {
+		return routes
+	}
+
+	routes = r.root.match(strings.Split(subject, "."), nil)
+	sort.Slice(routes, func(i, j int) bool {
+		return routes[i].seq < routes[j].seq
+	})
+
+	// Stored while holding the read lock, so add and remove cannot clear the
+	// cache between the lookup and the store.
+	r.cacheMu.Lock()
+	if len(r.cache) >= routerCacheSize {
+		for subject := range r.cache {
+			delete(r.cache, subject)
+			break
+		}
+	}
+	r.cache[subject] = routes
+	r.cacheMu.Unlock()
+
+	return routes
+}
+
+// clearCache drops all cached matches. Callers must hold mu for writing.
+func (r *router) clearCache() {
+	r.cacheMu.Lock()
+	r.cache = make(map[string][]route)
+	r.cacheMu.Unlock()
+}
+
+func (n *routerNode) child(token string) *routerNode {
+	if isWildcardToken(token) {
+		if n.wildcard == nil {
+			n.wildcard = &routerNode{}
+		}
+		return n.wildcard
+	}
+
+	if n.literals == nil {
+		n.literals = make(map[string]*routerNode)
+	}
+
+	child, ok := n.literals[token]
+	if !ok {
+		child = &routerNode{}
+		n.literals[token] = child
+	}
+	return child
+}
+
+// match appends the routes below n matching the remaining subject tokens to
+// matched. Like MatchSubject, a trailing ">" also matches when no tokens are
+// left.
+func (n *routerNode) match(tokens []string, matched []route) []route {
+	matched = append(matched, n.fullWildcardRoutes...)
+
+	if len(tokens) == 0 {
+		return append(matched, n.routes...)
+	}
+
+	if child, ok := n.literals[tokens[0]]; ok {
+		matched = child.match(tokens[1:], matched)
+	}
+
+	if n.wildcard != nil {
+		matched = n.wildcard.match(tokens[1:], matched)
+	}
+
+	return matched
+}
+
+// remove deletes pattern from the subtree and reports whether it was found.
+// Nodes left empty are pruned.
+func (n *routerNode) remove(tokens []string, pattern string) bool {
+	if len(tokens) == 1 && tokens[0] == ">" {
+		return removeRoute(&n.fullWildcardRoutes, pattern)
+	}
+
+	if len(tokens) == 0 {
+		return removeRoute(&n.routes, pattern)
+	}
+
+	var child *routerNode
+	if isWildcardToken(tokens[0]) {
+		child = n.wildcard
+	} else {
+		child = n.literals[tokens[0]]
+	}
+
+	if child == nil || !child.remove(tokens[1:], pattern) {
+		return false
+	}
+
+	if child.isEmpty() {
+		if isWildcardToken(tokens[0]) {
+			n.wildcard = nil
+		} else {
+			delete(n.literals, tokens[0])
+		}
+	}
+
+	return true
+}
+
+func (n *routerNode) isEmpty() bool {
+	return len(n.literals) == 0 && n.wildcard == nil && len(n.routes) == 0 && len(n.fullWildcardRoutes) == 0
+}
+
+func indexOfRoute(routes []route, pattern string) int {
+	for i, r := range routes {
+		if r.pattern == pattern {
+			return i
+		}
+	}
+	return -1
+}
+
+func removeRoute(routes *[]route, pattern string) bool {
+	i := indexOfRoute(*routes, pattern)
+	if i < 0 {
+		return false
+	}
+
+	*routes = append((*routes)[:i:i], (*routes)[i+1:]...)
+	return true
+}
+
+// isWildcardToken reports whether token matches any single subject token:
+// "*" or a named wildcard.
+func isWildcardToken(token string) bool {
+	_, isParam := paramName(token)
+	return token == "*" || isParam
+}
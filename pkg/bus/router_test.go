@@ -0,0 +1,132 @@
+package bus
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var routerTestPatterns = []string{
+	">", "orders.>", "orders.*", "orders.created", "orders.*.created", "orders.eu.*",
+	"*.created", "*.*", "*.*.*", "users.>", "users.eu.1.updated", "orders",
+	"orders.{region}.created", "users.{region}.{id}.updated",
+}
+
+var routerTestSubjects = []string{
+	"orders", "orders.created", "orders.eu", "orders.eu.created", "orders.us.created",
+	"users", "users.eu.1.updated", "payments.created", "a.b.c.d", "",
+}
+
+func TestRouterMatchesLikeMatchSubject(t *testing.T) {
+	r := newRouter()
+	for _, pattern := range routerTestPatterns {
+		assert.True(t, r.add(pattern, nil))
+	}
+
+	for _, subject := range routerTestSubjects {
+		var expected []string
+		for _, pattern := range routerTestPatterns {
+			if MatchSubject(subject, pattern) {
+				expected = append(expected, pattern)
+			}
+		}
+
+		// the second lookup is served from the cache
+		for i := 0; i < 2; i++ {
+			var actual []string
+			for _, route := range r.match(subject) {
+				actual = append(actual, route.pattern)
+			}
+			assert.Equal(t, expected, actual, "subject %q", subject)
+		}
+	}
+}
+
+func TestRouterAddAndRemove(t *testing.T) {
+	r := newRouter()
+
+	assert.True(t, r.add("orders.*", nil))
+	assert.False(t, r.add("orders.*", nil))
+	assert.True(t, r.add("orders.>", nil))
+	assert.Len(t, r.match("orders.created"), 2)
+
+	r.remove("orders.*")
+	assert.Len(t, r.match("orders.created"), 1)
+
+	r.remove("orders.>")
+	r.remove("unknown.pattern")
+	assert.Empty(t, r.match("orders.created"))
+	assert.True(t, r.root.isEmpty())
+
+	assert.True(t, r.add("orders.*", nil))
+}
+
+func TestRouterConcurrentUse(t *testing.T) {
+	r := newRouter()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			pattern := fmt.Sprintf("orders.%d.*", i)
+			for j := 0; j < 100; j++ {
+				r.add(pattern, nil)
+				r.match(fmt.Sprintf("orders.%d.created", i))
+				r.remove(pattern)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	assert.True(t, r.root.isEmpty())
+}
+
+func benchmarkPatterns(n int) []string {
+	patterns := make([]string, 0, n)
+	for i := 0; len(patterns) < n; i++ {
+		patterns = append(patterns,
+			fmt.Sprintf("service%d.*.created", i),
+			fmt.Sprintf("service%d.orders.>", i),
+			fmt.Sprintf("service%d.orders.updated", i),
+		)
+	}
+	return patterns[:n]
+}
+
+func BenchmarkMatchSubjectLinear(b *testing.B) {
+	for _, n := range []int{10, 100, 1000} {
+		patterns := benchmarkPatterns(n)
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				for _, pattern := range patterns {
+					MatchSubject("service7.orders.created", pattern)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkRouterMatch(b *testing.B) {
+	for _, n := range []int{10, 100, 1000} {
+		r := newRouter()
+		for _, pattern := range benchmarkPatterns(n) {
+			r.add(pattern, nil)
+		}
+
+		b.Run(fmt.Sprintf("%d/cached", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				r.match("service7.orders.created")
+			}
+		})
+
+		b.Run(fmt.Sprintf("%d/uncached", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				r.clearCache()
+				r.match("service7.orders.created")
+			}
+		})
+	}
+}
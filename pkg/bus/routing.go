@@ -0,0 +1,239 @@
+package bus
+
+import (
+	"container/list"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RoutingMode decides which of the handlers matching a message's subject are
+// invoked.
+type RoutingMode int
+
+const (
+	// RouteFanOut invokes every matching handler in registration order. A
+	// handler that succeeded is not invoked again when the message is
+	// redelivered because another handler failed.
+	RouteFanOut RoutingMode = iota
+	// RouteFirstMatch invokes only the earliest registered matching handler.
+	RouteFirstMatch
+	// RouteMostSpecific invokes only the matching handler with the most
+	// specific pattern: at the first token where patterns differ, a literal
+	// beats "*" and "*" beats ">". Ties go to the earliest registered handler.
+	RouteMostSpecific
+)
+
+type route struct {
+	pattern string
+	handler HandlerFunc
+	seq     uint64
+	params  []routeParam
+}
+
+// routeParam is a named wildcard and its token position in the pattern.
+type routeParam struct {
+	index int
+	name  string
+}
+
+func newRoute(pattern string, handler HandlerFunc, seq uint64) route {
+	r := route{pattern: pattern, handler: handler, seq: seq}
+	for i, token := range strings.Split(pattern, ".") {
+		if name, ok := paramName(token); ok {
+			r.params = append(r.params, routeParam{index: i, name: name})
+		}
+	}
+	return r
+}
+
+// extractParams returns the values the route's named wildcards capture from
+// subject, or nil if the pattern has none.
+func (r route) extractParams(subject string) map[string]string {
+	if len(r.params) == 0 {
+		return nil
+	}
+
+	tokens := strings.Split(subject, ".")
+	params := make(map[string]string, len(r.params))
+	for _, param := range r.params {
+		if param.index < len(tokens) {
+			params[param.name] = tokens[param.index]
+		}
+	}
+	return params
+}
+
+// selectRoutes picks the routes to invoke under mode from matched, which must
+// be in registration order.
+func selectRoutes(matched []route, mode RoutingMode) []route {
+	if len(matched) == 0 {
+		return nil
+	}
+
+	switch mode {
+	case RouteFirstMatch:
+		return matched[:1]
+	case RouteMostSpecific:
+		best := matched[0]
+		for _, r := range matched[1:] {
+			if comparePatternSpecificity(r.pattern, best.pattern) > 0 {
+				best = r
+			}
+		}
+		return []route{best}
+	default:
+		return matched
+	}
+}
+
+// comparePatternSpecificity returns a positive number if a is more specific
+// than b, a negative number if it is less specific and zero if both are
+// equally specific.
+func comparePatternSpecificity(a, b string) int {
+	aTokens := strings.Split(a, ".")
+	bTokens := strings.Split(b, ".")
+
+	for i := 0; i < len(aTokens) && i < len(bTokens); i++ {
+		if diff := tokenSpecificity(aTokens[i]) - tokenSpecificity(bTokens[i]); diff != 0 {
+			return diff
+		}
+	}
+
+	return len(aTokens) - len(bTokens)
+}
+
+func tokenSpecificity(token string) int {
+	switch {
+	case token == ">":
+		return 0
+	case isWildcardToken(token):
+		return 1
+	default:
+		return 2
+	}
+}
+
+const (
+	// handledRoutesCapacity bounds the number of tracked messages. The least
+	// recently updated entry is evicted beyond it, which only makes its
+	// succeeded handlers run again on redelivery.
+	handledRoutesCapacity = 1024
+	// handledRoutesTTL expires entries of messages that are never redelivered
+	// to this instance.
+	handledRoutesTTL = time.Hour
+)
+
+// handledRoutes remembers which fan-out handlers already succeeded for a
+// message that is awaiting redelivery. Tracking is in-process: a redelivery
+// to another instance runs all handlers again. It is a bounded LRU cache
+// whose entries also expire after handledRoutesTTL.
+type handledRoutes struct {
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	// order holds *handledRoutesEntry values, most recently updated first.
+	order *list.List
+}
+
+type handledRoutesEntry struct {
+	key       string
+	patterns  map[string]struct{}
+	updatedAt time.Time
+}
+
+func newHandledRoutes() *handledRoutes {
+	return &handledRoutes{
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+func (h *handledRoutes) has(key string, pattern string) bool {
+	if key == "" {
+		return false
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	element, ok := h.entries[key]
+	if !ok {
+		return false
+	}
+
+	entry := element.Value.(*handledRoutesEntry)
+	if time.Since(entry.updatedAt) > handledRoutesTTL {
+		h.remove(element)
+		return false
+	}
+
+	_, ok = entry.patterns[pattern]
+	return ok
+}
+
+func (h *handledRoutes) add(key string, patterns []string) {
+	if key == "" || len(patterns) == 0 {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	element, ok := h.entries[key]
+	if ok {
+		h.order.MoveToFront(element)
+	} else {
+		element = h.order.PushFront(&handledRoutesEntry{
+			key:      key,
+			patterns: make(map[string]struct{}, len(patterns)),
+		})
+		h.entries[key] = element
+
+		if h.order.Len() > handledRoutesCapacity {
+			h.remove(h.order.Back())
+		}
+	}
+
+	entry := element.Value.(*handledRoutesEntry)
+	for _, pattern := range patterns {
+		entry.patterns[pattern] = struct{}{}
+	}
+	entry.updatedAt = time.Now()
+}
+
+func (h *handledRoutes) forget(key string) {
+	if key == "" {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if element, ok := h.entries[key]; ok {
+		h.remove(element)
+	}
+}
+
+func (h *handledRoutes) len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.order.Len()
+}
+
+// remove must be called with mu held.
+func (h *handledRoutes) remove(element *list.Element) {
+	h.order.Remove(element)
+	delete(h.entries, element.Value.(*handledRoutesEntry).key)
+}
+
+// deliveryKey identifies a message across redeliveries. JetStream messages are
+// keyed by stream sequence; other messages by id. Messages with neither are
+// not tracked.
+func deliveryKey(message InboundMessage) string {
+	if message.Stream != "" && message.StreamSequence != 0 {
+		return message.Stream + ":" + strconv.FormatUint(message.StreamSequence, 10)
+	}
+	return message.Id
+}
@@ -0,0 +1,153 @@
+package bus
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComparePatternSpecificity(t *testing.T) {
+	assert.Positive(t, comparePatternSpecificity("orders.created", "orders.*"))
+	assert.Positive(t, comparePatternSpecificity("orders.*", "orders.>"))
+	assert.Positive(t, comparePatternSpecificity("orders.*.created", "orders.>"))
+	assert.Negative(t, comparePatternSpecificity("*.created", "orders.*"))
+	assert.Zero(t, comparePatternSpecificity("orders.*", "orders.*"))
+	assert.Zero(t, comparePatternSpecificity("orders.{id}", "orders.*"))
+}
+
+func TestSelectRoutes(t *testing.T) {
+	r := newRouter()
+	for _, pattern := range []string{"orders.>", "orders.*", "orders.created", "users.>"} {
+		assert.True(t, r.add(pattern, nil))
+	}
+
+	patterns := func(routes []route) []string {
+		var result []string
+		for _, r := range routes {
+			result = append(result, r.pattern)
+		}
+		return result
+	}
+
+	assert.Equal(t, []string{"orders.>", "orders.*", "orders.created"}, patterns(selectRoutes(r.match("orders.created"), RouteFanOut)))
+	assert.Equal(t, []string{"orders.>"}, patterns(selectRoutes(r.match("orders.created"), RouteFirstMatch)))
+	assert.Equal(t, []string{"orders.created"}, patterns(selectRoutes(r.match("orders.created"), RouteMostSpecific)))
+	assert.Equal(t, []string{"orders.*"}, patterns(selectRoutes(r.match("orders.deleted"), RouteMostSpecific)))
+	assert.Empty(t, selectRoutes(r.match("payments.created"), RouteFanOut))
+}
+
+func TestFanOutSkipsSucceededHandlersOnRedelivery(t *testing.T) {
+	mockCtx := &mockContext{}
+	sub := NewSubscription(make(chan InboundMessage, 1), 1, nil, mockCtx.Stop)
+
+	var calls []string
+	failing := true
+	assert.NoError(t, sub.AddHandler("test.*", func(ctx context.Context, message InboundMessage) error {
+		calls = append(calls, "wildcard")
+		return nil
+	}))
+	assert.NoError(t, sub.AddHandler("test.a", func(ctx context.Context, message InboundMessage) error {
+		calls = append(calls, "literal")
+		if failing {
+			return fmt.Errorf("dummy")
+		}
+		return nil
+	}))
+
+	first := createMockMessage("1", "test.a")
+	sub.handleMessage(*first.msg)
+	first.AssertNotCalled(t, "Ack")
+
+	failing = false
+	redelivery := createMockMessage("1", "test.a")
+	redelivery.On("Ack").Once().Return(nil)
+	sub.handleMessage(*redelivery.msg)
+	redelivery.AssertExpectations(t)
+
+	assert.Equal(t, []string{"wildcard", "literal", "literal"}, calls)
+	assert.Zero(t, sub.handled.len())
+}
+
+func TestMostSpecificRoutingMode(t *testing.T) {
+	mockCtx := &mockContext{}
+	sub := NewSubscription(make(chan InboundMessage, 1), 1, nil, mockCtx.Stop)
+	sub.SetRoutingMode(RouteMostSpecific)
+
+	var calls []string
+	for _, pattern := range []string{"test.>", "test.a", "test.*"} {
+		pattern := pattern
+		assert.NoError(t, sub.AddHandler(pattern, func(ctx context.Context, message InboundMessage) error {
+			calls = append(calls, pattern)
+			return nil
+		}))
+	}
+
+	msg := createMockMessage("1", "test.a")
+	msg.On("Ack").Once().Return(nil)
+	sub.handleMessage(*msg.msg)
+
+	msg.AssertExpectations(t)
+	assert.Equal(t, []string{"test.a"}, calls)
+}
+
+func TestHandlerReceivesNamedParams(t *testing.T) {
+	mockCtx := &mockContext{}
+	sub := NewSubscription(make(chan InboundMessage, 1), 1, nil, mockCtx.Stop)
+
+	var params map[string]string
+	var id string
+	assert.NoError(t, sub.AddHandler("orders.{tenant}.{id}.created", func(ctx context.Context, message InboundMessage) error {
+		params = message.Params()
+		id = message.Param("id")
+		return nil
+	}))
+
+	msg := createMockMessage("1", "orders.eu.42.created")
+	msg.On("Ack").Once().Return(nil)
+	sub.handleMessage(*msg.msg)
+
+	msg.AssertExpectations(t)
+	assert.Equal(t, map[string]string{"tenant": "eu", "id": "42"}, params)
+	assert.Equal(t, "42", id)
+}
+
+func TestFanOutForgetsSucceededHandlersOnFinalDelivery(t *testing.T) {
+	mockCtx := &mockContext{}
+	sub := NewSubscription(make(chan InboundMessage, 1), 1, nil, mockCtx.Stop)
+	sub.SetMaxDeliveries(2)
+
+	assert.NoError(t, sub.AddHandler("test.*", func(ctx context.Context, message InboundMessage) error {
+		return nil
+	}))
+	assert.NoError(t, sub.AddHandler("test.a", func(ctx context.Context, message InboundMessage) error {
+		return fmt.Errorf("dummy")
+	}))
+
+	first := createMockMessage("1", "test.a")
+	first.msg.NumDelivered = 1
+	sub.handleMessage(*first.msg)
+	assert.Equal(t, 1, sub.handled.len())
+
+	final := createMockMessage("1", "test.a")
+	final.msg.NumDelivered = 2
+	sub.handleMessage(*final.msg)
+	assert.Zero(t, sub.handled.len())
+}
+
+func TestHandledRoutesEvictsLeastRecentlyUpdated(t *testing.T) {
+	handled := newHandledRoutes()
+	for i := 0; i <= handledRoutesCapacity; i++ {
+		handled.add(fmt.Sprint(i), []string{"test.*"})
+	}
+
+	assert.Equal(t, handledRoutesCapacity, handled.len())
+	assert.False(t, handled.has("0", "test.*"))
+	assert.True(t, handled.has("1", "test.*"))
+	assert.True(t, handled.has(fmt.Sprint(handledRoutesCapacity), "test.*"))
+
+	handled.forget("1")
+	assert.False(t, handled.has("1", "test.*"))
+	assert.Equal(t, handledRoutesCapacity-1, handled.len())
+}
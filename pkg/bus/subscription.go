@@ -4,10 +4,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"runtime/debug"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/vectrum-io/strongforce/pkg/serialization"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var (
@@ -23,12 +26,22 @@ type UnsubscribeFn func()
 type Subscription struct {
 	unsubscribe     UnsubscribeFn
 	inboundMessages chan InboundMessage
-	handlers        map[string]HandlerFunc
+	router          *router
 	handlersMu      sync.RWMutex
+	routingMode     RoutingMode
+	handled         *handledRoutes
 	onError         ErrorCallbackFunc
 	deserializer    serialization.Serializer
-	isRunning       bool
+	runningWorkers  atomic.Int32
+	workers         sync.WaitGroup
 	concurrency     int
+	deadLetter      *deadLetter
+	maxDeliveries   int
+	retryPolicy     RetryPolicy
+	heartbeat       *heartbeat
+	middleware      []Middleware
+	metrics         *Metrics
+	drain           *drain
 }
 
 // NewSubscription builds a subscription that dispatches inbound messages to
@@ -40,11 +53,14 @@ func NewSubscription(inboundMessages chan InboundMessage, concurrency int, deser
 	}
 	return &Subscription{
 		unsubscribe:     unsubscribe,
-		handlers:        make(map[string]HandlerFunc),
 		inboundMessages: inboundMessages,
+		router:          newRouter(),
 		handlersMu:      sync.RWMutex{},
 		deserializer:    deserializer,
 		concurrency:     concurrency,
+		middleware:      []Middleware{Recover()},
+		handled:         newHandledRoutes(),
+		drain:           newDrain(),
 	}
 }
 
@@ -54,110 +70,279 @@ func (s *Subscription) Stop() {
 	}
 }
 
+// IsRunning reports whether any worker is still handling messages.
 func (s *Subscription) IsRunning() bool {
-	return s.isRunning
+	return s.runningWorkers.Load() > 0
 }
 
 func (s *Subscription) OnError(errorFunc ErrorCallbackFunc) {
 	s.onError = errorFunc
 }
 
-func (s *Subscription) RemoveHandler(pattern string) {
+// SetRetryPolicy makes the subscription nak failed messages with a delay from
+// policy instead of leaving them to AckWait expiry. Bus implementations call
+// it when WithRetryPolicy is set. Handlers can still pick the delay themselves
+// by returning RetryAfter.
+func (s *Subscription) SetRetryPolicy(policy RetryPolicy) {
+	s.retryPolicy = policy
+}
+
+// SetMaxDeliveries tells the subscription after how many deliveries the bus
+// stops redelivering a message, so it can let go of the message's state on
+// its final failed attempt. Bus implementations call it with the consumer's
+// delivery limit; maxDeliveries <= 0 means unlimited.
+func (s *Subscription) SetMaxDeliveries(maxDeliveries int) {
+	s.maxDeliveries = maxDeliveries
+}
+
+// SetRoutingMode decides which matching handlers a message is routed to. The
+// default is RouteFanOut.
+func (s *Subscription) SetRoutingMode(mode RoutingMode) {
+	s.handlersMu.Lock()
+	s.routingMode = mode
+	s.handlersMu.Unlock()
+}
+
+// SetTracerProvider installs the Tracing middleware, creating a process span
+// around every handler invocation. attributes are added to every span. Bus
+// implementations call it when a TracerProvider is configured.
+func (s *Subscription) SetTracerProvider(tp trace.TracerProvider, attributes ...attribute.KeyValue) {
+	s.Use(Tracing(tp, attributes...))
+}
+
+// SetMetrics records received messages, acks, naks, routing failures and
+// in-flight workers into m, and installs the Instrument middleware for
+// handler duration, errors and panics. Bus implementations call it when a
+// MeterProvider is configured. Call it before Use so handler durations
+// include the other middleware.
+func (s *Subscription) SetMetrics(m *Metrics) {
+	s.metrics = m
+	s.Use(Instrument(m))
+}
+
+// Use appends middleware that wraps every handler of the subscription,
+// including handlers added before the call. Recover always runs outermost.
+func (s *Subscription) Use(middleware ...Middleware) {
 	s.handlersMu.Lock()
-	delete(s.handlers, pattern)
+	s.middleware = append(s.middleware, middleware...)
 	s.handlersMu.Unlock()
 }
 
+func (s *Subscription) RemoveHandler(pattern string) {
+	s.router.remove(pattern)
+}
+
+// AddHandler routes messages whose subject matches pattern to handlerFunc.
+// Besides the NATS wildcards "*" and ">", pattern may contain named wildcards
+// such as "orders.{tenant}.{id}.created", which match like "*" and whose
+// values are available from InboundMessage.Param.
 func (s *Subscription) AddHandler(pattern string, handlerFunc HandlerFunc) error {
 	if err := ValidatePattern(pattern); err != nil {
 		return fmt.Errorf("failed to validate pattern: %w", err)
 	}
 
-	s.handlersMu.Lock()
-	defer s.handlersMu.Unlock()
-
-	_, ok := s.handlers[pattern]
-	if ok {
+	if !s.router.add(pattern, handlerFunc) {
 		return fmt.Errorf("%w: handler already registered", ErrHandlerRegistrationFailed)
 	}
 
-	s.handlers[pattern] = handlerFunc
-
 	return nil
 }
 
 func (s *Subscription) Start(ctx context.Context) {
-	s.isRunning = true
-
 	// Spawn concurrency workers all racing on the same inboundMessages channel.
 	// Go's channel receive is the synchronisation point — each message goes to
 	// exactly one worker. When ctx ends every worker observes Done on its next
-	// iteration; isRunning flips on the first worker that returns.
+	// iteration, after finishing the message it is handling.
+	s.runningWorkers.Add(int32(s.concurrency))
+	s.workers.Add(s.concurrency)
 	for i := 0; i < s.concurrency; i++ {
 		go s.runWorker(ctx)
 	}
 }
 
 func (s *Subscription) runWorker(ctx context.Context) {
+	defer s.workers.Done()
+	defer s.runningWorkers.Add(-1)
+
 	for {
 		select {
 		case <-ctx.Done():
-			s.isRunning = false
+			return
+		case <-s.drain.started:
+			s.handleBuffered()
 			return
 		case message := <-s.inboundMessages:
-			s.handleMessage(message)
+			s.processMessage(message)
 		}
 	}
 }
 
+func (s *Subscription) processMessage(message InboundMessage) {
+	s.metrics.addInFlightWorkers(metricsCtx(message), message, 1)
+	s.handleMessage(message)
+	s.metrics.addInFlightWorkers(metricsCtx(message), message, -1)
+}
+
 func (s *Subscription) handleMessage(message InboundMessage) {
-	isMessageRouted := false
 	var handlerErrors []error
 
 	message.deserializer = s.deserializer
+	s.metrics.incReceived(metricsCtx(message), message)
 
+	// Handlers run on a snapshot so a slow handler does not block
+	// AddHandler, RemoveHandler or Use.
 	s.handlersMu.RLock()
-	for pattern, fn := range s.handlers {
-		if !MatchSubject(message.Subject, pattern) {
+	routingMode := s.routingMode
+	middleware := s.middleware
+	s.handlersMu.RUnlock()
+
+	routes := selectRoutes(s.router.match(message.Subject), routingMode)
+
+	if len(routes) == 0 {
+		s.metrics.incRoutingFailures(metricsCtx(message), message)
+		if s.onError != nil {
+			s.onError(fmt.Errorf("%w: %s", ErrMessageNotRoutable, message.Subject))
+		}
+		return
+	}
+
+	ctx, flight, ok := s.beginInFlight(message)
+	if !ok {
+		return
+	}
+	ctx, stopHeartbeat := s.startHeartbeat(ctx, message)
+
+	// Handlers that succeeded on an earlier delivery are skipped, so a
+	// failing handler does not make its siblings run twice.
+	key := deliveryKey(message)
+	var succeeded []string
+	for _, r := range routes {
+		if s.handled.has(key, r.pattern) {
 			continue
 		}
 
-		isMessageRouted = true
+		handlerMessage := message
+		handlerMessage.pattern = r.pattern
+		handlerMessage.params = r.extractParams(message.Subject)
 
-		if err := invokeHandler(message.MessageCtx, fn, message); err != nil {
+		if err := ChainMiddleware(r.handler, middleware...)(ctx, handlerMessage); err != nil {
 			handlerErrors = append(handlerErrors, err)
+			continue
 		}
+		succeeded = append(succeeded, r.pattern)
 	}
-	s.handlersMu.RUnlock()
 
-	if !isMessageRouted {
-		if s.onError != nil {
-			s.onError(fmt.Errorf("%w: %s", ErrMessageNotRoutable, message.Subject))
-		}
+	stopHeartbeat()
+
+	// an interrupted drain has already nakked the message
+	if !s.endInFlight(flight) {
 		return
 	}
 
 	if len(handlerErrors) > 0 {
+		handlerErr := errors.Join(handlerErrors...)
+		if allPermanent(handlerErrors) {
+			s.handled.forget(key)
+			if s.deadLetter != nil {
+				s.sendToDeadLetter(message, handlerErr)
+				return
+			}
+
+			s.terminate(message, handlerErr)
+			return
+		}
+
+		// the message is not redelivered after its final attempt
+		if s.isFinalDelivery(message) {
+			s.handled.forget(key)
+			if s.deadLetter != nil {
+				s.sendToDeadLetter(message, handlerErr)
+				return
+			}
+		} else {
+			s.handled.add(key, succeeded)
+		}
+
 		if s.onError != nil {
-			s.onError(fmt.Errorf("%w: %w", ErrMessageHandlerFailed, errors.Join(handlerErrors...)))
+			s.onError(fmt.Errorf("%w: %w", ErrMessageHandlerFailed, handlerErr))
+		}
+
+		if delay, ok := retryDelay(s.retryPolicy, message, handlerErr); ok {
+			s.nak(message, delay)
 		}
 		return
 	}
 
+	s.ack(message, "failed to ack message")
+}
+
+func (s *Subscription) ack(message InboundMessage, failureMessage string) {
 	if err := message.Ack(); err != nil {
 		if s.onError != nil {
-			s.onError(fmt.Errorf("%w: failed to ack message: %w", ErrMessageHandlerFailed, err))
+			s.onError(fmt.Errorf("%w: %s: %w", ErrMessageHandlerFailed, failureMessage, err))
+		}
+		return
+	}
+
+	s.handled.forget(deliveryKey(message))
+	s.metrics.incAcks(metricsCtx(message), message)
+}
+
+func (s *Subscription) nak(message InboundMessage, delay time.Duration) {
+	if err := message.Nak(delay); err != nil {
+		if s.onError != nil {
+			s.onError(fmt.Errorf("%w: failed to nak message: %w", ErrMessageHandlerFailed, err))
+		}
+		return
+	}
+
+	s.metrics.incNaks(metricsCtx(message), message)
+}
+
+// terminate stops redelivery of a message that failed permanently.
+func (s *Subscription) terminate(message InboundMessage, handlerErr error) {
+	if s.onError != nil {
+		s.onError(fmt.Errorf("%w: %w: %w", ErrMessageHandlerFailed, ErrMessageTerminated, handlerErr))
+	}
+
+	if err := message.Term(); err != nil {
+		if s.onError != nil {
+			s.onError(fmt.Errorf("%w: failed to terminate message: %w", ErrMessageHandlerFailed, err))
 		}
+		return
 	}
+
+	s.handled.forget(deliveryKey(message))
+	s.metrics.incTerms(metricsCtx(message), message)
 }
 
-// invokeHandler calls fn and converts a panic into an error.
-func invokeHandler(ctx context.Context, fn HandlerFunc, message InboundMessage) (err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			err = fmt.Errorf("handler panicked: %v\n%s", r, debug.Stack())
+// sendToDeadLetter republishes a message whose last delivery attempt failed,
+// or that failed permanently, and acks the original. If the publish fails the message is left un-acked;
+// JetStream will not redeliver it past MaxDeliver, so the failure is reported.
+func (s *Subscription) sendToDeadLetter(message InboundMessage, handlerErr error) {
+	if err := s.deadLetter.send(message, handlerErr); err != nil {
+		if s.onError != nil {
+			s.onError(fmt.Errorf("%w: failed to dead-letter message: %w: %w", ErrMessageHandlerFailed, err, handlerErr))
 		}
-	}()
+		return
+	}
+
+	if s.onError != nil {
+		s.onError(fmt.Errorf("%w: %w: %w", ErrMessageHandlerFailed, ErrMessageDeadLettered, handlerErr))
+	}
 
-	return fn(ctx, message)
+	s.ack(message, "failed to ack dead-lettered message")
+}
+
+func (s *Subscription) isFinalDelivery(message InboundMessage) bool {
+	return s.maxDeliveries > 0 && message.NumDelivered >= uint64(s.maxDeliveries)
+}
+
+// metricsCtx returns the message ctx, or Background for messages built
+// without one.
+func metricsCtx(message InboundMessage) context.Context {
+	if message.MessageCtx == nil {
+		return context.Background()
+	}
+	return message.MessageCtx
 }
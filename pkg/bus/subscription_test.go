@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -35,6 +38,12 @@ func (m *mockMessage) Nak(retryAfter time.Duration) error {
 	return args.Error(0)
 }
 
+func (m *mockMessage) Term() error {
+	args := m.Called()
+	m.processed = true
+	return args.Error(0)
+}
+
 func (m *mockMessage) WaitUntilProcessed() {
 	for {
 		if m.processed {
@@ -57,6 +66,7 @@ func createMockMessage(id string, subject string) *mockMessage {
 
 	msg.Ack = m.Ack
 	msg.Nak = m.Nak
+	msg.Term = m.Term
 
 	return m
 }
@@ -259,3 +269,302 @@ func TestErrorCallbackNotRoutable(t *testing.T) {
 
 	msg.AssertExpectations(t)
 }
+
+func TestDeadLetterOnFinalDelivery(t *testing.T) {
+	mockCtx := &mockContext{}
+	mockChan := make(chan InboundMessage, 1)
+	sub := NewSubscription(mockChan, 1, nil, mockCtx.Stop)
+
+	var published *OutboundMessage
+	sub.EnableDeadLetter("dlq.test", 3, func(ctx context.Context, message *OutboundMessage) error {
+		published = message
+		return nil
+	})
+
+	var capturedErr error
+	sub.OnError(func(err error) {
+		capturedErr = err
+	})
+
+	err := sub.AddHandler("test.*", func(ctx context.Context, message InboundMessage) error {
+		return fmt.Errorf("dummy\nerror")
+	})
+	assert.NoError(t, err)
+
+	msg := createMockMessage("1", "test.a")
+	msg.msg.Stream = "test"
+	msg.msg.Consumer = "consumer"
+	msg.msg.StreamSequence = 42
+	msg.msg.NumDelivered = 3
+	msg.On("Ack").Once().Return(nil)
+
+	sub.handleMessage(*msg.msg)
+
+	assert.ErrorIs(t, capturedErr, ErrMessageDeadLettered)
+	assert.NotNil(t, published)
+	assert.Equal(t, "dlq.test", published.Subject)
+	assert.Equal(t, "1-dlq", published.Id)
+	assert.Equal(t, "test.a", published.Headers[DeadLetterSubjectHeader])
+	assert.Equal(t, "test", published.Headers[DeadLetterStreamHeader])
+	assert.Equal(t, "42", published.Headers[DeadLetterSequenceHeader])
+	assert.Equal(t, "consumer", published.Headers[DeadLetterConsumerHeader])
+	assert.Equal(t, "3", published.Headers[DeadLetterAttemptsHeader])
+	assert.Equal(t, "dummy error", published.Headers[DeadLetterErrorHeader])
+	msg.AssertExpectations(t)
+}
+
+func TestDeadLetterSkippedBeforeFinalDelivery(t *testing.T) {
+	mockCtx := &mockContext{}
+	mockChan := make(chan InboundMessage, 1)
+	sub := NewSubscription(mockChan, 1, nil, mockCtx.Stop)
+
+	published := false
+	sub.EnableDeadLetter("dlq.test", 3, func(ctx context.Context, message *OutboundMessage) error {
+		published = true
+		return nil
+	})
+
+	err := sub.AddHandler("test.*", func(ctx context.Context, message InboundMessage) error {
+		return fmt.Errorf("dummy")
+	})
+	assert.NoError(t, err)
+
+	msg := createMockMessage("1", "test.a")
+	msg.msg.NumDelivered = 2
+
+	sub.handleMessage(*msg.msg)
+
+	assert.False(t, published)
+	msg.AssertNotCalled(t, "Ack")
+}
+
+func TestRetryPolicyNaksFailedMessage(t *testing.T) {
+	mockCtx := &mockContext{}
+	mockChan := make(chan InboundMessage, 1)
+	sub := NewSubscription(mockChan, 1, nil, mockCtx.Stop)
+	sub.SetRetryPolicy(ExponentialRetryPolicy{InitialDelay: time.Second})
+
+	err := sub.AddHandler("test.*", func(ctx context.Context, message InboundMessage) error {
+		return fmt.Errorf("dummy")
+	})
+	assert.NoError(t, err)
+
+	msg := createMockMessage("1", "test.a")
+	msg.msg.NumDelivered = 3
+	msg.On("Nak", 4*time.Second).Once().Return(nil)
+
+	sub.handleMessage(*msg.msg)
+
+	msg.AssertExpectations(t)
+	msg.AssertNotCalled(t, "Ack")
+}
+
+func TestRetryAfterNaksWithoutPolicy(t *testing.T) {
+	mockCtx := &mockContext{}
+	mockChan := make(chan InboundMessage, 1)
+	sub := NewSubscription(mockChan, 1, nil, mockCtx.Stop)
+
+	err := sub.AddHandler("test.*", func(ctx context.Context, message InboundMessage) error {
+		return RetryAfter(time.Minute, fmt.Errorf("dummy"))
+	})
+	assert.NoError(t, err)
+
+	msg := createMockMessage("1", "test.a")
+	msg.On("Nak", time.Minute).Once().Return(nil)
+
+	sub.handleMessage(*msg.msg)
+
+	msg.AssertExpectations(t)
+}
+
+func TestPermanentErrorTerminatesMessage(t *testing.T) {
+	mockCtx := &mockContext{}
+	mockChan := make(chan InboundMessage, 1)
+	sub := NewSubscription(mockChan, 1, nil, mockCtx.Stop)
+	sub.SetRetryPolicy(FixedRetryPolicy{Delay: time.Second})
+
+	var capturedErr error
+	sub.OnError(func(err error) {
+		capturedErr = err
+	})
+
+	err := sub.AddHandler("test.*", func(ctx context.Context, message InboundMessage) error {
+		return Permanent(fmt.Errorf("undecodable"))
+	})
+	assert.NoError(t, err)
+
+	msg := createMockMessage("1", "test.a")
+	msg.msg.NumDelivered = 1
+	msg.On("Term").Once().Return(nil)
+
+	sub.handleMessage(*msg.msg)
+
+	assert.ErrorIs(t, capturedErr, ErrMessageTerminated)
+	assert.True(t, IsPermanent(capturedErr))
+	msg.AssertExpectations(t)
+	msg.AssertNotCalled(t, "Nak", mock.Anything)
+	msg.AssertNotCalled(t, "Ack")
+}
+
+func TestPermanentErrorDeadLettersMessage(t *testing.T) {
+	mockCtx := &mockContext{}
+	mockChan := make(chan InboundMessage, 1)
+	sub := NewSubscription(mockChan, 1, nil, mockCtx.Stop)
+
+	published := false
+	sub.EnableDeadLetter("dlq.test", 10, func(ctx context.Context, message *OutboundMessage) error {
+		published = true
+		return nil
+	})
+
+	err := sub.AddHandler("test.*", func(ctx context.Context, message InboundMessage) error {
+		return Permanent(fmt.Errorf("undecodable"))
+	})
+	assert.NoError(t, err)
+
+	msg := createMockMessage("1", "test.a")
+	msg.msg.NumDelivered = 1
+	msg.On("Ack").Once().Return(nil)
+
+	sub.handleMessage(*msg.msg)
+
+	assert.True(t, published)
+	msg.AssertExpectations(t)
+	msg.AssertNotCalled(t, "Term")
+}
+
+func TestPermanentErrorRetriedForTransientSibling(t *testing.T) {
+	mockCtx := &mockContext{}
+	mockChan := make(chan InboundMessage, 1)
+	sub := NewSubscription(mockChan, 1, nil, mockCtx.Stop)
+	sub.SetRetryPolicy(FixedRetryPolicy{Delay: time.Second})
+
+	err := sub.AddHandler("test.*", func(ctx context.Context, message InboundMessage) error {
+		return Permanent(fmt.Errorf("undecodable"))
+	})
+	assert.NoError(t, err)
+	err = sub.AddHandler("test.a", func(ctx context.Context, message InboundMessage) error {
+		return fmt.Errorf("unavailable")
+	})
+	assert.NoError(t, err)
+
+	msg := createMockMessage("1", "test.a")
+	msg.msg.NumDelivered = 1
+	msg.On("Nak", time.Second).Once().Return(nil)
+
+	sub.handleMessage(*msg.msg)
+
+	msg.AssertExpectations(t)
+	msg.AssertNotCalled(t, "Term")
+}
+
+func TestHeartbeatMarksMessageInProgress(t *testing.T) {
+	mockCtx := &mockContext{}
+	mockChan := make(chan InboundMessage, 1)
+	sub := NewSubscription(mockChan, 1, nil, mockCtx.Stop)
+	sub.SetHeartbeat(5*time.Millisecond, 0)
+
+	var heartbeats atomic.Int32
+	err := sub.AddHandler("test.*", func(ctx context.Context, message InboundMessage) error {
+		time.Sleep(50 * time.Millisecond)
+		return nil
+	})
+	assert.NoError(t, err)
+
+	msg := createMockMessage("1", "test.a")
+	msg.msg.InProgress = func() error {
+		heartbeats.Add(1)
+		return nil
+	}
+	msg.On("Ack").Once().Return(nil)
+
+	sub.handleMessage(*msg.msg)
+
+	assert.Greater(t, heartbeats.Load(), int32(1))
+	msg.AssertExpectations(t)
+}
+
+func TestHeartbeatCancelsHandlerAfterMaxDuration(t *testing.T) {
+	mockCtx := &mockContext{}
+	mockChan := make(chan InboundMessage, 1)
+	sub := NewSubscription(mockChan, 1, nil, mockCtx.Stop)
+	sub.SetHeartbeat(0, 10*time.Millisecond)
+
+	var capturedErr error
+	sub.OnError(func(err error) {
+		capturedErr = err
+	})
+
+	err := sub.AddHandler("test.*", func(ctx context.Context, message InboundMessage) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	assert.NoError(t, err)
+
+	msg := createMockMessage("1", "test.a")
+
+	sub.handleMessage(*msg.msg)
+
+	assert.ErrorIs(t, capturedErr, context.DeadlineExceeded)
+	msg.AssertNotCalled(t, "Ack")
+}
+
+func TestSubscriptionMetrics(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	metrics, err := NewMetrics(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	assert.NoError(t, err)
+
+	mockCtx := &mockContext{}
+	sub := NewSubscription(make(chan InboundMessage, 1), 1, nil, mockCtx.Stop)
+	sub.SetMetrics(metrics)
+	sub.SetRetryPolicy(FixedRetryPolicy{Delay: time.Second})
+
+	var pattern string
+	err = sub.AddHandler("test.*", func(ctx context.Context, message InboundMessage) error {
+		pattern = message.Pattern()
+		if message.Id == "fail" {
+			return fmt.Errorf("dummy")
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+
+	acked := createMockMessage("ok", "test.a")
+	acked.On("Ack").Once().Return(nil)
+	nakked := createMockMessage("fail", "test.a")
+	nakked.On("Nak", time.Second).Once().Return(nil)
+	unroutable := createMockMessage("other", "other.a")
+
+	sub.handleMessage(*acked.msg)
+	sub.handleMessage(*nakked.msg)
+	sub.handleMessage(*unroutable.msg)
+
+	assert.Equal(t, "test.*", pattern)
+
+	var rm metricdata.ResourceMetrics
+	assert.NoError(t, reader.Collect(context.Background(), &rm))
+
+	sums := map[string]int64{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if sum, ok := m.Data.(metricdata.Sum[int64]); ok {
+				for _, dp := range sum.DataPoints {
+					sums[m.Name] += dp.Value
+				}
+			}
+			if m.Name == "strongforce.bus.handler.duration" {
+				for _, dp := range m.Data.(metricdata.Histogram[float64]).DataPoints {
+					value, ok := dp.Attributes.Value("pattern")
+					assert.True(t, ok)
+					assert.Equal(t, "test.*", value.AsString())
+				}
+			}
+		}
+	}
+
+	assert.Equal(t, int64(3), sums["strongforce.bus.received.messages"])
+	assert.Equal(t, int64(1), sums["strongforce.bus.acks"])
+	assert.Equal(t, int64(1), sums["strongforce.bus.naks"])
+	assert.Equal(t, int64(1), sums["strongforce.bus.handler.errors"])
+	assert.Equal(t, int64(1), sums["strongforce.bus.routing.failures"])
+}
@@ -12,14 +12,24 @@ type DB interface {
 	Connection() *sqlx.DB
 	Migrate(ctx context.Context, options *MigrationOptions) (*MigrationResult, error)
 	Tx(ctx context.Context, tx TxFn) error
-	EventTx(ctx context.Context, etx EventTxFn) (*events.EventID, error)
-	EventsTx(ctx context.Context, etx EventsTxFn) ([]events.EventID, error)
+	EventTx(ctx context.Context, etx EventTxFn, opts ...EventTxOption) (*events.EventID, error)
+	EventsTx(ctx context.Context, etx EventsTxFn, opts ...EventTxOption) ([]events.EventID, error)
 }
 
 type MigrationOptions struct {
 	DropTablesBeforeMigrating bool
 }
 
+// Listener is implemented by databases that can wake the forwarder when
+// events are committed, such as Postgres through LISTEN/NOTIFY.
+type Listener interface {
+	// Listen receives on the returned channel whenever channel is notified,
+	// and whenever notifications may have been missed, e.g. after
+	// reconnecting. Wakeups are coalesced. The channel is closed once ctx
+	// ends or listening fails for good.
+	Listen(ctx context.Context, channel string) (<-chan struct{}, error)
+}
+
 type Migrator interface {
 	Migrate(ctx context.Context, dsn string) (*MigrationResult, error)
 }
@@ -31,3 +41,26 @@ type MigrationResult struct {
 type TxFn func(ctx context.Context, tx *sqlx.Tx) error
 type EventTxFn func(ctx context.Context, tx *sqlx.Tx) (*events.EventSpec, error)
 type EventsTxFn func(ctx context.Context, tx *sqlx.Tx) ([]*events.EventSpec, error)
+
+type EventTxOptions struct {
+	// IdempotencyKey deduplicates retried transactions. When a transaction
+	// with the same key has already committed, the callback is skipped and
+	// the originally emitted event ids are returned.
+	IdempotencyKey string
+}
+
+type EventTxOption func(*EventTxOptions)
+
+func WithIdempotencyKey(key string) EventTxOption {
+	return func(options *EventTxOptions) {
+		options.IdempotencyKey = key
+	}
+}
+
+func NewEventTxOptions(opts ...EventTxOption) *EventTxOptions {
+	options := &EventTxOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return options
+}
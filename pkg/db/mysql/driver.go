@@ -8,6 +8,7 @@ import (
 	"github.com/uptrace/opentelemetry-go-extra/otelsql"
 	"github.com/uptrace/opentelemetry-go-extra/otelsqlx"
 	"github.com/vectrum-io/strongforce/pkg/db"
+	"github.com/vectrum-io/strongforce/pkg/idempotency"
 	"github.com/vectrum-io/strongforce/pkg/outbox"
 	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
 	"go.uber.org/zap"
@@ -19,6 +20,7 @@ type MySQL struct {
 	config            *mysql.Config
 	connectionOptions *ConnectionOptions
 	outbox            *outbox.Outbox
+	idempotency       *idempotency.Store
 	logger            *zap.Logger
 }
 
@@ -37,10 +39,19 @@ func New(options Options) (*MySQL, error) {
 		return nil, err
 	}
 
+	var idempotencyStore *idempotency.Store
+	if options.IdempotencyOptions != nil {
+		idempotencyStore, err = idempotency.New(options.IdempotencyOptions)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return &MySQL{
 		config:            cfg,
 		migrator:          options.Migrator,
 		outbox:            ob,
+		idempotency:       idempotencyStore,
 		logger:            options.Logger,
 		connectionOptions: options.ConnectionOptions,
 	}, nil
@@ -69,12 +80,24 @@ func (db *MySQL) Connection() *sqlx.DB {
 	return db.conn
 }
 
+// Config returns a copy of the parsed DSN, for components that open their
+// own connections, such as the binlog forwarder.
+func (db *MySQL) Config() *mysql.Config {
+	return db.config.Clone()
+}
+
 // Outbox returns the underlying outbox so client wiring code can attach a
 // CommitNotifier. Returns nil if no outbox is configured.
 func (db *MySQL) Outbox() *outbox.Outbox {
 	return db.outbox
 }
 
+// IdempotencyStore returns the idempotency key store so client wiring code can
+// run its cleanup job. Returns nil if idempotency keys are not configured.
+func (db *MySQL) IdempotencyStore() *idempotency.Store {
+	return db.idempotency
+}
+
 func (db *MySQL) Migrate(ctx context.Context, options *db.MigrationOptions) (*db.MigrationResult, error) {
 	if db.migrator == nil {
 		return nil, ErrNoMigrator
@@ -5,68 +5,51 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/jmoiron/sqlx"
 	"github.com/vectrum-io/strongforce/pkg/db"
 	"github.com/vectrum-io/strongforce/pkg/events"
 )
 
 var (
-	ErrNoOutboxConfigured = errors.New("no event outbox configured")
+	ErrNoOutboxConfigured      = errors.New("no event outbox configured")
+	ErrNoIdempotencyConfigured = errors.New("no idempotency store configured")
 )
 
 // EventTx is a convenience method for emitting a single event in a single transaction.
 // On successful commit, the event is handed to the outbox's CommitNotifier (if any)
 // so downstream consumers can publish it directly without re-querying the outbox.
-func (db *MySQL) EventTx(ctx context.Context, etxFn db.EventTxFn) (eventId *events.EventID, err error) {
-	if db.outbox == nil {
-		return nil, ErrNoOutboxConfigured
-	}
-
-	tx, err := db.conn.BeginTxx(ctx, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	defer func() {
-		if p := recover(); p != nil {
-			err = fmt.Errorf("panic occurred: %+v", p)
-			if rbError := tx.Rollback(); rbError != nil {
-				err = errors.Join(err, rbError)
-			}
-		} else if err != nil {
-			if rbError := tx.Rollback(); rbError != nil {
-				err = errors.Join(err, rbError)
-			}
+func (db *MySQL) EventTx(ctx context.Context, etxFn db.EventTxFn, opts ...db.EventTxOption) (*events.EventID, error) {
+	eventIds, err := db.EventsTx(ctx, func(ctx context.Context, tx *sqlx.Tx) ([]*events.EventSpec, error) {
+		event, err := etxFn(ctx, tx)
+		if err != nil {
+			return nil, err
 		}
-	}()
-
-	event, txErr := etxFn(ctx, tx)
-	if txErr != nil {
-		err = txErr
-		return nil, txErr
-	}
-
-	serialized, err := db.outbox.EmitEvent(ctx, tx, event)
+		return []*events.EventSpec{event}, nil
+	}, opts...)
 	if err != nil {
 		return nil, err
 	}
 
-	if err = tx.Commit(); err != nil {
-		return nil, err
+	// a replayed idempotency key returns whatever the original transaction emitted
+	if len(eventIds) == 0 {
+		return nil, nil
 	}
 
-	db.outbox.NotifyCommitted(ctx, []*events.SerializedEvent{serialized})
-
-	id := serialized.Metadata.Id
-	return &id, nil
+	return &eventIds[0], nil
 }
 
 // EventsTx is a convenience method for emitting multiple events in a single transaction.
 // On successful commit, all events are handed to the outbox's CommitNotifier (if any).
-func (db *MySQL) EventsTx(ctx context.Context, etxFn db.EventsTxFn) (eventIds []events.EventID, err error) {
+func (db *MySQL) EventsTx(ctx context.Context, etxFn db.EventsTxFn, opts ...db.EventTxOption) (eventIds []events.EventID, err error) {
 	if db.outbox == nil {
 		return nil, ErrNoOutboxConfigured
 	}
 
+	txOptions := newEventTxOptions(opts)
+	if txOptions.IdempotencyKey != "" && db.idempotency == nil {
+		return nil, ErrNoIdempotencyConfigured
+	}
+
 	tx, err := db.conn.BeginTxx(ctx, nil)
 	if err != nil {
 		return nil, err
@@ -85,6 +68,21 @@ func (db *MySQL) EventsTx(ctx context.Context, etxFn db.EventsTxFn) (eventIds []
 		}
 	}()
 
+	if txOptions.IdempotencyKey != "" {
+		existingIds, claimed, claimErr := db.idempotency.Claim(ctx, tx, txOptions.IdempotencyKey)
+		if claimErr != nil {
+			err = claimErr
+			return nil, claimErr
+		}
+
+		if !claimed {
+			if err = tx.Rollback(); err != nil {
+				return nil, err
+			}
+			return existingIds, nil
+		}
+	}
+
 	eventSpecs, txErr := etxFn(ctx, tx)
 	if txErr != nil {
 		err = txErr
@@ -101,15 +99,28 @@ func (db *MySQL) EventsTx(ctx context.Context, etxFn db.EventsTxFn) (eventIds []
 		serializedEvents = append(serializedEvents, serialized)
 	}
 
+	eventIds = make([]events.EventID, 0, len(serializedEvents))
+	for _, s := range serializedEvents {
+		eventIds = append(eventIds, s.Metadata.Id)
+	}
+
+	if txOptions.IdempotencyKey != "" {
+		if err = db.idempotency.Record(ctx, tx, txOptions.IdempotencyKey, eventIds); err != nil {
+			return nil, err
+		}
+	}
+
 	if err = tx.Commit(); err != nil {
 		return nil, err
 	}
 
 	db.outbox.NotifyCommitted(ctx, serializedEvents)
 
-	eventIds = make([]events.EventID, 0, len(serializedEvents))
-	for _, s := range serializedEvents {
-		eventIds = append(eventIds, s.Metadata.Id)
-	}
 	return eventIds, nil
 }
+
+// newEventTxOptions lives outside the methods because their db receiver
+// shadows the db package.
+func newEventTxOptions(opts []db.EventTxOption) *db.EventTxOptions {
+	return db.NewEventTxOptions(opts...)
+}
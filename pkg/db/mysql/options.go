@@ -3,6 +3,7 @@ package mysql
 import (
 	"errors"
 	"github.com/vectrum-io/strongforce/pkg/db"
+	"github.com/vectrum-io/strongforce/pkg/idempotency"
 	"github.com/vectrum-io/strongforce/pkg/outbox"
 	"go.uber.org/zap"
 	"time"
@@ -11,6 +12,13 @@ import (
 var (
 	ErrNoDSN      = errors.New("no dsn provided")
 	ErrNoMigrator = errors.New("no migrator provided")
+	// ErrNotifyUnsupported is returned for outbox.Options.NotifyChannel,
+	// which relies on Postgres LISTEN/NOTIFY.
+	ErrNotifyUnsupported = errors.New("outbox notifications are not supported on mysql")
+	// ErrLogicalMessagesUnsupported is returned for
+	// outbox.Options.LogicalMessagePrefix, which relies on Postgres logical
+	// decoding.
+	ErrLogicalMessagesUnsupported = errors.New("logical message outboxes are not supported on mysql")
 )
 
 var DefaultConnectionOptions = ConnectionOptions{
@@ -21,11 +29,14 @@ var DefaultConnectionOptions = ConnectionOptions{
 }
 
 type Options struct {
-	DSN               string
-	OutboxOptions     *outbox.Options
-	Logger            *zap.Logger
-	Migrator          db.Migrator
-	ConnectionOptions *ConnectionOptions
+	DSN           string
+	OutboxOptions *outbox.Options
+	// IdempotencyOptions enables db.WithIdempotencyKey for EventTx and
+	// EventsTx. Nil disables idempotency keys.
+	IdempotencyOptions *idempotency.Options
+	Logger             *zap.Logger
+	Migrator           db.Migrator
+	ConnectionOptions  *ConnectionOptions
 }
 
 type ConnectionOptions struct {
@@ -48,6 +59,14 @@ func (o *Options) validate() error {
 		o.OutboxOptions = &outbox.Options{}
 	}
 
+	if o.OutboxOptions.NotifyChannel != "" {
+		return ErrNotifyUnsupported
+	}
+
+	if o.OutboxOptions.LogicalMessagePrefix != "" {
+		return ErrLogicalMessagesUnsupported
+	}
+
 	if o.ConnectionOptions == nil {
 		o.ConnectionOptions = &DefaultConnectionOptions
 	}
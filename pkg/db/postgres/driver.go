@@ -7,6 +7,7 @@ import (
 	_ "github.com/lib/pq"
 	"github.com/uptrace/opentelemetry-go-extra/otelsql"
 	"github.com/vectrum-io/strongforce/pkg/db"
+	"github.com/vectrum-io/strongforce/pkg/idempotency"
 	"github.com/vectrum-io/strongforce/pkg/outbox"
 	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
 	"go.uber.org/zap"
@@ -17,6 +18,7 @@ type PostgresSQL struct {
 	migrator          db.Migrator
 	dsn               string
 	outbox            *outbox.Outbox
+	idempotency       *idempotency.Store
 	logger            *zap.Logger
 	connectionOptions *ConnectionOptions
 }
@@ -31,10 +33,19 @@ func New(options Options) (*PostgresSQL, error) {
 		return nil, err
 	}
 
+	var idempotencyStore *idempotency.Store
+	if options.IdempotencyOptions != nil {
+		idempotencyStore, err = idempotency.New(options.IdempotencyOptions)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return &PostgresSQL{
 		dsn:               options.DSN,
 		migrator:          options.Migrator,
 		outbox:            ob,
+		idempotency:       idempotencyStore,
 		logger:            options.Logger,
 		connectionOptions: options.ConnectionOptions,
 	}, nil
@@ -70,6 +81,12 @@ func (db *PostgresSQL) Outbox() *outbox.Outbox {
 	return db.outbox
 }
 
+// IdempotencyStore returns the idempotency key store so client wiring code can
+// run its cleanup job. Returns nil if idempotency keys are not configured.
+func (db *PostgresSQL) IdempotencyStore() *idempotency.Store {
+	return db.idempotency
+}
+
 func (db *PostgresSQL) Migrate(ctx context.Context, options *db.MigrationOptions) (*db.MigrationResult, error) {
 	if db.migrator == nil {
 		return nil, ErrNoMigrator
@@ -0,0 +1,73 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	listenerMinReconnectInterval = 100 * time.Millisecond
+	listenerMaxReconnectInterval = 10 * time.Second
+	// listenerPingInterval bounds how long a silently dropped listener
+	// connection goes unnoticed.
+	listenerPingInterval = 90 * time.Second
+)
+
+// Listen implements db.Listener with LISTEN on a dedicated connection, which
+// reconnects on its own. The returned channel also receives once listening
+// starts and after each reconnect, as notifications sent in between are lost.
+func (db *PostgresSQL) Listen(ctx context.Context, channel string) (<-chan struct{}, error) {
+	listener := pq.NewListener(db.dsn, listenerMinReconnectInterval, listenerMaxReconnectInterval, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			db.logger.Sugar().Warnf("postgres listener on %s %s: %s", channel, event.String(), err.Error())
+		}
+	})
+
+	// Listen blocks until connected, so close the listener to unblock it
+	go func() {
+		<-ctx.Done()
+		_ = listener.Close()
+	}()
+
+	wakeups := make(chan struct{}, 1)
+	wake := func() {
+		select {
+		case wakeups <- struct{}{}:
+		default:
+		}
+	}
+
+	go func() {
+		defer close(wakeups)
+
+		if err := listener.Listen(channel); err != nil {
+			if ctx.Err() == nil {
+				db.logger.Sugar().Warnf("failed to listen on %s: %s", channel, err.Error())
+			}
+			return
+		}
+		wake()
+
+		ticker := time.NewTicker(listenerPingInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case _, ok := <-listener.Notify:
+				if !ok {
+					return
+				}
+				// nil notifications signal a reconnect
+				wake()
+			case <-ticker.C:
+				_ = listener.Ping()
+			}
+		}
+	}()
+
+	return wakeups, nil
+}
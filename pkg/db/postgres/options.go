@@ -3,6 +3,7 @@ package postgres
 import (
 	"errors"
 	"github.com/vectrum-io/strongforce/pkg/db"
+	"github.com/vectrum-io/strongforce/pkg/idempotency"
 	"github.com/vectrum-io/strongforce/pkg/outbox"
 	"go.uber.org/zap"
 	"time"
@@ -21,11 +22,14 @@ var DefaultConnectionOptions = ConnectionOptions{
 }
 
 type Options struct {
-	DSN               string
-	OutboxOptions     *outbox.Options
-	Logger            *zap.Logger
-	Migrator          db.Migrator
-	ConnectionOptions *ConnectionOptions
+	DSN           string
+	OutboxOptions *outbox.Options
+	// IdempotencyOptions enables db.WithIdempotencyKey for EventTx and
+	// EventsTx. Nil disables idempotency keys.
+	IdempotencyOptions *idempotency.Options
+	Logger             *zap.Logger
+	Migrator           db.Migrator
+	ConnectionOptions  *ConnectionOptions
 }
 
 type ConnectionOptions struct {
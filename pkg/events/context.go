@@ -0,0 +1,30 @@
+package events
+
+import "context"
+
+type causeKey struct{}
+
+// Cause identifies the inbound message a handler is processing. Events emitted
+// while it is present in the ctx are linked to that message.
+type Cause struct {
+	MessageId     string
+	CorrelationId string
+}
+
+// ContextWithCause returns a copy of ctx carrying the inbound message id and
+// its correlation id. Bus implementations attach it to the message ctx.
+func ContextWithCause(ctx context.Context, messageId string, correlationId string) context.Context {
+	return context.WithValue(ctx, causeKey{}, Cause{
+		MessageId:     messageId,
+		CorrelationId: correlationId,
+	})
+}
+
+// CauseFromContext returns the cause stored by ContextWithCause, if any.
+func CauseFromContext(ctx context.Context) (Cause, bool) {
+	if ctx == nil {
+		return Cause{}, false
+	}
+	cause, ok := ctx.Value(causeKey{}).(Cause)
+	return cause, ok
+}
@@ -18,4 +18,28 @@ type EventMetadata struct {
 	Id        EventID
 	Topic     string
 	CreatedAt time.Time
+	// CausationId is the id of the message that caused this event to be
+	// emitted. Empty for events that were not emitted by a message handler.
+	CausationId string
+	// CorrelationId is shared by every event of one causal chain. It is the
+	// id of the chain's first message.
+	CorrelationId string
+}
+
+// SetCause links the event to the message that caused it. Ids that are already
+// set are kept. The correlation id falls back to the causing message's id,
+// which makes that message the root of a new chain when it was not emitted by
+// a handler itself.
+func (m *EventMetadata) SetCause(messageId string, correlationId string) {
+	if m.CausationId == "" {
+		m.CausationId = messageId
+	}
+
+	if m.CorrelationId == "" {
+		m.CorrelationId = correlationId
+	}
+
+	if m.CorrelationId == "" {
+		m.CorrelationId = messageId
+	}
 }
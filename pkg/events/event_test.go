@@ -0,0 +1,41 @@
+package events
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetCauseStartsChain(t *testing.T) {
+	metadata := &EventMetadata{Id: NewEventID()}
+	metadata.SetCause("inbound", "")
+
+	assert.Equal(t, "inbound", metadata.CausationId)
+	assert.Equal(t, "inbound", metadata.CorrelationId)
+}
+
+func TestSetCauseContinuesChain(t *testing.T) {
+	metadata := &EventMetadata{Id: NewEventID()}
+	metadata.SetCause("inbound", "root")
+
+	assert.Equal(t, "inbound", metadata.CausationId)
+	assert.Equal(t, "root", metadata.CorrelationId)
+}
+
+func TestSetCauseKeepsExplicitIds(t *testing.T) {
+	metadata := &EventMetadata{Id: NewEventID(), CausationId: "cause", CorrelationId: "corr"}
+	metadata.SetCause("inbound", "root")
+
+	assert.Equal(t, "cause", metadata.CausationId)
+	assert.Equal(t, "corr", metadata.CorrelationId)
+}
+
+func TestCauseFromContext(t *testing.T) {
+	_, ok := CauseFromContext(context.Background())
+	assert.False(t, ok)
+
+	cause, ok := CauseFromContext(ContextWithCause(context.Background(), "inbound", "root"))
+	assert.True(t, ok)
+	assert.Equal(t, Cause{MessageId: "inbound", CorrelationId: "root"}, cause)
+}
@@ -0,0 +1,87 @@
+package forwarder
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/vectrum-io/strongforce/pkg/outbox"
+)
+
+var errMalformedEvent = errors.New("malformed binlog event")
+
+// binlogPosition is a position in the source's binary log. GTIDSet is the
+// set of transactions executed up to it, empty unless the checkpoint was
+// created on a source with GTIDs enabled.
+type binlogPosition struct {
+	File     string `db:"file"`
+	Position uint32 `db:"position"`
+	GTIDSet  string `db:"gtid_set"`
+}
+
+func (p binlogPosition) String() string {
+	if p.GTIDSet != "" {
+		return fmt.Sprintf("%s:%d (%s)", p.File, p.Position, p.GTIDSet)
+	}
+	return fmt.Sprintf("%s:%d", p.File, p.Position)
+}
+
+// isTable reports whether a table map event maps table, which may be schema
+// qualified. Unqualified names are looked up in defaultSchema.
+func isTable(event *replication.TableMapEvent, table, defaultSchema string) bool {
+	schema, name, ok := strings.Cut(table, ".")
+	if !ok {
+		schema, name = defaultSchema, table
+	}
+	return string(event.Schema) == schema && string(event.Table) == name
+}
+
+// newBinlogEvent maps the values of an outbox row onto an entity. Character
+// columns are decoded as strings, blobs as []byte and datetimes as
+// time.Time, or as strings inside compressed transactions.
+func newBinlogEvent(columns []string, row []any) *outbox.EventEntity {
+	event := &outbox.EventEntity{}
+	for i, column := range columns {
+		if i >= len(row) {
+			break
+		}
+
+		switch value := row[i].(type) {
+		case string:
+			setBinlogColumn(event, column, []byte(value))
+		case []byte:
+			setBinlogColumn(event, column, value)
+		case time.Time:
+			if column == "created_at" {
+				event.CreatedAt = sql.NullTime{Time: value, Valid: true}
+			}
+		}
+	}
+	return event
+}
+
+// binlogDatetimeLayout is how datetimes are decoded without parsing them,
+// which the rows of compressed transactions are.
+const binlogDatetimeLayout = "2006-01-02 15:04:05.999999"
+
+func setBinlogColumn(event *outbox.EventEntity, column string, value []byte) {
+	switch column {
+	case "id":
+		event.Id = sql.NullString{String: string(value), Valid: true}
+	case "topic":
+		event.Topic = sql.NullString{String: string(value), Valid: true}
+	case "payload":
+		event.Payload = value
+	case "created_at":
+		if t, err := time.Parse(binlogDatetimeLayout, string(value)); err == nil {
+			event.CreatedAt = sql.NullTime{Time: t, Valid: true}
+		}
+	case "causation_id":
+		event.CausationId = sql.NullString{String: string(value), Valid: true}
+	case "correlation_id":
+		event.CorrelationId = sql.NullString{String: string(value), Valid: true}
+	}
+}
@@ -0,0 +1,609 @@
+package forwarder
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	gomysql "github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+	"github.com/vectrum-io/strongforce/pkg/bus"
+	"github.com/vectrum-io/strongforce/pkg/db"
+	"github.com/vectrum-io/strongforce/pkg/events"
+	"go.uber.org/zap"
+)
+
+//goland:noinspection SqlNoDataSourceInspection
+const binlogCheckpointTable = `
+		CREATE TABLE IF NOT EXISTS %s (
+		  name varchar(255) NOT NULL,
+		  file varchar(255) NOT NULL,
+		  position bigint unsigned NOT NULL,
+		  gtid_set text NULL,
+		  updated_at datetime(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6) ON UPDATE CURRENT_TIMESTAMP(6),
+		  PRIMARY KEY (name)
+		)
+`
+
+// mysqlConfigProvider is implemented by databases that expose their MySQL
+// connection settings, such as mysql.MySQL.
+type mysqlConfigProvider interface {
+	Config() *mysql.Config
+}
+
+// BinlogForwarder forwards outbox inserts by reading the MySQL binary log
+// like a replica, instead of polling the outbox table. It requires
+// binlog_format = ROW and a user with the REPLICATION SLAVE and REPLICATION
+// CLIENT privileges, and connects with the database's address, credentials
+// and TLS configuration. A transaction's events are published in binlog
+// order, then deleted from the outbox in the same transaction that saves the
+// binlog position after it as the forwarder's checkpoint, so a restarted
+// forwarder resumes after the last forwarded transaction. Delivery is at
+// least once.
+//
+// Checkpoints created with gtid_mode = ON also save the executed GTID set and
+// resume from it, so they survive a failover to a replica. Otherwise they
+// resume from a binlog file and position, which are only valid while the
+// source keeps that file; a forwarder that was down longer than the binlog
+// retention cannot resume.
+//
+// Before the checkpoint is created, the events already in the outbox are
+// forwarded once by polling it like DBForwarder, and startup fails until all
+// of them are published. Events inserted meanwhile may be forwarded twice.
+// Every forwarder reading the binlog sees every event, so run one per outbox.
+type BinlogForwarder struct {
+	db                  db.DB
+	bus                 bus.Bus
+	outboxTableName     string
+	checkpointTableName string
+	checkpointName      string
+	serverID            uint32
+	heartbeatInterval   time.Duration
+	retryInterval       time.Duration
+	logger              *zap.Logger
+	stopChan            chan struct{}
+	stopOnce            sync.Once
+	runState            runState
+	// checkpoint is the last saved position, where the next stream starts.
+	checkpoint binlogPosition
+}
+
+func NewBinlogForwarder(db db.DB, bus bus.Bus, options *BinlogOptions) (*BinlogForwarder, error) {
+	if options == nil {
+		options = &BinlogOptions{}
+	}
+	if err := options.validate(); err != nil {
+		return nil, fmt.Errorf("failed to validate options: %w", err)
+	}
+
+	return &BinlogForwarder{
+		db:                  db,
+		bus:                 bus,
+		outboxTableName:     options.OutboxTableName,
+		checkpointTableName: options.CheckpointTableName,
+		checkpointName:      options.CheckpointName,
+		serverID:            options.ServerID,
+		heartbeatInterval:   options.HeartbeatInterval,
+		retryInterval:       options.RetryInterval,
+		logger:              options.Logger,
+		stopChan:            make(chan struct{}),
+	}, nil
+}
+
+func (fw *BinlogForwarder) Stop() error {
+	fw.stopOnce.Do(func() {
+		close(fw.stopChan)
+	})
+	return nil
+}
+
+// Start loads or creates the checkpoint, then forwards events from the binlog
+// until Stop is called or ctx ends. Failed streams are reopened at the
+// checkpoint after RetryInterval. A stopped forwarder cannot be started
+// again.
+func (fw *BinlogForwarder) Start(ctx context.Context) error {
+	select {
+	case <-fw.stopChan:
+		return nil
+	default:
+	}
+
+	provider, ok := fw.db.(mysqlConfigProvider)
+	if !ok || fw.db.Connection().DriverName() != "mysql" {
+		return fmt.Errorf("%w: binlog forwarding requires mysql, not %s", ErrFatal, fw.db.Connection().DriverName())
+	}
+	config := provider.Config()
+
+	if err := fw.setup(ctx); err != nil {
+		return fmt.Errorf("failed to set up binlog forwarding: %w", err)
+	}
+
+	fw.runState.start()
+	defer fw.runState.stop()
+
+	for {
+		err := fw.tail(ctx, config)
+		select {
+		case <-fw.stopChan:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		if errors.Is(err, ErrFatal) {
+			return err
+		}
+		fw.logger.Sugar().Warnf("failed to forward binlog events after %s: %s", fw.checkpoint, err.Error())
+
+		select {
+		case <-time.After(fw.retryInterval):
+		case <-fw.stopChan:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (fw *BinlogForwarder) setup(ctx context.Context) error {
+	connection := fw.db.Connection()
+
+	var format string
+	if err := connection.GetContext(ctx, &format, "SELECT @@global.binlog_format"); err != nil {
+		return fmt.Errorf("failed to read binlog format: %w", err)
+	}
+	if format != "ROW" {
+		return fmt.Errorf("%w: binlog_format is %s, not ROW", ErrFatal, format)
+	}
+
+	if _, err := connection.ExecContext(ctx, fmt.Sprintf(binlogCheckpointTable, fw.checkpointTableName)); err != nil {
+		return fmt.Errorf("failed to create checkpoint table: %w", err)
+	}
+
+	//goland:noinspection SqlNoDataSourceInspection
+	query := fmt.Sprintf("SELECT file, position, COALESCE(gtid_set, '') AS gtid_set FROM %s WHERE name = ?", fw.checkpointTableName)
+	err := connection.GetContext(ctx, &fw.checkpoint, query, fw.checkpointName)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		position, err := fw.currentPosition(ctx)
+		if err != nil {
+			return err
+		}
+		// the binlog is only read from the checkpoint on, so events committed
+		// before it are forwarded from the outbox first. The checkpoint is
+		// only saved afterwards, so a failed drain is retried.
+		if err := fw.drainOutbox(ctx); err != nil {
+			return fmt.Errorf("failed to forward events predating binlog checkpoint %s: %w", fw.checkpointName, err)
+		}
+		if err := fw.saveCheckpoint(ctx, position, nil); err != nil {
+			return err
+		}
+		fw.logger.Sugar().Infof("created binlog checkpoint %s at %s", fw.checkpointName, position)
+	case err != nil:
+		return fmt.Errorf("failed to load binlog checkpoint: %w", err)
+	default:
+		fw.logger.Sugar().Infof("resuming binlog checkpoint %s at %s", fw.checkpointName, fw.checkpoint)
+	}
+
+	return nil
+}
+
+// drainOutbox forwards the events currently in the outbox table with a
+// DBForwarder.
+func (fw *BinlogForwarder) drainOutbox(ctx context.Context) error {
+	poller, err := New(fw.db, fw.bus, &Options{
+		OutboxTableName: fw.outboxTableName,
+		Logger:          fw.logger,
+	})
+	if err != nil {
+		return err
+	}
+	return poller.drain(ctx)
+}
+
+// currentPosition returns where the binlog currently ends, with the executed
+// GTID set if GTIDs are on. MySQL 8.4 removed SHOW MASTER STATUS in favour of
+// SHOW BINARY LOG STATUS, added in 8.2.
+func (fw *BinlogForwarder) currentPosition(ctx context.Context) (binlogPosition, error) {
+	position, err := fw.queryPosition(ctx, "SHOW BINARY LOG STATUS")
+	if err != nil {
+		position, err = fw.queryPosition(ctx, "SHOW MASTER STATUS")
+	}
+	if err != nil {
+		return position, fmt.Errorf("failed to read binlog position: %w", err)
+	}
+
+	var gtidMode string
+	if err := fw.db.Connection().GetContext(ctx, &gtidMode, "SELECT @@global.gtid_mode"); err != nil {
+		return position, fmt.Errorf("failed to read gtid mode: %w", err)
+	}
+	if gtidMode != "ON" {
+		position.GTIDSet = ""
+	}
+	return position, nil
+}
+
+func (fw *BinlogForwarder) queryPosition(ctx context.Context, query string) (binlogPosition, error) {
+	var position binlogPosition
+
+	rows, err := fw.db.Connection().QueryContext(ctx, query)
+	if err != nil {
+		return position, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return position, err
+	}
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return position, err
+		}
+		return position, fmt.Errorf("%w: binary logging is disabled", ErrFatal)
+	}
+
+	// the columns besides File, Position and Executed_Gtid_Set vary by
+	// version
+	values := make([]any, len(columns))
+	for i, column := range columns {
+		switch column {
+		case "File":
+			values[i] = &position.File
+		case "Position":
+			values[i] = &position.Position
+		case "Executed_Gtid_Set":
+			values[i] = &position.GTIDSet
+		default:
+			values[i] = new(sql.RawBytes)
+		}
+	}
+	if err := rows.Scan(values...); err != nil {
+		return position, err
+	}
+	return position, rows.Err()
+}
+
+// saveCheckpoint deletes forwarded events and saves the position after them
+// in one transaction.
+func (fw *BinlogForwarder) saveCheckpoint(ctx context.Context, position binlogPosition, published []events.EventID) error {
+	tx, err := fw.db.Connection().BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if len(published) > 0 {
+		query, args, err := sqlx.In(fmt.Sprintf("DELETE FROM %s WHERE id IN (?)", fw.outboxTableName), published)
+		if err != nil {
+			return fmt.Errorf("failed to construct deletion query: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return fmt.Errorf("failed to delete published events: %w", err)
+		}
+	}
+
+	//goland:noinspection SqlNoDataSourceInspection
+	query := fmt.Sprintf(
+		"INSERT INTO %s (name, file, position, gtid_set) VALUES (?, ?, ?, ?) ON DUPLICATE KEY UPDATE file = VALUES(file), position = VALUES(position), gtid_set = VALUES(gtid_set)",
+		fw.checkpointTableName,
+	)
+	gtidSet := sql.NullString{String: position.GTIDSet, Valid: position.GTIDSet != ""}
+	if _, err := tx.ExecContext(ctx, query, fw.checkpointName, position.File, position.Position, gtidSet); err != nil {
+		return fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit checkpoint: %w", err)
+	}
+
+	fw.checkpoint = position
+	return nil
+}
+
+// binlogSession is the state of one stream.
+type binlogSession struct {
+	// schema qualifies unqualified table names.
+	schema string
+	// columns are the outbox table's column names, which table map events
+	// only carry with binlog_row_metadata = FULL.
+	columns []string
+	file    string
+	// gtids is the set of transactions up to the last commit, nil when the
+	// checkpoint has no GTID set. gtid is the current transaction's.
+	gtids gomysql.GTIDSet
+	gtid  string
+
+	inTx bool
+	// events are the outbox inserts of the current transaction.
+	events []*events.SerializedEvent
+	// touched is set when the current transaction changed more than the
+	// checkpoint table.
+	touched bool
+
+	// committed is the position after the last transaction. dirty is set
+	// when the transactions since the checkpoint are more than checkpoint
+	// updates, so saving it does not keep moving the checkpoint by itself.
+	committed binlogPosition
+	dirty     bool
+	savedAt   time.Time
+}
+
+// tail streams from the checkpoint until the stream fails or the forwarder
+// stops. Streams are started from the checkpoint's GTID set if it has one
+// and from its file and position otherwise.
+func (fw *BinlogForwarder) tail(ctx context.Context, config *mysql.Config) error {
+	syncerConfig, err := fw.syncerConfig(config)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrFatal, err)
+	}
+	syncer := replication.NewBinlogSyncer(syncerConfig)
+	defer syncer.Close()
+
+	session := &binlogSession{
+		schema:    config.DBName,
+		file:      fw.checkpoint.File,
+		committed: fw.checkpoint,
+		savedAt:   time.Now(),
+	}
+
+	var streamer *replication.BinlogStreamer
+	if fw.checkpoint.GTIDSet != "" {
+		session.gtids, err = gomysql.ParseGTIDSet(gomysql.MySQLFlavor, fw.checkpoint.GTIDSet)
+		if err != nil {
+			return fmt.Errorf("%w: invalid checkpoint gtid set: %w", ErrFatal, err)
+		}
+		streamer, err = syncer.StartSyncGTID(session.gtids.Clone())
+	} else {
+		streamer, err = syncer.StartSync(gomysql.Position{Name: fw.checkpoint.File, Pos: fw.checkpoint.Position})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open binlog stream: %w", err)
+	}
+
+	// cancelling unblocks the read of the next event
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-fw.stopChan:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	for {
+		event, err := streamer.GetEvent(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to read binlog event: %w", err)
+		}
+		fw.runState.polled()
+
+		if err := fw.handle(ctx, session, event, event.Header.LogPos); err != nil {
+			return err
+		}
+	}
+}
+
+// syncerConfig connects to the source like the database connection, over
+// TLS if it does. Failed streams are reopened by Start, at the checkpoint,
+// rather than by the syncer.
+func (fw *BinlogForwarder) syncerConfig(config *mysql.Config) (replication.BinlogSyncerConfig, error) {
+	host, portValue, err := net.SplitHostPort(config.Addr)
+	if err != nil {
+		return replication.BinlogSyncerConfig{}, fmt.Errorf("binlog forwarding requires a tcp address: %w", err)
+	}
+	port, err := strconv.ParseUint(portValue, 10, 16)
+	if err != nil {
+		return replication.BinlogSyncerConfig{}, fmt.Errorf("invalid port %q: %w", portValue, err)
+	}
+	// stream errors are returned and logged by Start, the syncer's own logs
+	// are details
+	logWriter, err := zap.NewStdLogAt(fw.logger, zap.DebugLevel)
+	if err != nil {
+		return replication.BinlogSyncerConfig{}, err
+	}
+
+	return replication.BinlogSyncerConfig{
+		ServerID:         fw.serverID,
+		Flavor:           gomysql.MySQLFlavor,
+		Host:             host,
+		Port:             uint16(port),
+		User:             config.User,
+		Password:         config.Passwd,
+		TLSConfig:        config.TLS,
+		ParseTime:        true,
+		HeartbeatPeriod:  fw.heartbeatInterval,
+		ReadTimeout:      3 * fw.heartbeatInterval,
+		DisableRetrySync: true,
+		Logger:           slog.New(slog.NewTextHandler(logWriter.Writer(), nil)),
+	}, nil
+}
+
+// handle processes an event that ends at nextPosition. The events of a
+// compressed transaction end where its payload does.
+func (fw *BinlogForwarder) handle(ctx context.Context, session *binlogSession, event *replication.BinlogEvent, nextPosition uint32) error {
+	switch e := event.Event.(type) {
+	case *replication.RotateEvent:
+		session.file = string(e.NextLogName)
+		// the stream starts with a rotate to the requested position, which
+		// is not the checkpoint's position when streaming by GTID set
+		position := binlogPosition{File: session.file, Position: uint32(e.Position), GTIDSet: session.committed.GTIDSet}
+		if session.gtids == nil && position != session.committed {
+			session.committed = position
+			session.dirty = true
+		}
+	case *replication.GTIDEvent:
+		if session.gtids == nil {
+			return nil
+		}
+		next, err := e.GTIDNext()
+		if err != nil {
+			return fmt.Errorf("%w: %w", errMalformedEvent, err)
+		}
+		session.gtid = next.String()
+	case *replication.QueryEvent:
+		switch query := string(e.Query); {
+		case query == "BEGIN":
+			session.inTx = true
+			session.events = nil
+			session.touched = false
+			return nil
+		case query == "COMMIT":
+			return fw.commit(ctx, session, nextPosition)
+		case query == "ROLLBACK" && session.inTx:
+			session.events = nil
+			return fw.commit(ctx, session, nextPosition)
+		case session.inTx:
+			// such as savepoints
+			return nil
+		}
+		// statements are logged as queries when they cannot be logged as
+		// rows, such as DDL, which commits implicitly and may change the
+		// outbox table
+		session.columns = nil
+		session.touched = true
+		return fw.commit(ctx, session, nextPosition)
+	case *replication.TableMapEvent:
+		if !isTable(e, fw.checkpointTableName, session.schema) {
+			session.touched = true
+		}
+	case *replication.RowsEvent:
+		switch event.Header.EventType {
+		case replication.WRITE_ROWS_EVENTv1, replication.WRITE_ROWS_EVENTv2:
+			return fw.handleRows(ctx, session, e)
+		}
+	case *replication.XIDEvent:
+		return fw.commit(ctx, session, nextPosition)
+	case *replication.TransactionPayloadEvent:
+		for _, inner := range e.Events {
+			if err := fw.handle(ctx, session, inner, nextPosition); err != nil {
+				return err
+			}
+		}
+	default:
+		switch event.Header.EventType {
+		case replication.HEARTBEAT_EVENT, replication.HEARTBEAT_LOG_EVENT_V2:
+			return fw.maybeCheckpoint(ctx, session)
+		}
+	}
+
+	return nil
+}
+
+func (fw *BinlogForwarder) handleRows(ctx context.Context, session *binlogSession, rows *replication.RowsEvent) error {
+	if rows.Table == nil {
+		return fmt.Errorf("%w: rows of unknown table %d", errMalformedEvent, rows.TableID)
+	}
+	if !isTable(rows.Table, fw.outboxTableName, session.schema) {
+		return nil
+	}
+
+	columns, err := fw.outboxColumns(ctx, session, rows.Table)
+	if err != nil {
+		return err
+	}
+
+	for _, row := range rows.Rows {
+		event, err := newBinlogEvent(columns, row).ToSerializedEvent()
+		if err != nil {
+			return fmt.Errorf("%w: %w", errMalformedEvent, err)
+		}
+		session.events = append(session.events, event)
+	}
+	return nil
+}
+
+// outboxColumns returns the outbox table's column names. Unless the binlog
+// carries them, they are looked up and reflect the table's current
+// definition, so the forwarder must not lag behind changes of the outbox
+// table's columns.
+func (fw *BinlogForwarder) outboxColumns(ctx context.Context, session *binlogSession, table *replication.TableMapEvent) ([]string, error) {
+	if len(table.ColumnName) == int(table.ColumnCount) {
+		columns := make([]string, len(table.ColumnName))
+		for i, name := range table.ColumnName {
+			columns[i] = string(name)
+		}
+		return columns, nil
+	}
+	if len(session.columns) == int(table.ColumnCount) {
+		return session.columns, nil
+	}
+
+	var columns []string
+	err := fw.db.Connection().SelectContext(ctx, &columns, `
+		SELECT COLUMN_NAME
+		FROM information_schema.COLUMNS
+		WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?
+		ORDER BY ORDINAL_POSITION
+	`, string(table.Schema), string(table.Table))
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up outbox columns: %w", err)
+	}
+	if len(columns) != int(table.ColumnCount) {
+		return nil, fmt.Errorf("%s has %d columns, but its binlog rows have %d", fw.outboxTableName, len(columns), table.ColumnCount)
+	}
+
+	session.columns = columns
+	return columns, nil
+}
+
+// commit publishes a transaction's events and checkpoints the position after
+// it. Transactions without events are checkpointed at most once per
+// heartbeat interval.
+func (fw *BinlogForwarder) commit(ctx context.Context, session *binlogSession, nextPosition uint32) error {
+	position := binlogPosition{File: session.file, Position: nextPosition}
+	if session.gtids != nil {
+		if session.gtid != "" {
+			if err := session.gtids.Update(session.gtid); err != nil {
+				return fmt.Errorf("%w: %w", errMalformedEvent, err)
+			}
+		}
+		position.GTIDSet = session.gtids.String()
+	}
+	evs := session.events
+	session.gtid = ""
+	session.inTx = false
+	session.events = nil
+	session.committed = position
+	if session.touched {
+		session.dirty = true
+	}
+	session.touched = false
+
+	if len(evs) == 0 {
+		return fw.maybeCheckpoint(ctx, session)
+	}
+
+	published, ok := publishInOrder(ctx, fw.bus, fw.logger, evs)
+	if !ok {
+		return fmt.Errorf("failed to publish the transaction before %s", position)
+	}
+	if err := fw.saveCheckpoint(ctx, position, published); err != nil {
+		return err
+	}
+	// deleting the events is a change of the outbox, which leaves the
+	// session dirty
+	session.savedAt = time.Now()
+	return nil
+}
+
+func (fw *BinlogForwarder) maybeCheckpoint(ctx context.Context, session *binlogSession) error {
+	if !session.dirty || time.Since(session.savedAt) < fw.heartbeatInterval {
+		return nil
+	}
+	if err := fw.saveCheckpoint(ctx, session.committed, nil); err != nil {
+		return err
+	}
+	session.dirty = false
+	session.savedAt = time.Now()
+	return nil
+}
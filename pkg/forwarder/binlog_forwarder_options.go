@@ -0,0 +1,70 @@
+package forwarder
+
+import (
+	"math/rand/v2"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultBinlogCheckpointTable   = "strongforce_binlog_checkpoint"
+	DefaultBinlogHeartbeatInterval = 5 * time.Second
+)
+
+type BinlogOptions struct {
+	OutboxTableName string
+	// CheckpointTableName is the table the binlog position up to which events
+	// were forwarded is stored in. It is created on start if it does not
+	// exist. Defaults to DefaultBinlogCheckpointTable.
+	CheckpointTableName string
+	// CheckpointName keys the forwarder's checkpoint, so forwarders of
+	// different outboxes can share a checkpoint table. Defaults to the
+	// outbox table name.
+	CheckpointName string
+	// ServerID identifies the forwarder to the source like a replica's
+	// server_id and must not be used by another replica of it. Defaults to a
+	// random id.
+	ServerID uint32
+	// HeartbeatInterval is how often the source reports in while there are
+	// no events. It also bounds how often checkpoints are saved when only
+	// other tables change. Defaults to DefaultBinlogHeartbeatInterval.
+	HeartbeatInterval time.Duration
+	// RetryInterval is how long the forwarder waits before it reconnects
+	// after the stream failed. Defaults to DefaultPollingInterval.
+	RetryInterval time.Duration
+	Logger        *zap.Logger
+}
+
+func (o *BinlogOptions) validate() error {
+	if o.OutboxTableName == "" {
+		o.OutboxTableName = DefaultOptions.OutboxTableName
+	}
+
+	if o.CheckpointTableName == "" {
+		o.CheckpointTableName = DefaultBinlogCheckpointTable
+	}
+
+	if o.CheckpointName == "" {
+		o.CheckpointName = o.OutboxTableName
+	}
+
+	if o.ServerID == 0 {
+		// above the ids replicas are usually numbered with
+		o.ServerID = 1<<16 + rand.Uint32N(1<<31)
+	}
+
+	if o.HeartbeatInterval <= 0 {
+		o.HeartbeatInterval = DefaultBinlogHeartbeatInterval
+	}
+
+	if o.RetryInterval <= 0 {
+		o.RetryInterval = DefaultOptions.PollingInterval
+	}
+
+	if o.Logger == nil {
+		o.Logger = zap.L()
+	}
+
+	return nil
+}
@@ -0,0 +1,171 @@
+package forwarder
+
+import (
+	"testing"
+	"time"
+
+	gomysql "github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+var outboxColumnNames = []string{"id", "topic", "payload", "created_at", "causation_id", "correlation_id"}
+
+func TestNewBinlogEvent(t *testing.T) {
+	createdAt := time.Date(2024, 2, 20, 23, 21, 51, 0, time.UTC)
+
+	first := newBinlogEvent(outboxColumnNames, []any{"01J", "orders.created", []byte{69, 42, 0}, createdAt, nil, nil})
+	assert.Equal(t, "01J", first.Id.String)
+	assert.Equal(t, "orders.created", first.Topic.String)
+	assert.Equal(t, []byte{69, 42, 0}, first.Payload)
+	assert.Equal(t, createdAt, first.CreatedAt.Time)
+	assert.False(t, first.CausationId.Valid)
+	assert.False(t, first.CorrelationId.Valid)
+
+	second := newBinlogEvent(outboxColumnNames, []any{"01K", "orders.paid", []byte{}, createdAt.Add(time.Second), "01J", "01I"})
+	assert.Equal(t, "01K", second.Id.String)
+	assert.Equal(t, createdAt.Add(time.Second), second.CreatedAt.Time)
+	assert.Equal(t, "01J", second.CausationId.String)
+	assert.Equal(t, "01I", second.CorrelationId.String)
+}
+
+func TestNewBinlogEventUnparsedDatetime(t *testing.T) {
+	// rows of compressed transactions are decoded without parsing datetimes
+	event := newBinlogEvent(outboxColumnNames, []any{"01J", "test", []byte{1}, "2024-02-20 23:21:51.456", nil, nil})
+	assert.Equal(t, time.Date(2024, 2, 20, 23, 21, 51, 456_000_000, time.UTC), event.CreatedAt.Time)
+
+	event = newBinlogEvent(outboxColumnNames, []any{"01J", "test", []byte{1}, "0000-00-00 00:00:00", nil, nil})
+	assert.False(t, event.CreatedAt.Valid)
+}
+
+func TestNewBinlogEventMissingColumns(t *testing.T) {
+	// only id and topic are logged, as with binlog_row_image = MINIMAL
+	event := newBinlogEvent(outboxColumnNames, []any{"01J", "test", nil, nil, nil, nil})
+	assert.Equal(t, "01J", event.Id.String)
+	assert.Equal(t, "test", event.Topic.String)
+	assert.Nil(t, event.Payload)
+	assert.False(t, event.CreatedAt.Valid)
+
+	event = newBinlogEvent(outboxColumnNames, []any{"01J"})
+	assert.Equal(t, "01J", event.Id.String)
+	assert.False(t, event.Topic.Valid)
+}
+
+func TestIsTable(t *testing.T) {
+	table := &replication.TableMapEvent{Schema: []byte("strongforce"), Table: []byte("event_outbox")}
+	assert.True(t, isTable(table, "event_outbox", "strongforce"))
+	assert.True(t, isTable(table, "strongforce.event_outbox", "other"))
+	assert.False(t, isTable(table, "event_outbox", "other"))
+	assert.False(t, isTable(table, "strongforce.orders", "strongforce"))
+}
+
+func TestBinlogPositionString(t *testing.T) {
+	assert.Equal(t, "binlog.000002:4", binlogPosition{File: "binlog.000002", Position: 4}.String())
+	assert.Equal(t, "binlog.000002:4 (3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5)",
+		binlogPosition{File: "binlog.000002", Position: 4, GTIDSet: "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5"}.String())
+}
+
+const testSourceUUID = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+
+var testSourceSID = []byte{0x3e, 0x11, 0xfa, 0x47, 0x71, 0xca, 0x11, 0xe1, 0x9e, 0x33, 0xc8, 0x0a, 0xa9, 0x42, 0x95, 0x62}
+
+func newTestBinlogForwarder() *BinlogForwarder {
+	return &BinlogForwarder{
+		outboxTableName:     "event_outbox",
+		checkpointTableName: "binlog_checkpoint",
+		// no checkpoint is due, so transactions without events need no database
+		heartbeatInterval: time.Hour,
+		logger:            zap.NewNop(),
+	}
+}
+
+func binlogEvent(eventType replication.EventType, event replication.Event) *replication.BinlogEvent {
+	return &replication.BinlogEvent{Header: &replication.EventHeader{EventType: eventType}, Event: event}
+}
+
+// otherTransaction is a transaction that does not touch the outbox.
+func otherTransaction() []*replication.BinlogEvent {
+	return []*replication.BinlogEvent{
+		binlogEvent(replication.QUERY_EVENT, &replication.QueryEvent{Query: []byte("BEGIN")}),
+		binlogEvent(replication.TABLE_MAP_EVENT, &replication.TableMapEvent{Schema: []byte("strongforce"), Table: []byte("orders")}),
+		binlogEvent(replication.XID_EVENT, &replication.XIDEvent{}),
+	}
+}
+
+func TestBinlogForwarderTracksGTIDs(t *testing.T) {
+	fw := newTestBinlogForwarder()
+	gtids, err := gomysql.ParseGTIDSet(gomysql.MySQLFlavor, testSourceUUID+":1-4")
+	if !assert.NoError(t, err) {
+		return
+	}
+	session := &binlogSession{schema: "strongforce", gtids: gtids, savedAt: time.Now()}
+
+	// streams by GTID set start with a rotate to the file's start
+	err = fw.handle(t.Context(), session, binlogEvent(replication.ROTATE_EVENT, &replication.RotateEvent{Position: 4, NextLogName: []byte("binlog.000002")}), 0)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.False(t, session.dirty)
+
+	events := append([]*replication.BinlogEvent{
+		binlogEvent(replication.GTID_EVENT, &replication.GTIDEvent{SID: testSourceSID, GNO: 5}),
+	}, otherTransaction()...)
+	for _, event := range events {
+		if !assert.NoError(t, fw.handle(t.Context(), session, event, 500)) {
+			return
+		}
+	}
+
+	assert.Equal(t, binlogPosition{File: "binlog.000002", Position: 500, GTIDSet: testSourceUUID + ":1-5"}, session.committed)
+	assert.True(t, session.dirty)
+	assert.Empty(t, session.gtid)
+}
+
+func TestBinlogForwarderTracksPositions(t *testing.T) {
+	fw := newTestBinlogForwarder()
+	session := &binlogSession{schema: "strongforce", savedAt: time.Now()}
+
+	err := fw.handle(t.Context(), session, binlogEvent(replication.ROTATE_EVENT, &replication.RotateEvent{Position: 120, NextLogName: []byte("binlog.000002")}), 0)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, binlogPosition{File: "binlog.000002", Position: 120}, session.committed)
+
+	// GTIDs are ignored without a GTID set to add them to
+	events := append([]*replication.BinlogEvent{
+		binlogEvent(replication.GTID_EVENT, &replication.GTIDEvent{SID: testSourceSID, GNO: 5}),
+	}, otherTransaction()...)
+	for _, event := range events {
+		if !assert.NoError(t, fw.handle(t.Context(), session, event, 500)) {
+			return
+		}
+	}
+	assert.Equal(t, binlogPosition{File: "binlog.000002", Position: 500}, session.committed)
+}
+
+func TestBinlogForwarderHandlesCompressedTransactions(t *testing.T) {
+	fw := newTestBinlogForwarder()
+	session := &binlogSession{schema: "strongforce", file: "binlog.000002", savedAt: time.Now()}
+
+	payload := binlogEvent(replication.TRANSACTION_PAYLOAD_EVENT, &replication.TransactionPayloadEvent{Events: otherTransaction()})
+	if !assert.NoError(t, fw.handle(t.Context(), session, payload, 900)) {
+		return
+	}
+
+	// the transaction ends where its payload does
+	assert.Equal(t, binlogPosition{File: "binlog.000002", Position: 900}, session.committed)
+	assert.False(t, session.inTx)
+	assert.True(t, session.dirty)
+}
+
+func TestBinlogForwarderOutboxColumnsFromMetadata(t *testing.T) {
+	fw := newTestBinlogForwarder()
+	session := &binlogSession{schema: "strongforce"}
+
+	// binlog_row_metadata = FULL logs the column names
+	table := &replication.TableMapEvent{Schema: []byte("strongforce"), Table: []byte("event_outbox"), ColumnCount: 2, ColumnName: [][]byte{[]byte("id"), []byte("topic")}}
+	columns, err := fw.outboxColumns(t.Context(), session, table)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"id", "topic"}, columns)
+}
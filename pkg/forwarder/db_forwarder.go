@@ -11,16 +11,22 @@ import (
 	"github.com/vectrum-io/strongforce/pkg/bus"
 	"github.com/vectrum-io/strongforce/pkg/db"
 	"github.com/vectrum-io/strongforce/pkg/events"
+	"github.com/vectrum-io/strongforce/pkg/leader"
 	"github.com/vectrum-io/strongforce/pkg/outbox"
 	"github.com/vectrum-io/strongforce/pkg/serialization"
 	"go.uber.org/zap"
 )
 
 var (
-	ErrDirectEmitRequiresDB  = errors.New("direct emit requires a non-nil db")
-	ErrDirectEmitRequiresBus = errors.New("direct emit requires a non-nil bus")
+	ErrDirectEmitRequiresDB   = errors.New("direct emit requires a non-nil db")
+	ErrDirectEmitRequiresBus  = errors.New("direct emit requires a non-nil bus")
+	ErrNotifyRequiresListener = errors.New("notify channel requires a db that implements db.Listener")
 )
 
+// leaseReleaseTimeout bounds giving up leadership, which lets another
+// replica take over without waiting for the lease to expire.
+const leaseReleaseTimeout = 5 * time.Second
+
 type directJob struct {
 	event      *events.SerializedEvent
 	enqueuedAt time.Time
@@ -31,6 +37,7 @@ type DBForwarder struct {
 	bus                    bus.Bus
 	serializer             serialization.Serializer
 	pollingInterval        time.Duration
+	batchSize              int
 	outboxTableName        string
 	logger                 *zap.Logger
 	stopChan               chan struct{}
@@ -38,9 +45,18 @@ type DBForwarder struct {
 	directWorkers          int
 	directQueue            chan directJob
 	outboxDepthSampleEvery int
+	notifyChannel          string
+	listener               db.Listener
+	leaderElector          leader.Elector
 	metrics                *Metrics
+	runState               runState
 
 	workerWg sync.WaitGroup
+	stopOnce sync.Once
+	// directMu guards directClosed. NotifyCommitted holds it for reading
+	// while enqueueing, so Stop can close directQueue safely.
+	directMu     sync.RWMutex
+	directClosed bool
 }
 
 func New(db db.DB, bus bus.Bus, options *Options) (*DBForwarder, error) {
@@ -63,11 +79,17 @@ func New(db db.DB, bus bus.Bus, options *Options) (*DBForwarder, error) {
 		}
 	}
 
+	listener, err := notifyListener(db, options.NotifyChannel)
+	if err != nil {
+		return nil, err
+	}
+
 	return &DBForwarder{
 		db:                     db,
 		bus:                    bus,
 		serializer:             options.Serializer,
 		pollingInterval:        options.PollingInterval,
+		batchSize:              options.BatchSize,
 		outboxTableName:        options.OutboxTableName,
 		logger:                 options.Logger,
 		stopChan:               make(chan struct{}),
@@ -75,28 +97,69 @@ func New(db db.DB, bus bus.Bus, options *Options) (*DBForwarder, error) {
 		directWorkers:          options.DirectWorkers,
 		directQueue:            make(chan directJob, options.DirectQueueSize),
 		outboxDepthSampleEvery: options.OutboxDepthSampleEvery,
+		notifyChannel:          options.NotifyChannel,
+		listener:               listener,
+		leaderElector:          options.LeaderElector,
 		metrics:                options.Metrics,
 	}, nil
 }
 
+// notifyListener returns the listener for a notify channel, or nil without
+// one. It lives outside New because its db parameter shadows the db package.
+func notifyListener(d db.DB, channel string) (db.Listener, error) {
+	if channel == "" {
+		return nil, nil
+	}
+
+	listener, ok := d.(db.Listener)
+	if !ok {
+		return nil, ErrNotifyRequiresListener
+	}
+	return listener, nil
+}
+
+// Stop stops accepting direct emits, waits for the queued ones to be
+// published and then stops the poller. Events committed afterwards stay in
+// the outbox table for the next poll.
 func (fw *DBForwarder) Stop() error {
+	fw.stopOnce.Do(func() {
+		fw.directMu.Lock()
+		fw.directClosed = true
+		close(fw.directQueue)
+		fw.directMu.Unlock()
+
+		fw.workerWg.Wait()
+		close(fw.stopChan)
+	})
+	return nil
+}
+
+// Start polls the outbox until Stop is called or ctx ends. A stopped
+// forwarder cannot be started again.
+func (fw *DBForwarder) Start(ctx context.Context) error {
 	select {
 	case <-fw.stopChan:
 		return nil
 	default:
-		close(fw.stopChan)
 	}
-	fw.workerWg.Wait()
-	return nil
-}
 
-func (fw *DBForwarder) Start(ctx context.Context) error {
-	//goland:noinspection SqlNoDataSourceInspection
-	query := fmt.Sprintf(`
-		SELECT id, topic, payload, created_at
-		FROM %s
-		FOR UPDATE
-	`, fw.outboxTableName)
+	// direct workers exit with Start when ctx ends
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	fw.runState.start()
+	defer fw.runState.stop()
+
+	query := fw.claimQuery()
+
+	// nil without a notify channel, which never wakes the poller
+	var wakeups <-chan struct{}
+	if fw.listener != nil {
+		var err error
+		if wakeups, err = fw.listener.Listen(ctx, fw.notifyChannel); err != nil {
+			return fmt.Errorf("failed to listen for outbox notifications: %w", err)
+		}
+	}
 
 	if fw.directEmit {
 		for i := 0; i < fw.directWorkers; i++ {
@@ -105,6 +168,48 @@ func (fw *DBForwarder) Start(ctx context.Context) error {
 		}
 	}
 
+	if fw.leaderElector == nil {
+		return fw.poll(ctx, query, wakeups)
+	}
+	return fw.pollAsLeader(ctx, query, wakeups)
+}
+
+// claimQuery claims the next batch of outbox rows.
+func (fw *DBForwarder) claimQuery() string {
+	// ids are ULIDs, so ordering by id claims roughly the oldest events
+	// first: ULIDs from different processes only sort by their millisecond,
+	// and concurrent pollers skip each other's rows. See Options.BatchSize.
+	//goland:noinspection SqlNoDataSourceInspection
+	return fmt.Sprintf(`
+		SELECT id, topic, payload, created_at, causation_id, correlation_id
+		FROM %s
+		ORDER BY id
+		LIMIT %d
+		FOR UPDATE SKIP LOCKED
+	`, fw.outboxTableName, fw.batchSize)
+}
+
+// drain forwards the outbox once, batch by batch, until a batch comes back
+// less than full. It fails if an event cannot be published.
+func (fw *DBForwarder) drain(ctx context.Context) error {
+	query := fw.claimQuery()
+	for {
+		claimed, complete, err := fw.processBatch(ctx, query)
+		if err != nil {
+			return err
+		}
+		if !complete {
+			return errors.New("failed to publish every claimed event")
+		}
+		if claimed < fw.batchSize {
+			return nil
+		}
+	}
+}
+
+// poll polls the outbox on every tick and wakeup until Stop is called or ctx
+// ends.
+func (fw *DBForwarder) poll(ctx context.Context, query string, wakeups <-chan struct{}) error {
 	ticker := time.NewTicker(fw.pollingInterval)
 	defer ticker.Stop()
 
@@ -113,19 +218,117 @@ func (fw *DBForwarder) Start(ctx context.Context) error {
 	for {
 		select {
 		case <-ticker.C:
-			if err := fw.processEvents(ctx, query); err != nil {
-				fw.logger.Sugar().Warnf("failed to process events: %s", err.Error())
-			}
+			fw.drainOutbox(ctx, query)
 			tickCount++
 			if fw.outboxDepthSampleEvery > 0 && tickCount%uint64(fw.outboxDepthSampleEvery) == 0 {
 				fw.sampleOutboxDepth(ctx)
 			}
+		case _, ok := <-wakeups:
+			if !ok {
+				fw.logger.Warn("stopped listening for outbox notifications, polling only")
+				wakeups = nil
+				continue
+			}
+			fw.drainOutbox(ctx, query)
 		case <-fw.stopChan:
 			return nil
+		case <-ctx.Done():
+			return ctx.Err()
 		}
 	}
 }
 
+// pollAsLeader polls while this replica leads and campaigns again whenever
+// leadership is lost, until Stop is called or ctx ends.
+func (fw *DBForwarder) pollAsLeader(ctx context.Context, query string, wakeups <-chan struct{}) error {
+	campaignCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Acquire does not know about Stop
+	go func() {
+		select {
+		case <-fw.stopChan:
+			cancel()
+		case <-campaignCtx.Done():
+		}
+	}()
+
+	for {
+		fw.runState.campaign()
+		fw.metrics.setFollower(ctx)
+
+		lease, err := fw.leaderElector.Acquire(campaignCtx)
+		if err != nil {
+			if fw.isStopped() {
+				return nil
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("failed to campaign for leadership: %w", err)
+		}
+
+		fw.runState.lead()
+		fw.metrics.incLeadershipAcquired(ctx)
+		fw.logger.Info("acquired outbox polling leadership")
+
+		leadCtx, stopLeading := context.WithCancel(campaignCtx)
+		go func() {
+			select {
+			case <-lease.Lost():
+				stopLeading()
+			case <-leadCtx.Done():
+			}
+		}()
+
+		err = fw.poll(leadCtx, query, wakeups)
+		stopLeading()
+
+		releaseCtx, cancelRelease := context.WithTimeout(context.Background(), leaseReleaseTimeout)
+		if releaseErr := lease.Release(releaseCtx); releaseErr != nil {
+			fw.logger.Sugar().Warnf("failed to release leadership: %s", releaseErr.Error())
+		}
+		cancelRelease()
+
+		switch {
+		case err == nil || fw.isStopped():
+			return nil
+		case ctx.Err() != nil:
+			return ctx.Err()
+		}
+
+		fw.metrics.incLeadershipLost(ctx)
+		fw.logger.Warn("lost outbox polling leadership")
+	}
+}
+
+// drainOutbox processes batches back to back while they come back full and
+// fully published, so a backlog is not forwarded one batch per tick. Failed
+// publishes wait for the next tick.
+func (fw *DBForwarder) drainOutbox(ctx context.Context, query string) {
+	for {
+		more, err := fw.processEvents(ctx, query)
+		if err != nil {
+			fw.logger.Sugar().Warnf("failed to process events: %s", err.Error())
+			return
+		}
+		fw.runState.polled()
+
+		if !more || ctx.Err() != nil || fw.isStopped() {
+			return
+		}
+	}
+}
+
+func (fw *DBForwarder) isStopped() bool {
+	select {
+	case <-fw.stopChan:
+		return true
+	default:
+		return false
+	}
+}
+
 // NotifyCommitted implements outbox.CommitNotifier. It enqueues events for
 // the direct-emit worker pool. When the queue is full, events are dropped and
 // the poller handles them on its next cycle.
@@ -133,6 +336,13 @@ func (fw *DBForwarder) NotifyCommitted(ctx context.Context, evs []*events.Serial
 	if !fw.directEmit {
 		return
 	}
+
+	fw.directMu.RLock()
+	defer fw.directMu.RUnlock()
+	if fw.directClosed {
+		return
+	}
+
 	now := time.Now()
 	for _, e := range evs {
 		select {
@@ -149,7 +359,7 @@ func (fw *DBForwarder) directWorker(ctx context.Context) {
 	defer fw.workerWg.Done()
 	for {
 		select {
-		case <-fw.stopChan:
+		case <-ctx.Done():
 			return
 		case job, ok := <-fw.directQueue:
 			if !ok {
@@ -194,10 +404,31 @@ func (fw *DBForwarder) sampleOutboxDepth(ctx context.Context) {
 	fw.metrics.setOutboxDepth(ctx, count)
 }
 
-func (fw *DBForwarder) processEvents(ctx context.Context, query string) error {
+// processEvents claims one batch of outbox rows, publishes them and deletes
+// the published ones. It reports whether the batch was full and every row in
+// it was published, i.e. whether more rows are likely waiting.
+func (fw *DBForwarder) processEvents(ctx context.Context, query string) (bool, error) {
+	claimed, complete, err := fw.processBatch(ctx, query)
+	if err != nil {
+		return false, err
+	}
+	return claimed >= fw.batchSize && complete, nil
+}
+
+// processBatch claims one batch of outbox rows, publishes them and deletes
+// the published ones. It returns how many rows were claimed and whether every
+// claimed row that could be read was published.
+//
+// The claim's row locks are held while the batch is published. They are what
+// keeps concurrent pollers off the batch and let the published rows be
+// deleted atomically with the claim; releasing them before publishing would
+// need a claim lease stored in the outbox table. BatchSize bounds how long
+// they are held.
+func (fw *DBForwarder) processBatch(ctx context.Context, query string) (int, bool, error) {
 	var eventRows []*outbox.EventEntity
+	complete := true
 
-	return fw.db.Tx(ctx, func(ctx context.Context, tx *sqlx.Tx) error {
+	err := fw.db.Tx(ctx, func(ctx context.Context, tx *sqlx.Tx) error {
 		err := tx.SelectContext(ctx, &eventRows, query)
 		if err != nil {
 			return err
@@ -222,6 +453,7 @@ func (fw *DBForwarder) processEvents(ctx context.Context, query string) error {
 		}
 
 		publishedIds := fw.publishBatch(ctx, serializedEvents)
+		complete = len(publishedIds) == len(serializedEvents)
 		if len(publishedIds) == 0 {
 			return nil
 		}
@@ -239,72 +471,39 @@ func (fw *DBForwarder) processEvents(ctx context.Context, query string) error {
 
 		return nil
 	})
+	if err != nil {
+		return 0, false, err
+	}
+	return len(eventRows), complete, nil
 }
 
-// publishBatch publishes events concurrently, bounded by directWorkers (or
-// sequentially when direct emit is disabled / workers == 0). Returns the ids
-// of successfully published events so the caller can delete them in a single
-// query.
+// publishBatch publishes a claimed batch in id order and returns the ids of
+// the events published before the first failure, so no event of a batch is
+// deleted while an earlier one is left in the outbox.
 func (fw *DBForwarder) publishBatch(ctx context.Context, evs []*events.SerializedEvent) []events.EventID {
-	// Pick the concurrency cap. A batch of 3 events with directWorkers=8 only
-	// needs 3 goroutines; no point allocating 8 slots we'll never fill.
-	concurrency := fw.directWorkers
-	if concurrency <= 0 {
-		concurrency = 1
+	ids, ok := publishInOrder(ctx, fw.bus, fw.logger, evs)
+	fw.metrics.addPollerPublished(ctx, len(ids))
+	if !ok {
+		fw.metrics.incPollerFailed(ctx)
 	}
-	if concurrency > len(evs) {
-		concurrency = len(evs)
-	}
-
-	var (
-		// mu guards the ids slice: multiple goroutines append concurrently.
-		mu sync.Mutex
-		// ids collects successfully published event ids so the caller can
-		// issue a single batched DELETE.
-		ids = make([]events.EventID, 0, len(evs))
-		// sem is a counting semaphore implemented as a buffered channel.
-		// Capacity == max goroutines allowed to run emitEvent at once.
-		// A token is a struct{}{} value — empty struct uses zero memory.
-		sem = make(chan struct{}, concurrency)
-		// wg tracks when all spawned goroutines have finished so we can
-		// return a complete ids slice to the caller.
-		wg sync.WaitGroup
-	)
-
-	for _, ev := range evs {
-		wg.Add(1)
-		// Acquire a slot BEFORE spawning the goroutine.
-		// If the buffer is full this blocks.
-		sem <- struct{}{}
-
-		go func() {
-			defer wg.Done()
-			// Release the slot when the goroutine exits so the next
-			// iteration of the for-loop can acquire one and proceed.
-			defer func() { <-sem }()
-
-			if err := fw.emitEvent(ctx, ev); err != nil {
-				fw.metrics.incPollerFailed(ctx)
-				fw.logger.Warn("failed to publish event: " + err.Error())
-				return
-			}
-			fw.metrics.incPollerPublished(ctx)
-			mu.Lock()
-			ids = append(ids, ev.Metadata.Id)
-			mu.Unlock()
-		}()
-	}
-
-	wg.Wait()
 	return ids
 }
 
 func (fw *DBForwarder) emitEvent(ctx context.Context, event *events.SerializedEvent) error {
-	message := &bus.OutboundMessage{
-		Id:      event.Metadata.Id.String(),
-		Subject: event.Metadata.Topic,
-		Data:    event.SerializedPayload,
-	}
+	return fw.bus.Publish(ctx, newOutboundMessage(event))
+}
 
-	return fw.bus.Publish(ctx, message)
+// publishInOrder publishes events in order and returns the ids of those
+// published. It stops at the first failure and reports whether all were
+// published.
+func publishInOrder(ctx context.Context, b bus.Bus, logger *zap.Logger, evs []*events.SerializedEvent) ([]events.EventID, bool) {
+	ids := make([]events.EventID, 0, len(evs))
+	for _, event := range evs {
+		if err := b.Publish(ctx, newOutboundMessage(event)); err != nil {
+			logger.Sugar().Warnf("failed to publish event %s: %s", event.Metadata.Id.String(), err.Error())
+			return ids, false
+		}
+		ids = append(ids, event.Metadata.Id)
+	}
+	return ids, true
 }
@@ -3,12 +3,15 @@ package forwarder
 import (
 	"time"
 
+	"github.com/vectrum-io/strongforce/pkg/leader"
 	"github.com/vectrum-io/strongforce/pkg/serialization"
 	"go.uber.org/zap"
 )
 
 const (
 	DefaultPollingInterval        = 100 * time.Millisecond
+	DefaultNotifyPollingInterval  = 5 * time.Second
+	DefaultBatchSize              = 100
 	DefaultDirectWorkers          = 8
 	DefaultDirectQueueSize        = 1024
 	DefaultOutboxDepthSampleEvery = 10
@@ -20,6 +23,21 @@ type Options struct {
 	OutboxTableName string
 	Logger          *zap.Logger
 
+	// BatchSize bounds how many rows a poll claims and publishes in one
+	// transaction, which holds the claimed rows' locks while publishing.
+	// Rows are claimed with FOR UPDATE SKIP LOCKED, so replicas polling
+	// concurrently work on disjoint batches. Full batches are followed
+	// immediately by the next one instead of waiting for the next tick.
+	//
+	// A batch is published in id order and stops at the first failed
+	// publish, leaving it and every later event for the next poll, so a
+	// single poller publishes events in id order. Replicas polling
+	// concurrently publish their batches in parallel, so events of the same
+	// topic can be published out of order; use LeaderElector to keep one
+	// poller when per-topic order matters. Direct emit publishes outside of
+	// this order.
+	BatchSize int
+
 	// DirectEmit enables the push-based happy path: after a successful
 	// EventTx/EventsTx commit, events are handed to the forwarder's worker
 	// pool for immediate publish + row deletion, bypassing the poller.
@@ -33,6 +51,18 @@ type Options struct {
 	// outbox table depth is sampled into Metrics.OutboxDepth. Zero disables.
 	OutboxDepthSampleEvery int
 
+	// NotifyChannel makes the poller LISTEN on this channel and process the
+	// outbox as soon as it is notified, see outbox.Options.NotifyChannel.
+	// PollingInterval then only paces a safety poll and defaults to
+	// DefaultNotifyPollingInterval. Requires a db implementing db.Listener,
+	// i.e. Postgres.
+	NotifyChannel string
+
+	// LeaderElector makes replicas elect one of them to poll the outbox, so
+	// they do not contend for its row locks. Direct emit runs on every
+	// replica regardless. Nil polls on every replica.
+	LeaderElector leader.Elector
+
 	// Metrics is optional. When nil the forwarder records nothing. Construct
 	// with NewMetrics(mp) to attach to an OpenTelemetry MeterProvider.
 	Metrics *Metrics
@@ -40,6 +70,7 @@ type Options struct {
 
 var DefaultOptions = &Options{
 	PollingInterval:        DefaultPollingInterval,
+	BatchSize:              DefaultBatchSize,
 	Serializer:             serialization.NewProtobufSerializer(),
 	OutboxTableName:        "event_outbox",
 	DirectEmit:             false,
@@ -55,6 +86,13 @@ func (o *Options) validate() error {
 
 	if o.PollingInterval == 0 {
 		o.PollingInterval = DefaultOptions.PollingInterval
+		if o.NotifyChannel != "" {
+			o.PollingInterval = DefaultNotifyPollingInterval
+		}
+	}
+
+	if o.BatchSize <= 0 {
+		o.BatchSize = DefaultOptions.BatchSize
 	}
 
 	if o.Serializer == nil {
@@ -1,10 +1,17 @@
 package forwarder
 
 import (
+	"context"
 	"errors"
 	"testing"
+	"time"
 
+	"github.com/jmoiron/sqlx"
 	"github.com/stretchr/testify/assert"
+	"github.com/vectrum-io/strongforce/pkg/bus"
+	"github.com/vectrum-io/strongforce/pkg/db"
+	"github.com/vectrum-io/strongforce/pkg/events"
+	"github.com/vectrum-io/strongforce/pkg/leader"
 )
 
 func TestNewDirectEmitRequiresDB(t *testing.T) {
@@ -20,3 +27,185 @@ func TestNewWithoutDirectEmitAllowsNilDB(t *testing.T) {
 	assert.False(t, errors.Is(err, ErrDirectEmitRequiresDB))
 	assert.False(t, errors.Is(err, ErrDirectEmitRequiresBus))
 }
+
+func TestNewNotifyRequiresListener(t *testing.T) {
+	_, err := New(nil, nil, &Options{NotifyChannel: "outbox"})
+	assert.ErrorIs(t, err, ErrNotifyRequiresListener)
+}
+
+// listeningDB counts polls without running them and wakes the forwarder
+// through wakeups.
+type listeningDB struct {
+	db.DB
+	wakeups chan struct{}
+	polls   chan struct{}
+}
+
+func (d *listeningDB) Tx(ctx context.Context, txFn db.TxFn) error {
+	d.polls <- struct{}{}
+	return nil
+}
+
+func (d *listeningDB) Connection() *sqlx.DB {
+	return nil
+}
+
+func (d *listeningDB) Listen(ctx context.Context, channel string) (<-chan struct{}, error) {
+	return d.wakeups, nil
+}
+
+func TestNotifyWakesPoller(t *testing.T) {
+	database := &listeningDB{wakeups: make(chan struct{}), polls: make(chan struct{})}
+	fw, err := New(database, nil, &Options{
+		NotifyChannel: "outbox",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultNotifyPollingInterval, fw.pollingInterval)
+
+	done := make(chan error)
+	go func() {
+		done <- fw.Start(context.Background())
+	}()
+
+	for i := 0; i < 2; i++ {
+		database.wakeups <- struct{}{}
+		select {
+		case <-database.polls:
+		case <-time.After(time.Second):
+			t.Fatal("notification did not wake the poller")
+		}
+	}
+
+	// falls back to polling alone once listening stops
+	close(database.wakeups)
+	assert.NoError(t, fw.Stop())
+	assert.NoError(t, <-done)
+}
+
+type fakeLease struct {
+	lost     chan struct{}
+	released chan struct{}
+}
+
+func (l *fakeLease) Lost() <-chan struct{} {
+	return l.lost
+}
+
+func (l *fakeLease) Release(ctx context.Context) error {
+	close(l.released)
+	return nil
+}
+
+// fakeElector grants the leases sent on grants.
+type fakeElector struct {
+	grants chan *fakeLease
+}
+
+func (e *fakeElector) Acquire(ctx context.Context) (leader.Lease, error) {
+	select {
+	case l := <-e.grants:
+		return l, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func newFakeLease() *fakeLease {
+	return &fakeLease{lost: make(chan struct{}), released: make(chan struct{})}
+}
+
+func TestLeaderElection(t *testing.T) {
+	elector := &fakeElector{grants: make(chan *fakeLease)}
+	fw, err := New(nil, nil, &Options{
+		// never fires, so the test needs no database
+		PollingInterval: time.Hour,
+		LeaderElector:   elector,
+	})
+	assert.NoError(t, err)
+
+	done := make(chan error)
+	go func() {
+		done <- fw.Start(context.Background())
+	}()
+
+	standby := func() bool {
+		status := fw.runState.status()
+		return status.Running && status.Standby
+	}
+	assert.Eventually(t, standby, time.Second, time.Millisecond)
+
+	first := newFakeLease()
+	elector.grants <- first
+	assert.Eventually(t, func() bool {
+		return !fw.runState.status().Standby
+	}, time.Second, time.Millisecond)
+
+	// losing leadership releases the lease and campaigns again
+	close(first.lost)
+	<-first.released
+	assert.Eventually(t, standby, time.Second, time.Millisecond)
+
+	second := newFakeLease()
+	elector.grants <- second
+	assert.Eventually(t, func() bool {
+		return !fw.runState.status().Standby
+	}, time.Second, time.Millisecond)
+
+	assert.NoError(t, fw.Stop())
+	assert.NoError(t, <-done)
+	<-second.released
+	assert.False(t, fw.runState.status().Running)
+}
+
+func TestLeaderElectionStopWhileCampaigning(t *testing.T) {
+	fw, err := New(nil, nil, &Options{
+		PollingInterval: time.Hour,
+		LeaderElector:   &fakeElector{grants: make(chan *fakeLease)},
+	})
+	assert.NoError(t, err)
+
+	done := make(chan error)
+	go func() {
+		done <- fw.Start(context.Background())
+	}()
+
+	assert.Eventually(t, func() bool {
+		return fw.runState.status().Standby
+	}, time.Second, time.Millisecond)
+
+	assert.NoError(t, fw.Stop())
+	assert.NoError(t, <-done)
+}
+
+// recordingBus records published message ids and fails those in fail.
+type recordingBus struct {
+	bus.Bus
+	fail      map[string]bool
+	published []string
+}
+
+func (b *recordingBus) Publish(ctx context.Context, message *bus.OutboundMessage) error {
+	if b.fail[message.Id] {
+		return errors.New("publish failed")
+	}
+	b.published = append(b.published, message.Id)
+	return nil
+}
+
+func TestPublishBatchStopsAtFirstFailure(t *testing.T) {
+	b := &recordingBus{fail: map[string]bool{"3": true}}
+	fw, err := New(nil, b, &Options{DirectWorkers: 8})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var evs []*events.SerializedEvent
+	for _, id := range []string{"1", "2", "3", "4", "5"} {
+		evs = append(evs, &events.SerializedEvent{Metadata: &events.EventMetadata{Id: events.EventID(id), Topic: "t"}})
+	}
+
+	// later events are left for the next poll, so they are not published
+	// before the failed one
+	assert.Equal(t, []events.EventID{"1", "2"}, fw.publishBatch(context.Background(), evs))
+	assert.Equal(t, []string{"1", "2"}, b.published)
+}
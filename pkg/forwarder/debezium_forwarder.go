@@ -10,6 +10,7 @@ import (
 	"github.com/vectrum-io/strongforce/pkg/events"
 	"github.com/vectrum-io/strongforce/pkg/serialization"
 	"go.uber.org/zap"
+	"sync"
 	"time"
 )
 
@@ -21,17 +22,21 @@ type DebeziumForwarder struct {
 	debeziumStream  string
 	subscriberName  string
 	logger          *zap.Logger
-	stopChan        chan bool
+	stopChan        chan struct{}
+	stopOnce        sync.Once
+	runState        runState
 }
 
 type DebeziumMessage struct {
 	Payload struct {
 		Before interface{} `json:"before"`
 		After  struct {
-			ID        string `json:"id"`
-			Topic     string `json:"topic"`
-			Payload   []byte `json:"payload"`
-			CreatedAt int64  `json:"created_at"`
+			ID            string `json:"id"`
+			Topic         string `json:"topic"`
+			Payload       []byte `json:"payload"`
+			CreatedAt     int64  `json:"created_at"`
+			CausationID   string `json:"causation_id"`
+			CorrelationID string `json:"correlation_id"`
 		} `json:"after"`
 		Source struct {
 			Version   string      `json:"version"`
@@ -73,12 +78,14 @@ func NewDebeziumForwarder(db db.DB, bus bus.Bus, options *DebeziumOptions) (*Deb
 		debeziumStream:  options.DebeziumStream,
 		subscriberName:  options.SubscriberName,
 		logger:          options.Logger,
-		stopChan:        make(chan bool),
+		stopChan:        make(chan struct{}),
 	}, nil
 }
 
 func (fw *DebeziumForwarder) Stop() error {
-	fw.stopChan <- true
+	fw.stopOnce.Do(func() {
+		close(fw.stopChan)
+	})
 	return nil
 }
 
@@ -97,17 +104,27 @@ func (fw *DebeziumForwarder) Start(ctx context.Context) error {
 			return fmt.Errorf("failed to unmarshal debezium message: %w", err)
 		}
 
-		return fw.processDebeziumMessage(ctx, debeziumMessage)
+		if err := fw.processDebeziumMessage(ctx, debeziumMessage); err != nil {
+			return err
+		}
+
+		fw.runState.polled()
+		return nil
 	}); err != nil {
 		fw.logger.Sugar().Errorf("failed to emit event: %s", err.Error())
-		return fmt.Errorf("failed to add handler to debezium stream: %w", err)
+		return fmt.Errorf("%w: failed to add handler to debezium stream: %w", ErrFatal, err)
 	}
 
+	fw.runState.start()
+	defer fw.runState.stop()
+
 	subscription.Start(ctx)
 
-	for range fw.stopChan {
-		subscription.Stop()
+	select {
+	case <-fw.stopChan:
+	case <-ctx.Done():
 	}
+	subscription.Stop()
 
 	return nil
 }
@@ -119,9 +136,11 @@ func (fw *DebeziumForwarder) processDebeziumMessage(ctx context.Context, message
 
 	event := &events.SerializedEvent{
 		Metadata: &events.EventMetadata{
-			Id:        events.EventID(message.Payload.After.ID),
-			Topic:     message.Payload.After.Topic,
-			CreatedAt: time.Unix(0, message.Payload.After.CreatedAt),
+			Id:            events.EventID(message.Payload.After.ID),
+			Topic:         message.Payload.After.Topic,
+			CreatedAt:     time.Unix(0, message.Payload.After.CreatedAt),
+			CausationId:   message.Payload.After.CausationID,
+			CorrelationId: message.Payload.After.CorrelationID,
 		},
 		SerializedPayload: message.Payload.After.Payload,
 	}
@@ -140,13 +159,7 @@ func (fw *DebeziumForwarder) processDebeziumMessage(ctx context.Context, message
 }
 
 func (fw *DebeziumForwarder) emitEvent(ctx context.Context, event *events.SerializedEvent) error {
-	message := &bus.OutboundMessage{
-		Id:      event.Metadata.Id.String(),
-		Subject: event.Metadata.Topic,
-		Data:    event.SerializedPayload,
-	}
-
-	return fw.bus.Publish(ctx, message)
+	return fw.bus.Publish(ctx, newOutboundMessage(event))
 }
 
 func (fw *DebeziumForwarder) removeEvent(ctx context.Context, tableName string, eventID events.EventID) error {
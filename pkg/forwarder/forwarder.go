@@ -1,8 +1,40 @@
 package forwarder
 
-import "context"
+import (
+	"context"
+	"errors"
+
+	"github.com/vectrum-io/strongforce/pkg/bus"
+	"github.com/vectrum-io/strongforce/pkg/events"
+)
+
+// ErrFatal marks errors returned by Start that restarting the forwarder
+// cannot fix, such as invalid configuration.
+var ErrFatal = errors.New("fatal forwarder error")
 
 type Forwarder interface {
 	Stop() error
 	Start(ctx context.Context) error
 }
+
+// newOutboundMessage maps an outbox event onto a bus message. Headers stay nil
+// unless the event carries causation metadata.
+func newOutboundMessage(event *events.SerializedEvent) *bus.OutboundMessage {
+	message := &bus.OutboundMessage{
+		Id:      event.Metadata.Id.String(),
+		Subject: event.Metadata.Topic,
+		Data:    event.SerializedPayload,
+	}
+
+	if event.Metadata.CausationId != "" || event.Metadata.CorrelationId != "" {
+		message.Headers = map[string]string{}
+		if event.Metadata.CausationId != "" {
+			message.Headers[bus.CausationIdHeader] = event.Metadata.CausationId
+		}
+		if event.Metadata.CorrelationId != "" {
+			message.Headers[bus.CorrelationIdHeader] = event.Metadata.CorrelationId
+		}
+	}
+
+	return message
+}
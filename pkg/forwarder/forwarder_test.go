@@ -0,0 +1,34 @@
+package forwarder
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vectrum-io/strongforce/pkg/bus"
+	"github.com/vectrum-io/strongforce/pkg/events"
+)
+
+func TestNewOutboundMessageWithoutCausation(t *testing.T) {
+	message := newOutboundMessage(&events.SerializedEvent{
+		Metadata:          &events.EventMetadata{Id: events.EventID("1"), Topic: "t"},
+		SerializedPayload: []byte{1},
+	})
+
+	assert.Equal(t, "1", message.Id)
+	assert.Equal(t, "t", message.Subject)
+	assert.Nil(t, message.Headers)
+}
+
+func TestNewOutboundMessageWithCausation(t *testing.T) {
+	message := newOutboundMessage(&events.SerializedEvent{
+		Metadata: &events.EventMetadata{
+			Id:            events.EventID("2"),
+			Topic:         "t",
+			CausationId:   "1",
+			CorrelationId: "0",
+		},
+	})
+
+	assert.Equal(t, "1", message.Headers[bus.CausationIdHeader])
+	assert.Equal(t, "0", message.Headers[bus.CorrelationIdHeader])
+}
@@ -29,6 +29,10 @@ type Metrics struct {
 
 	OutboxDepth        metric.Int64Gauge
 	EmitLatencySeconds metric.Float64Histogram
+
+	LeadershipAcquired metric.Int64Counter
+	LeadershipLost     metric.Int64Counter
+	Leader             metric.Int64Gauge
 }
 
 // NewMetrics constructs the forwarder's OTel instruments against the provided
@@ -112,6 +116,28 @@ func NewMetrics(mp metric.MeterProvider) (*Metrics, error) {
 		return nil, err
 	}
 
+	leadershipAcquired, err := meter.Int64Counter(
+		"strongforce.forwarder.leadership.acquired",
+		metric.WithDescription("Times this replica became the leader that polls the outbox."),
+	)
+	if err != nil {
+		return nil, err
+	}
+	leadershipLost, err := meter.Int64Counter(
+		"strongforce.forwarder.leadership.lost",
+		metric.WithDescription("Times this replica lost leadership before stopping, e.g. because its lease could not be renewed."),
+	)
+	if err != nil {
+		return nil, err
+	}
+	leaderGauge, err := meter.Int64Gauge(
+		"strongforce.forwarder.leader",
+		metric.WithDescription("1 while this replica is the leader that polls the outbox, 0 otherwise."),
+	)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Metrics{
 		DirectEnqueued:     directEnqueued,
 		DirectPublished:    directPublished,
@@ -122,6 +148,9 @@ func NewMetrics(mp metric.MeterProvider) (*Metrics, error) {
 		PollerFailed:       pollerFailed,
 		OutboxDepth:        outboxDepth,
 		EmitLatencySeconds: emitLatency,
+		LeadershipAcquired: leadershipAcquired,
+		LeadershipLost:     leadershipLost,
+		Leader:             leaderGauge,
 	}, nil
 }
 
@@ -159,9 +188,9 @@ func (m *Metrics) incDirectDeleteFailed(ctx context.Context) {
 	}
 }
 
-func (m *Metrics) incPollerPublished(ctx context.Context) {
+func (m *Metrics) addPollerPublished(ctx context.Context, n int) {
 	if m != nil {
-		m.PollerPublished.Add(ctx, 1)
+		m.PollerPublished.Add(ctx, int64(n))
 	}
 }
 
@@ -182,3 +211,22 @@ func (m *Metrics) observeEmitLatency(ctx context.Context, seconds float64) {
 		m.EmitLatencySeconds.Record(ctx, seconds)
 	}
 }
+
+func (m *Metrics) incLeadershipAcquired(ctx context.Context) {
+	if m != nil {
+		m.LeadershipAcquired.Add(ctx, 1)
+		m.Leader.Record(ctx, 1)
+	}
+}
+
+func (m *Metrics) incLeadershipLost(ctx context.Context) {
+	if m != nil {
+		m.LeadershipLost.Add(ctx, 1)
+	}
+}
+
+func (m *Metrics) setFollower(ctx context.Context) {
+	if m != nil {
+		m.Leader.Record(ctx, 0)
+	}
+}
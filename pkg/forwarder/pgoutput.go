@@ -0,0 +1,368 @@
+package forwarder
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/vectrum-io/strongforce/pkg/events"
+	"github.com/vectrum-io/strongforce/pkg/outbox"
+)
+
+var errMalformedMessage = errors.New("malformed pgoutput message")
+
+// pgoutput message types of protocol version 1. Other types are skipped.
+const (
+	pgoutputBeginMessage    = 'B'
+	pgoutputCommitMessage   = 'C'
+	pgoutputRelationMessage = 'R'
+	pgoutputInsertMessage   = 'I'
+	pgoutputLogicalMessage  = 'M'
+)
+
+// pgoutput tuple column kinds.
+const (
+	pgoutputNull           = 'n'
+	pgoutputUnchangedTOAST = 'u'
+	pgoutputText           = 't'
+)
+
+// replicatedTx is a committed transaction's outbox events.
+type replicatedTx struct {
+	events []*events.SerializedEvent
+	// err is why an event of the transaction could not be decoded. Such a
+	// transaction is not forwarded or confirmed.
+	err error
+	// endLSN is where the transaction's commit record ends. Confirming it
+	// skips the transaction on the next read.
+	endLSN uint64
+}
+
+type pgoutputRelation struct {
+	namespace string
+	name      string
+	columns   []string
+}
+
+// pgoutputDecoder decodes pgoutput messages into outbox inserts, or with a
+// message prefix into the logical messages an outbox emitted instead.
+// Relation messages are only sent once per session, so a decoder must only be
+// used with changes read on a single connection.
+type pgoutputDecoder struct {
+	table         string
+	messagePrefix string
+	relations     map[uint32]*pgoutputRelation
+	current       *replicatedTx
+}
+
+func newPgoutputDecoder(table, messagePrefix string) *pgoutputDecoder {
+	return &pgoutputDecoder{
+		table:         table,
+		messagePrefix: messagePrefix,
+		relations:     map[uint32]*pgoutputRelation{},
+	}
+}
+
+// decode consumes one message. It returns the transaction once its commit
+// is decoded and nil otherwise.
+func (d *pgoutputDecoder) decode(data []byte) (*replicatedTx, error) {
+	if len(data) == 0 {
+		return nil, errMalformedMessage
+	}
+
+	r := &pgoutputReader{data: data[1:]}
+	switch data[0] {
+	case pgoutputBeginMessage:
+		d.current = &replicatedTx{}
+		return nil, nil
+	case pgoutputCommitMessage:
+		// flags and commit LSN
+		r.uint8()
+		r.uint64()
+		endLSN := r.uint64()
+		if r.err != nil {
+			return nil, r.err
+		}
+		if d.current == nil {
+			return nil, fmt.Errorf("%w: commit without begin", errMalformedMessage)
+		}
+		tx := d.current
+		tx.endLSN = endLSN
+		d.current = nil
+		return tx, nil
+	case pgoutputRelationMessage:
+		return nil, d.decodeRelation(r)
+	case pgoutputInsertMessage:
+		return nil, d.decodeInsert(r)
+	case pgoutputLogicalMessage:
+		return nil, d.decodeLogicalMessage(r)
+	default:
+		return nil, nil
+	}
+}
+
+func (d *pgoutputDecoder) decodeRelation(r *pgoutputReader) error {
+	relationID := r.uint32()
+	relation := &pgoutputRelation{
+		namespace: r.string(),
+		name:      r.string(),
+	}
+	// replica identity
+	r.uint8()
+	columnCount := r.uint16()
+	for i := 0; i < int(columnCount) && r.err == nil; i++ {
+		// flags
+		r.uint8()
+		relation.columns = append(relation.columns, r.string())
+		// type oid and modifier
+		r.uint32()
+		r.uint32()
+	}
+	if r.err != nil {
+		return r.err
+	}
+
+	d.relations[relationID] = relation
+	return nil
+}
+
+func (d *pgoutputDecoder) decodeInsert(r *pgoutputReader) error {
+	relationID := r.uint32()
+	if kind := r.uint8(); r.err == nil && kind != 'N' {
+		return fmt.Errorf("%w: unexpected tuple kind %q", errMalformedMessage, kind)
+	}
+	values, err := r.tuple()
+	if err != nil {
+		return err
+	}
+
+	relation, ok := d.relations[relationID]
+	if !ok {
+		return fmt.Errorf("%w: insert into unknown relation %d", errMalformedMessage, relationID)
+	}
+	if d.messagePrefix != "" || !relation.is(d.table) {
+		return nil
+	}
+	if d.current == nil {
+		return fmt.Errorf("%w: insert outside of a transaction", errMalformedMessage)
+	}
+	if len(values) != len(relation.columns) {
+		return fmt.Errorf("%w: %d values for %d columns", errMalformedMessage, len(values), len(relation.columns))
+	}
+
+	entity, err := newReplicatedEvent(relation.columns, values)
+	if err != nil {
+		d.fail(err)
+		return nil
+	}
+	event, err := entity.ToSerializedEvent()
+	if err != nil {
+		d.fail(fmt.Errorf("%w: %w", errMalformedMessage, err))
+		return nil
+	}
+	d.current.events = append(d.current.events, event)
+	return nil
+}
+
+func (d *pgoutputDecoder) decodeLogicalMessage(r *pgoutputReader) error {
+	flags := r.uint8()
+	// message LSN
+	r.uint64()
+	prefix := r.string()
+	length := r.uint32()
+	content := r.next(int(length))
+	if r.err != nil {
+		return r.err
+	}
+
+	// outboxes only emit transactional messages
+	if d.messagePrefix == "" || prefix != d.messagePrefix || flags&1 == 0 {
+		return nil
+	}
+	if d.current == nil {
+		return fmt.Errorf("%w: transactional message outside of a transaction", errMalformedMessage)
+	}
+
+	event, err := outbox.DecodeLogicalMessage(content)
+	if err != nil {
+		d.fail(fmt.Errorf("%w: %w", errMalformedMessage, err))
+		return nil
+	}
+	d.current.events = append(d.current.events, event)
+	return nil
+}
+
+// fail records an event of the current transaction that is well framed but
+// cannot be turned into an event. Decoding goes on, so the transactions
+// before it can still be forwarded.
+func (d *pgoutputDecoder) fail(err error) {
+	if d.current.err == nil {
+		d.current.err = err
+	}
+}
+
+// is reports whether the relation is table, which may be schema qualified.
+func (r *pgoutputRelation) is(table string) bool {
+	if schema, name, ok := strings.Cut(table, "."); ok {
+		return r.namespace == schema && r.name == name
+	}
+	return r.name == table
+}
+
+// newReplicatedEvent maps the text values of an outbox row onto an entity.
+func newReplicatedEvent(columns []string, values []*string) (*outbox.EventEntity, error) {
+	event := &outbox.EventEntity{}
+	for i, column := range columns {
+		value := values[i]
+		if value == nil {
+			continue
+		}
+
+		switch column {
+		case "id":
+			event.Id = sql.NullString{String: *value, Valid: true}
+		case "topic":
+			event.Topic = sql.NullString{String: *value, Valid: true}
+		case "payload":
+			payload, err := decodeBytea(*value)
+			if err != nil {
+				return nil, err
+			}
+			event.Payload = payload
+		case "created_at":
+			event.CreatedAt = parseTimestamp(*value)
+		case "causation_id":
+			event.CausationId = sql.NullString{String: *value, Valid: true}
+		case "correlation_id":
+			event.CorrelationId = sql.NullString{String: *value, Valid: true}
+		}
+	}
+	return event, nil
+}
+
+// decodeBytea decodes the hex output format, which the forwarder selects for
+// its session.
+func decodeBytea(value string) ([]byte, error) {
+	encoded, ok := strings.CutPrefix(value, `\x`)
+	if !ok {
+		return nil, fmt.Errorf("%w: bytea is not hex encoded", errMalformedMessage)
+	}
+	return hex.DecodeString(encoded)
+}
+
+// timestampLayouts are the ISO output formats of timestamp and timestamptz.
+var timestampLayouts = []string{
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999-07",
+	"2006-01-02 15:04:05.999999999-07:00",
+}
+
+func parseTimestamp(value string) sql.NullTime {
+	for _, layout := range timestampLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return sql.NullTime{Time: t, Valid: true}
+		}
+	}
+	return sql.NullTime{}
+}
+
+// pgoutputReader reads big-endian fields and keeps the first error.
+type pgoutputReader struct {
+	data []byte
+	err  error
+}
+
+func (r *pgoutputReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.data) < n {
+		r.err = fmt.Errorf("%w: truncated", errMalformedMessage)
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *pgoutputReader) uint8() uint8 {
+	if b := r.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *pgoutputReader) uint16() uint16 {
+	if b := r.next(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *pgoutputReader) uint32() uint32 {
+	if b := r.next(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *pgoutputReader) uint64() uint64 {
+	if b := r.next(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (r *pgoutputReader) string() string {
+	if r.err != nil {
+		return ""
+	}
+	end := bytes.IndexByte(r.data, 0)
+	if end < 0 {
+		r.err = fmt.Errorf("%w: unterminated string", errMalformedMessage)
+		return ""
+	}
+	s := string(r.data[:end])
+	r.data = r.data[end+1:]
+	return s
+}
+
+// tuple reads tuple data. Null and unchanged TOAST values are nil.
+func (r *pgoutputReader) tuple() ([]*string, error) {
+	count := r.uint16()
+	values := make([]*string, 0, count)
+	for i := 0; i < int(count) && r.err == nil; i++ {
+		switch kind := r.uint8(); kind {
+		case pgoutputNull, pgoutputUnchangedTOAST:
+			values = append(values, nil)
+		case pgoutputText:
+			length := r.uint32()
+			value := string(r.next(int(length)))
+			values = append(values, &value)
+		default:
+			if r.err == nil {
+				r.err = fmt.Errorf("%w: unexpected column kind %q", errMalformedMessage, kind)
+			}
+		}
+	}
+	return values, r.err
+}
+
+// parseLSN parses the text format of pg_lsn.
+func parseLSN(value string) (uint64, error) {
+	var high, low uint32
+	if _, err := fmt.Sscanf(value, "%X/%X", &high, &low); err != nil {
+		return 0, fmt.Errorf("invalid lsn %q: %w", value, err)
+	}
+	return uint64(high)<<32 | uint64(low), nil
+}
+
+// formatLSN formats an LSN the way pg_lsn does.
+func formatLSN(lsn uint64) string {
+	return fmt.Sprintf("%X/%X", uint32(lsn>>32), uint32(lsn))
+}
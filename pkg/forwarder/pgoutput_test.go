@@ -0,0 +1,304 @@
+package forwarder
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vectrum-io/strongforce/pkg/events"
+	"github.com/vectrum-io/strongforce/pkg/outbox"
+)
+
+// pgoutputMessage builds a pgoutput message from big-endian fields. Strings
+// are null terminated.
+type pgoutputMessage []byte
+
+func (m pgoutputMessage) uint8(v uint8) pgoutputMessage {
+	return append(m, v)
+}
+
+func (m pgoutputMessage) uint16(v uint16) pgoutputMessage {
+	return binary.BigEndian.AppendUint16(m, v)
+}
+
+func (m pgoutputMessage) uint32(v uint32) pgoutputMessage {
+	return binary.BigEndian.AppendUint32(m, v)
+}
+
+func (m pgoutputMessage) uint64(v uint64) pgoutputMessage {
+	return binary.BigEndian.AppendUint64(m, v)
+}
+
+func (m pgoutputMessage) string(v string) pgoutputMessage {
+	return append(append(m, v...), 0)
+}
+
+func beginMessage() pgoutputMessage {
+	return pgoutputMessage{'B'}.uint64(0x10).uint64(0).uint32(700)
+}
+
+func commitMessage(endLSN uint64) pgoutputMessage {
+	return pgoutputMessage{'C'}.uint8(0).uint64(endLSN - 8).uint64(endLSN).uint64(0)
+}
+
+func relationMessage(id uint32, namespace, name string, columns ...string) pgoutputMessage {
+	m := pgoutputMessage{'R'}.uint32(id).string(namespace).string(name).uint8('d').uint16(uint16(len(columns)))
+	for _, column := range columns {
+		m = m.uint8(0).string(column).uint32(25).uint32(0xffffffff)
+	}
+	return m
+}
+
+// insertMessage encodes nil values as NULL.
+func insertMessage(relationID uint32, values ...*string) pgoutputMessage {
+	m := pgoutputMessage{'I'}.uint32(relationID).uint8('N').uint16(uint16(len(values)))
+	for _, value := range values {
+		if value == nil {
+			m = m.uint8('n')
+			continue
+		}
+		m = m.uint8('t').uint32(uint32(len(*value)))
+		m = append(m, *value...)
+	}
+	return m
+}
+
+func logicalMessage(transactional bool, prefix string, content []byte) pgoutputMessage {
+	var flags uint8
+	if transactional {
+		flags = 1
+	}
+	m := pgoutputMessage{'M'}.uint8(flags).uint64(0x10).string(prefix).uint32(uint32(len(content)))
+	return append(m, content...)
+}
+
+func text(s string) *string {
+	return &s
+}
+
+func TestPgoutputDecoder(t *testing.T) {
+	decoder := newPgoutputDecoder("event_outbox", "")
+
+	messages := []pgoutputMessage{
+		beginMessage(),
+		relationMessage(1, "public", "event_outbox", "id", "topic", "payload", "created_at", "causation_id"),
+		relationMessage(2, "public", "other", "id"),
+		insertMessage(1, text("01J"), text("orders.created"), text(`\x452a00`), text("2024-02-20 23:21:51.123456"), nil),
+		insertMessage(2, text("ignored")),
+		insertMessage(1, text("01K"), text("orders.paid"), text(`\x`), text("2024-02-20 23:21:52+00"), text("01J")),
+	}
+	for _, message := range messages {
+		tx, err := decoder.decode(message)
+		assert.NoError(t, err)
+		assert.Nil(t, tx)
+	}
+
+	tx, err := decoder.decode(commitMessage(0x1_0000_00A0))
+	assert.NoError(t, err)
+	if !assert.NotNil(t, tx) {
+		return
+	}
+	assert.Equal(t, uint64(0x1_0000_00A0), tx.endLSN)
+	if !assert.Len(t, tx.events, 2) {
+		return
+	}
+
+	first := tx.events[0]
+	assert.Equal(t, "01J", first.Metadata.Id.String())
+	assert.Equal(t, "orders.created", first.Metadata.Topic)
+	assert.Equal(t, []byte{0x45, 0x2a, 0x00}, first.SerializedPayload)
+	assert.Equal(t, time.Date(2024, 2, 20, 23, 21, 51, 123456000, time.UTC), first.Metadata.CreatedAt)
+	assert.Empty(t, first.Metadata.CausationId)
+
+	second := tx.events[1]
+	assert.Equal(t, []byte{}, second.SerializedPayload)
+	assert.Equal(t, "01J", second.Metadata.CausationId)
+	assert.True(t, second.Metadata.CreatedAt.Equal(time.Date(2024, 2, 20, 23, 21, 52, 0, time.UTC)))
+}
+
+func TestPgoutputDecoderSchemaQualifiedTable(t *testing.T) {
+	decoder := newPgoutputDecoder("strongforce.event_outbox", "")
+
+	for _, message := range []pgoutputMessage{
+		beginMessage(),
+		relationMessage(1, "public", "event_outbox", "id"),
+		relationMessage(2, "strongforce", "event_outbox", "id"),
+		insertMessage(1, text("public")),
+		insertMessage(2, text("strongforce")),
+	} {
+		_, err := decoder.decode(message)
+		assert.NoError(t, err)
+	}
+
+	tx, err := decoder.decode(commitMessage(0x100))
+	assert.NoError(t, err)
+	if assert.Len(t, tx.events, 1) {
+		assert.Equal(t, "strongforce", tx.events[0].Metadata.Id.String())
+	}
+}
+
+func TestPgoutputDecoderLogicalMessages(t *testing.T) {
+	decoder := newPgoutputDecoder("event_outbox", "outbox")
+
+	createdAt := time.Date(2024, 2, 20, 23, 21, 51, 123456000, time.UTC)
+	content, err := outbox.EncodeLogicalMessage(&events.SerializedEvent{
+		Metadata: &events.EventMetadata{
+			Id:            "01J",
+			Topic:         "orders.created",
+			CreatedAt:     createdAt,
+			CausationId:   "01I",
+			CorrelationId: "01H",
+		},
+		SerializedPayload: []byte{0x45, 0x2a, 0x00},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for _, message := range []pgoutputMessage{
+		beginMessage(),
+		logicalMessage(true, "outbox", content),
+		logicalMessage(true, "other", content),
+		logicalMessage(false, "outbox", content),
+		// inserts into the outbox table are not forwarded with messages
+		relationMessage(1, "public", "event_outbox", "id"),
+		insertMessage(1, text("01K")),
+	} {
+		tx, err := decoder.decode(message)
+		assert.NoError(t, err)
+		assert.Nil(t, tx)
+	}
+
+	tx, err := decoder.decode(commitMessage(0x100))
+	assert.NoError(t, err)
+	if !assert.NotNil(t, tx) || !assert.Len(t, tx.events, 1) {
+		return
+	}
+	assert.Equal(t, &events.SerializedEvent{
+		Metadata: &events.EventMetadata{
+			Id:            "01J",
+			Topic:         "orders.created",
+			CreatedAt:     createdAt,
+			CausationId:   "01I",
+			CorrelationId: "01H",
+		},
+		SerializedPayload: []byte{0x45, 0x2a, 0x00},
+	}, tx.events[0])
+}
+
+func TestPgoutputDecoderMalformed(t *testing.T) {
+	tests := map[string][]pgoutputMessage{
+		"empty":                {{}},
+		"truncated commit":     {beginMessage(), pgoutputMessage{'C'}.uint8(0)},
+		"commit without begin": {commitMessage(0x100)},
+		"unknown relation":     {beginMessage(), insertMessage(1, text("01J"))},
+		"column count mismatch": {
+			beginMessage(),
+			relationMessage(1, "public", "event_outbox", "id", "topic"),
+			insertMessage(1, text("01J")),
+		},
+	}
+
+	for name, messages := range tests {
+		t.Run(name, func(t *testing.T) {
+			decoder := newPgoutputDecoder("event_outbox", "")
+
+			var err error
+			for _, message := range messages {
+				if _, err = decoder.decode(message); err != nil {
+					break
+				}
+			}
+			assert.ErrorIs(t, err, errMalformedMessage)
+		})
+	}
+}
+
+func TestPgoutputDecoderMalformedLogicalMessages(t *testing.T) {
+	tests := map[string][]pgoutputMessage{
+		"outside of a transaction": {logicalMessage(true, "outbox", []byte(`{"id":"01J"}`))},
+		"truncated":                {beginMessage(), logicalMessage(true, "outbox", []byte("{}"))[:12]},
+	}
+
+	for name, messages := range tests {
+		t.Run(name, func(t *testing.T) {
+			decoder := newPgoutputDecoder("event_outbox", "outbox")
+
+			var err error
+			for _, message := range messages {
+				if _, err = decoder.decode(message); err != nil {
+					break
+				}
+			}
+			assert.ErrorIs(t, err, errMalformedMessage)
+		})
+	}
+}
+
+func TestPgoutputDecoderMarksUndecodableTransactions(t *testing.T) {
+	tests := map[string]struct {
+		messagePrefix string
+		messages      []pgoutputMessage
+	}{
+		"escaped bytea": {
+			messages: []pgoutputMessage{
+				relationMessage(1, "public", "event_outbox", "id", "topic", "payload"),
+				insertMessage(1, text("01J"), text("orders"), text(`E\000`)),
+			},
+		},
+		"insert without id": {
+			messages: []pgoutputMessage{
+				relationMessage(1, "public", "event_outbox", "id", "topic", "payload"),
+				insertMessage(1, nil, text("orders"), text(`\x45`)),
+			},
+		},
+		"logical message without id": {
+			messagePrefix: "outbox",
+			messages:      []pgoutputMessage{logicalMessage(true, "outbox", []byte(`{"topic":"orders"}`))},
+		},
+		"undecodable logical message": {
+			messagePrefix: "outbox",
+			messages:      []pgoutputMessage{logicalMessage(true, "outbox", []byte("{"))},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			decoder := newPgoutputDecoder("event_outbox", test.messagePrefix)
+
+			_, err := decoder.decode(beginMessage())
+			assert.NoError(t, err)
+			for _, message := range test.messages {
+				_, err := decoder.decode(message)
+				if !assert.NoError(t, err) {
+					return
+				}
+			}
+
+			// the transaction is decoded to its end, so the ones before it
+			// can still be forwarded
+			tx, err := decoder.decode(commitMessage(0x100))
+			if !assert.NoError(t, err) || !assert.NotNil(t, tx) {
+				return
+			}
+			assert.Empty(t, tx.events)
+			assert.ErrorIs(t, tx.err, errMalformedMessage)
+			assert.Equal(t, uint64(0x100), tx.endLSN)
+		})
+	}
+}
+
+func TestParseLSN(t *testing.T) {
+	lsn, err := parseLSN("16/B374D848")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0x16_B374D848), lsn)
+
+	_, err = parseLSN("B374D848")
+	assert.Error(t, err)
+}
+
+func TestFormatLSN(t *testing.T) {
+	assert.Equal(t, "16/B374D848", formatLSN(0x16_B374D848))
+	assert.Equal(t, "0/0", formatLSN(0))
+}
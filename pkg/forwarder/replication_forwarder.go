@@ -0,0 +1,400 @@
+package forwarder
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/vectrum-io/strongforce/pkg/bus"
+	"github.com/vectrum-io/strongforce/pkg/db"
+	"github.com/vectrum-io/strongforce/pkg/events"
+	"go.uber.org/zap"
+)
+
+// pgDuplicateObject is the SQLSTATE of creating a publication or slot that
+// another replica created first.
+const pgDuplicateObject = "42710"
+
+// replicationSessionSettings fix the text formats the decoder parses.
+var replicationSessionSettings = []string{
+	"SET bytea_output = 'hex'",
+	"SET DateStyle = 'ISO'",
+	"SET TimeZone = 'UTC'",
+}
+
+// ReplicationForwarder forwards outbox inserts from a Postgres logical
+// replication slot using the pgoutput plugin, instead of polling the outbox
+// table. It does not stream over a replication connection: every
+// PollingInterval it reads new changes with
+// pg_logical_slot_peek_binary_changes, the SQL interface to logical
+// decoding, which requires wal_level = logical and a role with the
+// REPLICATION attribute. A transaction's events are published in order, then deleted
+// from the outbox and only then confirmed, so the slot resumes after the
+// last forwarded transaction when the forwarder restarts. Delivery is at
+// least once.
+//
+// With ReplicationOptions.MessagePrefix the forwarder forwards the logical
+// messages of an outbox that emits events instead of inserting them, which
+// leaves no rows to delete.
+//
+// Events already in the outbox when the slot is created are not forwarded.
+// An event that cannot be decoded stops the forwarder with ErrFatal once the
+// transactions before it are forwarded. Its transaction is not confirmed, so
+// nothing is lost, but the slot has to be advanced past it by hand to
+// resume. Only one session can read a slot at a time, so replicas sharing a
+// slot take turns. The slot also advances while the outbox is idle, so it
+// does not retain WAL.
+type ReplicationForwarder struct {
+	db              db.DB
+	bus             bus.Bus
+	slotName        string
+	publicationName string
+	outboxTableName string
+	messagePrefix   string
+	pollingInterval time.Duration
+	batchSize       int
+	logger          *zap.Logger
+	stopChan        chan struct{}
+	stopOnce        sync.Once
+	runState        runState
+}
+
+func NewReplicationForwarder(db db.DB, bus bus.Bus, options *ReplicationOptions) (*ReplicationForwarder, error) {
+	if options == nil {
+		options = &ReplicationOptions{}
+	}
+	if err := options.validate(); err != nil {
+		return nil, fmt.Errorf("failed to validate options: %w", err)
+	}
+
+	return &ReplicationForwarder{
+		db:              db,
+		bus:             bus,
+		slotName:        options.SlotName,
+		publicationName: options.PublicationName,
+		outboxTableName: options.OutboxTableName,
+		messagePrefix:   options.MessagePrefix,
+		pollingInterval: options.PollingInterval,
+		batchSize:       options.BatchSize,
+		logger:          options.Logger,
+		stopChan:        make(chan struct{}),
+	}, nil
+}
+
+func (fw *ReplicationForwarder) Stop() error {
+	fw.stopOnce.Do(func() {
+		close(fw.stopChan)
+	})
+	return nil
+}
+
+// Start creates the publication and slot if needed, then forwards changes
+// until Stop is called or ctx ends. A stopped forwarder cannot be started
+// again.
+func (fw *ReplicationForwarder) Start(ctx context.Context) error {
+	select {
+	case <-fw.stopChan:
+		return nil
+	default:
+	}
+
+	if driverName := fw.db.Connection().DriverName(); driverName != "postgres" {
+		return fmt.Errorf("%w: logical replication requires postgres, not %s", ErrFatal, driverName)
+	}
+
+	if err := fw.setup(ctx); err != nil {
+		return fmt.Errorf("failed to set up replication: %w", err)
+	}
+
+	fw.runState.start()
+	defer fw.runState.stop()
+
+	session := &replicationSession{}
+	defer session.close()
+
+	ticker := time.NewTicker(fw.pollingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := fw.forward(ctx, session); err != nil {
+				return err
+			}
+		case <-fw.stopChan:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (fw *ReplicationForwarder) setup(ctx context.Context) error {
+	connection := fw.db.Connection()
+
+	if fw.messagePrefix != "" {
+		var version int
+		if err := connection.GetContext(ctx, &version, "SELECT current_setting('server_version_num')::int"); err != nil {
+			return fmt.Errorf("failed to read server version: %w", err)
+		}
+		// pgoutput decodes logical messages since Postgres 14
+		if version < 140000 {
+			return fmt.Errorf("%w: forwarding logical messages requires postgres 14 or later", ErrFatal)
+		}
+	}
+
+	var publications int
+	if err := connection.GetContext(ctx, &publications, connection.Rebind("SELECT COUNT(*) FROM pg_publication WHERE pubname = ?"), fw.publicationName); err != nil {
+		return fmt.Errorf("failed to look up publication: %w", err)
+	}
+	if publications == 0 {
+		//goland:noinspection SqlNoDataSourceInspection
+		query := fmt.Sprintf("CREATE PUBLICATION %s FOR TABLE %s WITH (publish = 'insert')", pq.QuoteIdentifier(fw.publicationName), fw.outboxTableName)
+		if fw.messagePrefix != "" {
+			// pgoutput requires a publication, but messages are not tied to
+			// tables
+			query = fmt.Sprintf("CREATE PUBLICATION %s", pq.QuoteIdentifier(fw.publicationName))
+		}
+		if _, err := connection.ExecContext(ctx, query); err != nil && !isPgDuplicateObject(err) {
+			return fmt.Errorf("failed to create publication: %w", err)
+		}
+		fw.logger.Sugar().Infof("created publication %s", fw.publicationName)
+	}
+
+	var slot struct {
+		Plugin    sql.NullString `db:"plugin"`
+		Confirmed sql.NullString `db:"confirmed_flush_lsn"`
+	}
+	err := connection.GetContext(ctx, &slot, connection.Rebind("SELECT plugin, confirmed_flush_lsn FROM pg_replication_slots WHERE slot_name = ?"), fw.slotName)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		if _, err := connection.ExecContext(ctx, connection.Rebind("SELECT pg_create_logical_replication_slot(?, 'pgoutput')"), fw.slotName); err != nil && !isPgDuplicateObject(err) {
+			return fmt.Errorf("failed to create replication slot: %w", err)
+		}
+		fw.logger.Sugar().Infof("created replication slot %s", fw.slotName)
+
+		// the slot only sees changes made after it was created
+		if fw.messagePrefix == "" {
+			if outbox, err := outboxStatus(ctx, fw.db, fw.outboxTableName); err == nil && outbox.Depth > 0 {
+				fw.logger.Sugar().Warnf("%d events in %s predate replication slot %s and are not forwarded by it", outbox.Depth, fw.outboxTableName, fw.slotName)
+			}
+		}
+	case err != nil:
+		return fmt.Errorf("failed to look up replication slot: %w", err)
+	case slot.Plugin.String != "pgoutput":
+		return fmt.Errorf("%w: replication slot %s uses plugin %s, not pgoutput", ErrFatal, fw.slotName, slot.Plugin.String)
+	default:
+		fw.logger.Sugar().Infof("resuming replication slot %s at %s", fw.slotName, slot.Confirmed.String)
+	}
+
+	return nil
+}
+
+func isPgDuplicateObject(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == pgDuplicateObject
+}
+
+// replicationSession is the connection changes are read on, with the decoder
+// that tracks the relations sent on it.
+type replicationSession struct {
+	conn    *sqlx.Conn
+	decoder *pgoutputDecoder
+}
+
+// close discards the connection rather than returning it to the pool, so
+// its settings and the relations pgoutput sent on it die with the session.
+func (s *replicationSession) close() {
+	if s.conn != nil {
+		_ = s.conn.Raw(func(any) error {
+			return driver.ErrBadConn
+		})
+		_ = s.conn.Close()
+	}
+	s.conn = nil
+	s.decoder = nil
+}
+
+func (fw *ReplicationForwarder) open(ctx context.Context, session *replicationSession) error {
+	conn, err := fw.db.Connection().Connx(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+
+	for _, setting := range replicationSessionSettings {
+		if _, err := conn.ExecContext(ctx, setting); err != nil {
+			_ = conn.Close()
+			return fmt.Errorf("failed to configure session: %w", err)
+		}
+	}
+
+	session.conn = conn
+	session.decoder = newPgoutputDecoder(fw.outboxTableName, fw.messagePrefix)
+	return nil
+}
+
+// forward forwards batches back to back while they come back full. Reading
+// errors discard the session, so the next tick starts over on a new one.
+// Only errors wrapping ErrFatal are returned.
+func (fw *ReplicationForwarder) forward(ctx context.Context, session *replicationSession) error {
+	for {
+		if session.conn == nil {
+			if err := fw.open(ctx, session); err != nil {
+				fw.logger.Sugar().Warnf("failed to open replication session: %s", err.Error())
+				return nil
+			}
+		}
+
+		more, err := fw.forwardBatch(ctx, session)
+		if err != nil {
+			session.close()
+			if errors.Is(err, ErrFatal) {
+				return err
+			}
+			fw.logger.Sugar().Warnf("failed to forward replicated events: %s", err.Error())
+			return nil
+		}
+		fw.runState.polled()
+
+		if !more || ctx.Err() != nil {
+			return nil
+		}
+		select {
+		case <-fw.stopChan:
+			return nil
+		default:
+		}
+	}
+}
+
+// forwardBatch publishes the transactions of one batch of changes and
+// confirms those that were published entirely. It reports whether the batch
+// was full and forwarded entirely, i.e. whether more changes are likely
+// waiting. Publish failures are logged and retried on the next tick, a
+// transaction that cannot be decoded fails with ErrFatal after the ones
+// before it are confirmed.
+func (fw *ReplicationForwarder) forwardBatch(ctx context.Context, session *replicationSession) (bool, error) {
+	// Changes are only read up to the current end of the WAL. Once all of
+	// them are forwarded the slot is advanced there, even if none of them
+	// were outbox events, so an idle outbox does not retain WAL.
+	var currentLSN string
+	if err := session.conn.GetContext(ctx, &currentLSN, "SELECT pg_current_wal_lsn()"); err != nil {
+		return false, fmt.Errorf("failed to read current wal lsn: %w", err)
+	}
+	upto, err := parseLSN(currentLSN)
+	if err != nil {
+		return false, err
+	}
+
+	txs, changes, err := fw.readChanges(ctx, session, currentLSN)
+	if err != nil {
+		return false, err
+	}
+
+	full := changes >= fw.batchSize
+	forwarded := true
+	var (
+		confirmed   uint64
+		published   []events.EventID
+		undecodable error
+	)
+	for _, tx := range txs {
+		if tx.err != nil {
+			undecodable = fmt.Errorf("%w: transaction ending at %s cannot be forwarded: %w", ErrFatal, formatLSN(tx.endLSN), tx.err)
+			forwarded = false
+			break
+		}
+		ids, ok := publishInOrder(ctx, fw.bus, fw.logger, tx.events)
+		if !ok {
+			forwarded = false
+			break
+		}
+		published = append(published, ids...)
+		confirmed = tx.endLSN
+	}
+
+	// a partial batch read every transaction committed before upto
+	if forwarded && !full {
+		confirmed = max(confirmed, upto)
+	}
+
+	if confirmed == 0 {
+		return false, undecodable
+	}
+
+	// logical messages leave nothing to delete
+	if len(published) > 0 && fw.messagePrefix == "" {
+		query, args, err := sqlx.In(fmt.Sprintf("DELETE FROM %s WHERE id IN (?)", fw.outboxTableName), published)
+		if err != nil {
+			return false, fmt.Errorf("failed to construct deletion query: %w", err)
+		}
+		if _, err := session.conn.ExecContext(ctx, session.conn.Rebind(query), args...); err != nil {
+			return false, fmt.Errorf("failed to delete published events: %w", err)
+		}
+	}
+
+	if _, err := session.conn.ExecContext(ctx, session.conn.Rebind("SELECT pg_replication_slot_advance(?, ?::pg_lsn)"), fw.slotName, formatLSN(confirmed)); err != nil {
+		return false, fmt.Errorf("failed to confirm %s: %w", formatLSN(confirmed), err)
+	}
+	if undecodable != nil {
+		return false, undecodable
+	}
+
+	return full && forwarded, nil
+}
+
+// readChanges peeks at the next changes committed before upto without
+// consuming them, so they are read again until confirmed. It returns the
+// committed transactions and how many changes were read. Changes that cannot
+// be decoded at all fail the forwarder with ErrFatal, because the slot would
+// return them again on every read.
+func (fw *ReplicationForwarder) readChanges(ctx context.Context, session *replicationSession, upto string) ([]*replicatedTx, int, error) {
+	query := `
+		SELECT data
+		FROM pg_logical_slot_peek_binary_changes(?, ?::pg_lsn, ?, 'proto_version', '1', 'publication_names', ?)
+	`
+	if fw.messagePrefix != "" {
+		// Postgres before 14 rejects the option, even when false
+		query = `
+			SELECT data
+			FROM pg_logical_slot_peek_binary_changes(?, ?::pg_lsn, ?, 'proto_version', '1', 'publication_names', ?, 'messages', 'true')
+		`
+	}
+
+	rows, err := session.conn.QueryxContext(ctx, session.conn.Rebind(query), fw.slotName, upto, fw.batchSize, fw.publicationName)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read changes: %w", err)
+	}
+	defer rows.Close()
+
+	var (
+		txs     []*replicatedTx
+		changes int
+	)
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan change: %w", err)
+		}
+		changes++
+
+		tx, err := session.decoder.decode(data)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%w: failed to decode change: %w", ErrFatal, err)
+		}
+		if tx != nil {
+			txs = append(txs, tx)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to read changes: %w", err)
+	}
+
+	return txs, changes, nil
+}
@@ -0,0 +1,65 @@
+package forwarder
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultReplicationSlot        = "strongforce_outbox"
+	DefaultReplicationPublication = "strongforce_outbox"
+)
+
+type ReplicationOptions struct {
+	// SlotName is the logical replication slot that tracks which changes
+	// were forwarded. It is created on start if it does not exist. Defaults
+	// to DefaultReplicationSlot.
+	SlotName string
+	// PublicationName selects the replicated tables. It is created for the
+	// outbox table's inserts on start if it does not exist. Defaults to
+	// DefaultReplicationPublication.
+	PublicationName string
+	OutboxTableName string
+	// MessagePrefix makes the forwarder forward the logical messages that
+	// outboxes with the same outbox.Options.LogicalMessagePrefix emit,
+	// instead of outbox inserts. The publication is then created without
+	// tables. Requires Postgres 14 or later.
+	MessagePrefix string
+	// PollingInterval is how often new changes are read from the slot.
+	// Defaults to DefaultPollingInterval.
+	PollingInterval time.Duration
+	// BatchSize bounds how many changes are read at once. Transactions are
+	// never split, so a batch can exceed it. Full batches are followed
+	// immediately by the next one. Defaults to DefaultBatchSize.
+	BatchSize int
+	Logger    *zap.Logger
+}
+
+func (o *ReplicationOptions) validate() error {
+	if o.SlotName == "" {
+		o.SlotName = DefaultReplicationSlot
+	}
+
+	if o.PublicationName == "" {
+		o.PublicationName = DefaultReplicationPublication
+	}
+
+	if o.OutboxTableName == "" {
+		o.OutboxTableName = DefaultOptions.OutboxTableName
+	}
+
+	if o.PollingInterval <= 0 {
+		o.PollingInterval = DefaultOptions.PollingInterval
+	}
+
+	if o.BatchSize <= 0 {
+		o.BatchSize = DefaultOptions.BatchSize
+	}
+
+	if o.Logger == nil {
+		o.Logger = zap.L()
+	}
+
+	return nil
+}
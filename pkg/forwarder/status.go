@@ -0,0 +1,176 @@
+package forwarder
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/vectrum-io/strongforce/pkg/db"
+)
+
+// Status is a point-in-time view of a forwarder, used by health checks.
+type Status struct {
+	Running bool
+	// Standby is set while the forwarder waits for leadership and does not
+	// poll. See Options.LeaderElector.
+	Standby bool
+	// StartedAt is when the forwarder started polling: when it started or,
+	// with leader election, when it became the leader. Zero while not
+	// running.
+	StartedAt time.Time
+	// LastPollAt is when the forwarder last read the outbox or its
+	// replication slot successfully, or for the Debezium and binlog
+	// forwarders last received a change event or heartbeat. Zero until the
+	// first one.
+	LastPollAt time.Time
+	// EventDriven is set for forwarders that only make progress when a
+	// change event arrives and receive no heartbeats, so an old LastPollAt
+	// only means the outbox is idle.
+	EventDriven bool
+	// Outbox describes the events waiting to be forwarded. Nil if the
+	// forwarder cannot tell.
+	Outbox *OutboxStatus
+}
+
+type OutboxStatus struct {
+	Depth int64
+	// OldestEventAge is the age of the oldest waiting event. Zero when the
+	// outbox is empty.
+	OldestEventAge time.Duration
+}
+
+// StatusReporter is implemented by forwarders that can report their Status.
+type StatusReporter interface {
+	Status(ctx context.Context) (Status, error)
+}
+
+// runState tracks whether a forwarder is running and when it last made
+// progress. It is safe for concurrent use.
+type runState struct {
+	startedAt  atomic.Int64
+	lastPollAt atomic.Int64
+	standby    atomic.Bool
+}
+
+func (rs *runState) start() {
+	rs.startedAt.Store(time.Now().UnixNano())
+}
+
+func (rs *runState) stop() {
+	rs.startedAt.Store(0)
+	rs.standby.Store(false)
+}
+
+func (rs *runState) campaign() {
+	rs.standby.Store(true)
+}
+
+func (rs *runState) lead() {
+	rs.startedAt.Store(time.Now().UnixNano())
+	rs.standby.Store(false)
+}
+
+func (rs *runState) polled() {
+	rs.lastPollAt.Store(time.Now().UnixNano())
+}
+
+func (rs *runState) status() Status {
+	status := Status{}
+	if startedAt := rs.startedAt.Load(); startedAt != 0 {
+		status.Running = true
+		status.Standby = rs.standby.Load()
+		status.StartedAt = time.Unix(0, startedAt)
+	}
+	if lastPollAt := rs.lastPollAt.Load(); lastPollAt != 0 {
+		status.LastPollAt = time.Unix(0, lastPollAt)
+	}
+	return status
+}
+
+// Status reports the forwarder's run state and the depth and oldest event of
+// its outbox table.
+func (fw *DBForwarder) Status(ctx context.Context) (Status, error) {
+	status := fw.runState.status()
+
+	outbox, err := outboxStatus(ctx, fw.db, fw.outboxTableName)
+	if err != nil {
+		return status, err
+	}
+	status.Outbox = outbox
+
+	return status, nil
+}
+
+func outboxStatus(ctx context.Context, database db.DB, tableName string) (*OutboxStatus, error) {
+	var row struct {
+		Depth     int64           `db:"depth"`
+		OldestAge sql.NullFloat64 `db:"oldest_age"`
+	}
+
+	// The age is computed on the database clock that also set created_at, so
+	// the session time zone does not skew it.
+	var oldestAge string
+	switch database.Connection().DriverName() {
+	case "mysql":
+		oldestAge = "TIMESTAMPDIFF(MICROSECOND, MIN(created_at), CURRENT_TIMESTAMP(6)) / 1000000"
+	case "postgres":
+		oldestAge = "EXTRACT(EPOCH FROM CURRENT_TIMESTAMP - MIN(created_at))"
+	default:
+		return nil, fmt.Errorf("unsupported database driver: %s", database.Connection().DriverName())
+	}
+
+	//goland:noinspection SqlNoDataSourceInspection
+	q := fmt.Sprintf("SELECT COUNT(*) AS depth, %s AS oldest_age FROM %s", oldestAge, tableName)
+	if err := database.Connection().GetContext(ctx, &row, q); err != nil {
+		return nil, fmt.Errorf("failed to query outbox status: %w", err)
+	}
+
+	outbox := &OutboxStatus{Depth: row.Depth}
+	if row.OldestAge.Valid {
+		outbox.OldestEventAge = max(time.Duration(row.OldestAge.Float64*float64(time.Second)), 0)
+	}
+
+	return outbox, nil
+}
+
+// Status reports the forwarder's run state. The outbox is drained through
+// the change stream, so its depth is not reported.
+func (fw *DebeziumForwarder) Status(ctx context.Context) (Status, error) {
+	status := fw.runState.status()
+	status.EventDriven = true
+	return status, nil
+}
+
+// Status reports the forwarder's run state and the depth and oldest event of
+// its outbox table, from which forwarded events are deleted. Forwarders of
+// logical messages have no outbox table to report on.
+func (fw *ReplicationForwarder) Status(ctx context.Context) (Status, error) {
+	status := fw.runState.status()
+	if fw.messagePrefix != "" {
+		return status, nil
+	}
+
+	outbox, err := outboxStatus(ctx, fw.db, fw.outboxTableName)
+	if err != nil {
+		return status, err
+	}
+	status.Outbox = outbox
+
+	return status, nil
+}
+
+// Status reports the forwarder's run state and the depth and oldest event of
+// its outbox table, from which forwarded events are deleted.
+func (fw *BinlogForwarder) Status(ctx context.Context) (Status, error) {
+	status := fw.runState.status()
+
+	outbox, err := outboxStatus(ctx, fw.db, fw.outboxTableName)
+	if err != nil {
+		return status, err
+	}
+	status.Outbox = outbox
+
+	return status, nil
+}
@@ -0,0 +1,25 @@
+package forwarder
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunState(t *testing.T) {
+	var rs runState
+	assert.Equal(t, Status{}, rs.status())
+
+	rs.start()
+	status := rs.status()
+	assert.True(t, status.Running)
+	assert.False(t, status.StartedAt.IsZero())
+	assert.True(t, status.LastPollAt.IsZero())
+
+	rs.polled()
+	rs.stop()
+	status = rs.status()
+	assert.False(t, status.Running)
+	assert.True(t, status.StartedAt.IsZero())
+	assert.False(t, status.LastPollAt.IsZero())
+}
@@ -0,0 +1,45 @@
+package idempotency
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultTableName       = "event_idempotency_keys"
+	DefaultExpiry          = 24 * time.Hour
+	DefaultCleanupInterval = time.Minute
+)
+
+type Options struct {
+	// TableName is the key table. It needs an idempotency_key primary key, an
+	// event_ids text column and a created_at timestamp defaulting to now.
+	TableName string
+	// Expiry is how long a key suppresses retries. Keys older than this are
+	// deleted by the cleanup job.
+	Expiry time.Duration
+	// CleanupInterval is how often the cleanup job deletes expired keys.
+	CleanupInterval time.Duration
+	Logger          *zap.Logger
+}
+
+func (o *Options) validate() error {
+	if o.TableName == "" {
+		o.TableName = DefaultTableName
+	}
+
+	if o.Expiry == 0 {
+		o.Expiry = DefaultExpiry
+	}
+
+	if o.CleanupInterval == 0 {
+		o.CleanupInterval = DefaultCleanupInterval
+	}
+
+	if o.Logger == nil {
+		o.Logger = zap.L()
+	}
+
+	return nil
+}
@@ -0,0 +1,177 @@
+package idempotency
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/vectrum-io/strongforce/pkg/events"
+	"go.uber.org/zap"
+)
+
+// Store records idempotency keys together with the ids of the events emitted
+// under them. Keys are claimed inside the emitting transaction, so a retry
+// either sees the committed key or waits for the in-flight attempt to finish.
+type Store struct {
+	tableName       string
+	expiry          time.Duration
+	cleanupInterval time.Duration
+	logger          *zap.Logger
+}
+
+func New(options *Options) (*Store, error) {
+	if err := options.validate(); err != nil {
+		return nil, fmt.Errorf("failed to validate options: %w", err)
+	}
+
+	return &Store{
+		tableName:       options.TableName,
+		expiry:          options.Expiry,
+		cleanupInterval: options.CleanupInterval,
+		logger:          options.Logger,
+	}, nil
+}
+
+func (s *Store) TableName() string {
+	return s.tableName
+}
+
+// Claim inserts key within tx. It returns claimed=true when the key is new or
+// has expired and the caller should proceed. Otherwise it returns the event
+// ids recorded by the transaction that claimed the key first.
+func (s *Store) Claim(ctx context.Context, tx *sqlx.Tx, key string) (eventIds []events.EventID, claimed bool, err error) {
+	expired, expiry, err := s.expiredCondition(tx.DriverName())
+	if err != nil {
+		return nil, false, err
+	}
+
+	// an expired key is claimed anew, whether or not cleanup removed it yet
+	//goland:noinspection SqlNoDataSourceInspection
+	deleteQuery := tx.Rebind(fmt.Sprintf("DELETE FROM %s WHERE idempotency_key = ? AND %s", s.tableName, expired))
+	if _, err := tx.ExecContext(ctx, deleteQuery, key, expiry); err != nil {
+		return nil, false, fmt.Errorf("failed to delete expired idempotency key: %w", err)
+	}
+
+	var queryString string
+	switch tx.DriverName() {
+	case "mysql":
+		//goland:noinspection SqlNoDataSourceInspection
+		queryString = fmt.Sprintf("INSERT IGNORE INTO %s (idempotency_key, event_ids) VALUES (?, ?)", s.tableName)
+	case "postgres":
+		//goland:noinspection SqlNoDataSourceInspection
+		queryString = fmt.Sprintf("INSERT INTO %s (idempotency_key, event_ids) VALUES (?, ?) ON CONFLICT DO NOTHING", s.tableName)
+	default:
+		return nil, false, fmt.Errorf("unsupported database driver: %s", tx.DriverName())
+	}
+
+	res, err := tx.ExecContext(ctx, tx.Rebind(queryString), key, "")
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to claim idempotency key: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read idempotency key insert result: %w", err)
+	}
+
+	if affected > 0 {
+		return nil, true, nil
+	}
+
+	var encoded string
+	//goland:noinspection SqlNoDataSourceInspection
+	query := tx.Rebind(fmt.Sprintf("SELECT event_ids FROM %s WHERE idempotency_key = ?", s.tableName))
+	if err := tx.GetContext(ctx, &encoded, query, key); err != nil {
+		return nil, false, fmt.Errorf("failed to load idempotency key: %w", err)
+	}
+
+	return decodeEventIds(encoded), false, nil
+}
+
+// Record stores the ids of the events emitted under a key claimed in tx.
+func (s *Store) Record(ctx context.Context, tx *sqlx.Tx, key string, eventIds []events.EventID) error {
+	//goland:noinspection SqlNoDataSourceInspection
+	query := tx.Rebind(fmt.Sprintf("UPDATE %s SET event_ids = ? WHERE idempotency_key = ?", s.tableName))
+	if _, err := tx.ExecContext(ctx, query, encodeEventIds(eventIds), key); err != nil {
+		return fmt.Errorf("failed to record idempotency key: %w", err)
+	}
+	return nil
+}
+
+// Cleanup deletes keys older than the configured expiry and returns how many
+// were removed.
+func (s *Store) Cleanup(ctx context.Context, conn *sqlx.DB) (int64, error) {
+	expired, expiry, err := s.expiredCondition(conn.DriverName())
+	if err != nil {
+		return 0, err
+	}
+
+	//goland:noinspection SqlNoDataSourceInspection
+	query := conn.Rebind(fmt.Sprintf("DELETE FROM %s WHERE %s", s.tableName, expired))
+	res, err := conn.ExecContext(ctx, query, expiry)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired idempotency keys: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// RunCleanup calls Cleanup every CleanupInterval until ctx is done. Failures
+// are logged and retried on the next tick.
+func (s *Store) RunCleanup(ctx context.Context, conn *sqlx.DB) error {
+	ticker := time.NewTicker(s.cleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			removed, err := s.Cleanup(ctx, conn)
+			if err != nil {
+				s.logger.Sugar().Warnf("failed to clean up idempotency keys: %s", err.Error())
+				continue
+			}
+			if removed > 0 {
+				s.logger.Sugar().Debugf("removed %d expired idempotency keys", removed)
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// expiredCondition returns a condition matching keys older than the expiry
+// and its argument. The age is computed on the database clock that also set
+// created_at, so the session time zone does not skew it.
+func (s *Store) expiredCondition(driverName string) (string, any, error) {
+	switch driverName {
+	case "mysql":
+		return "created_at < CURRENT_TIMESTAMP - INTERVAL ? MICROSECOND", s.expiry.Microseconds(), nil
+	case "postgres":
+		return "created_at < CURRENT_TIMESTAMP - make_interval(secs => ?)", s.expiry.Seconds(), nil
+	default:
+		return "", nil, fmt.Errorf("unsupported database driver: %s", driverName)
+	}
+}
+
+// Event ids are ULIDs, so a comma never occurs inside one.
+func encodeEventIds(eventIds []events.EventID) string {
+	parts := make([]string, len(eventIds))
+	for i, id := range eventIds {
+		parts[i] = id.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+func decodeEventIds(encoded string) []events.EventID {
+	if encoded == "" {
+		return []events.EventID{}
+	}
+
+	parts := strings.Split(encoded, ",")
+	eventIds := make([]events.EventID, len(parts))
+	for i, part := range parts {
+		eventIds[i] = events.EventID(part)
+	}
+	return eventIds
+}
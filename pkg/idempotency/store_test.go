@@ -0,0 +1,43 @@
+package idempotency
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vectrum-io/strongforce/pkg/events"
+)
+
+func TestNewDefaults(t *testing.T) {
+	store, err := New(&Options{})
+	assert.NoError(t, err)
+
+	assert.Equal(t, DefaultTableName, store.TableName())
+	assert.Equal(t, DefaultExpiry, store.expiry)
+	assert.Equal(t, DefaultCleanupInterval, store.cleanupInterval)
+}
+
+func TestEventIdsRoundTrip(t *testing.T) {
+	eventIds := []events.EventID{events.NewEventID(), events.NewEventID()}
+
+	assert.Equal(t, eventIds, decodeEventIds(encodeEventIds(eventIds)))
+	assert.Empty(t, decodeEventIds(encodeEventIds(nil)))
+}
+
+func TestExpiredCondition(t *testing.T) {
+	store, err := New(&Options{Expiry: 90 * time.Second})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, expiry, err := store.expiredCondition("mysql")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(90_000_000), expiry)
+
+	_, expiry, err = store.expiredCondition("postgres")
+	assert.NoError(t, err)
+	assert.Equal(t, 90.0, expiry)
+
+	_, _, err = store.expiredCondition("sqlite")
+	assert.Error(t, err)
+}
@@ -0,0 +1,166 @@
+package inbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/vectrum-io/strongforce/pkg/bus"
+	"github.com/vectrum-io/strongforce/pkg/db"
+	"github.com/vectrum-io/strongforce/pkg/events"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrNoDB             = errors.New("no database provided")
+	ErrMissingMessageId = errors.New("message has no id")
+)
+
+// HandlerFunc handles an inbound message inside the inbox transaction. All
+// writes made through tx commit atomically with the message being marked as
+// processed.
+type HandlerFunc func(ctx context.Context, tx *sqlx.Tx, message bus.InboundMessage) error
+
+// EventsHandlerFunc handles an inbound message inside the inbox transaction
+// and returns follow-up events to emit through the outbox in the same
+// transaction.
+type EventsHandlerFunc func(ctx context.Context, tx *sqlx.Tx, message bus.InboundMessage) ([]*events.EventSpec, error)
+
+// Inbox deduplicates inbound messages by recording their ids in a
+// processed-messages table within the same transaction as the handler's own
+// writes. JetStream redeliveries and forwarder double-publishes therefore
+// reach each handler at most once per consumer.
+type Inbox struct {
+	db        db.DB
+	tableName string
+	consumer  string
+	logger    *zap.Logger
+}
+
+func New(db db.DB, options *Options) (*Inbox, error) {
+	if db == nil {
+		return nil, ErrNoDB
+	}
+
+	if err := options.validate(); err != nil {
+		return nil, fmt.Errorf("failed to validate options: %w", err)
+	}
+
+	return &Inbox{
+		db:        db,
+		tableName: options.TableName,
+		consumer:  options.Consumer,
+		logger:    options.Logger,
+	}, nil
+}
+
+func (i *Inbox) TableName() string {
+	return i.tableName
+}
+
+// AddHandler registers fn on the subscription behind the inbox. It is a
+// shorthand for sub.AddHandler(pattern, i.Handler(pattern, fn)).
+func (i *Inbox) AddHandler(sub *bus.Subscription, pattern string, fn HandlerFunc) error {
+	return sub.AddHandler(pattern, i.Handler(pattern, fn))
+}
+
+// Handler wraps fn into a bus.HandlerFunc. The returned handler only returns
+// nil once the transaction has committed, so the subscription acks the
+// message strictly after its effects are durable. Duplicates commit an empty
+// transaction and are acked without invoking fn.
+//
+// Messages are deduplicated per handler name, so several handlers of one
+// subscription that match the same message each process it once. The name
+// must be stable across deployments; renaming a handler makes it process
+// messages it has already handled again.
+func (i *Inbox) Handler(name string, fn HandlerFunc) bus.HandlerFunc {
+	return func(ctx context.Context, message bus.InboundMessage) error {
+		return i.db.Tx(ctx, func(ctx context.Context, tx *sqlx.Tx) error {
+			isNew, err := i.markProcessed(ctx, tx, name, message)
+			if err != nil {
+				return err
+			}
+
+			if !isNew {
+				i.logger.Sugar().Debugf("skipping duplicate message %s for handler %s of consumer %s", message.Id, name, i.consumer)
+				return nil
+			}
+
+			return fn(ctx, tx, message)
+		})
+	}
+}
+
+// AddEventsHandler registers fn on the subscription behind the inbox. It is a
+// shorthand for sub.AddHandler(pattern, i.EventsHandler(pattern, fn)).
+func (i *Inbox) AddEventsHandler(sub *bus.Subscription, pattern string, fn EventsHandlerFunc) error {
+	return sub.AddHandler(pattern, i.EventsHandler(pattern, fn))
+}
+
+// EventsHandler wraps fn into a bus.HandlerFunc that runs inside EventsTx, so
+// state changes, the inbox record and the returned events commit together.
+// The message is acked only after commit. Emitted events are stamped with the
+// inbound message as their cause and inherit its correlation id, unless fn
+// set them explicitly. Messages are deduplicated per handler name, as with
+// Handler.
+func (i *Inbox) EventsHandler(name string, fn EventsHandlerFunc) bus.HandlerFunc {
+	return func(ctx context.Context, message bus.InboundMessage) error {
+		_, err := i.db.EventsTx(ctx, func(ctx context.Context, tx *sqlx.Tx) ([]*events.EventSpec, error) {
+			isNew, err := i.markProcessed(ctx, tx, name, message)
+			if err != nil {
+				return nil, err
+			}
+
+			if !isNew {
+				i.logger.Sugar().Debugf("skipping duplicate message %s for handler %s of consumer %s", message.Id, name, i.consumer)
+				return nil, nil
+			}
+
+			eventSpecs, err := fn(ctx, tx, message)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, spec := range eventSpecs {
+				spec.Metadata.SetCause(message.Id, message.CorrelationId)
+			}
+
+			return eventSpecs, nil
+		})
+		return err
+	}
+}
+
+// markProcessed inserts the message id into the inbox table for handler and
+// reports whether the row was new. Conflicts are swallowed by the database
+// rather than surfaced as driver-specific duplicate-key errors.
+func (i *Inbox) markProcessed(ctx context.Context, tx *sqlx.Tx, handler string, message bus.InboundMessage) (bool, error) {
+	if message.Id == "" {
+		return false, fmt.Errorf("%w: subject %s", ErrMissingMessageId, message.Subject)
+	}
+
+	var queryString string
+	switch tx.DriverName() {
+	case "mysql":
+		//goland:noinspection SqlNoDataSourceInspection
+		queryString = fmt.Sprintf("INSERT IGNORE INTO %s (consumer, handler, message_id) VALUES (?, ?, ?)", i.tableName)
+	case "postgres":
+		//goland:noinspection SqlNoDataSourceInspection
+		queryString = fmt.Sprintf("INSERT INTO %s (consumer, handler, message_id) VALUES (?, ?, ?) ON CONFLICT DO NOTHING", i.tableName)
+	default:
+		return false, fmt.Errorf("unsupported database driver: %s", tx.DriverName())
+	}
+
+	res, err := tx.ExecContext(ctx, tx.Rebind(queryString), i.consumer, handler, message.Id)
+	if err != nil {
+		return false, fmt.Errorf("failed to store message in inbox: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to read inbox insert result: %w", err)
+	}
+
+	return affected > 0, nil
+}
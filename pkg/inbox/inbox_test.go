@@ -0,0 +1,30 @@
+package inbox
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vectrum-io/strongforce/pkg/db/postgres"
+)
+
+func TestNewRequiresDB(t *testing.T) {
+	_, err := New(nil, &Options{Consumer: "test"})
+	assert.ErrorIs(t, err, ErrNoDB)
+}
+
+func TestNewRequiresConsumer(t *testing.T) {
+	db, err := postgres.New(postgres.Options{DSN: "postgresql://localhost/test"})
+	assert.NoError(t, err)
+
+	_, err = New(db, &Options{})
+	assert.ErrorIs(t, err, ErrNoConsumer)
+}
+
+func TestNewDefaultTableName(t *testing.T) {
+	db, err := postgres.New(postgres.Options{DSN: "postgresql://localhost/test"})
+	assert.NoError(t, err)
+
+	ib, err := New(db, &Options{Consumer: "test"})
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultInboxTableName, ib.TableName())
+}
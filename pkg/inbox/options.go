@@ -0,0 +1,40 @@
+package inbox
+
+import (
+	"errors"
+
+	"go.uber.org/zap"
+)
+
+const DefaultInboxTableName = "event_inbox"
+
+var (
+	ErrNoConsumer = errors.New("no consumer name provided")
+)
+
+type Options struct {
+	// TableName is the processed-messages table. It must have a composite
+	// primary key on (consumer, handler, message_id) so concurrent
+	// redeliveries of the same message to the same handler collide on insert.
+	TableName string
+	// Consumer scopes deduplication, allowing several subscriptions to share
+	// one inbox table. Usually the subscriber name passed to bus.Subscribe.
+	Consumer string
+	Logger   *zap.Logger
+}
+
+func (o *Options) validate() error {
+	if o.TableName == "" {
+		o.TableName = DefaultInboxTableName
+	}
+
+	if o.Consumer == "" {
+		return ErrNoConsumer
+	}
+
+	if o.Logger == nil {
+		o.Logger = zap.L()
+	}
+
+	return nil
+}
@@ -0,0 +1,192 @@
+package leader
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/vectrum-io/strongforce/pkg/db"
+	"go.uber.org/zap"
+)
+
+const DefaultAdvisoryLockRetryInterval = time.Second
+
+// mysqlMaxLockNameLength is the longest name GET_LOCK accepts.
+const mysqlMaxLockNameLength = 64
+
+type AdvisoryLockOptions struct {
+	// Name identifies the lock, e.g. the outbox table. Postgres locks are
+	// keyed by a hash of it.
+	Name string
+	// RetryInterval is how often followers try to take the lock and the
+	// leader checks its session is alive. Defaults to
+	// DefaultAdvisoryLockRetryInterval.
+	RetryInterval time.Duration
+	Logger        *zap.Logger
+}
+
+func (o *AdvisoryLockOptions) validate() error {
+	if o.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidOptions)
+	}
+
+	if o.RetryInterval <= 0 {
+		o.RetryInterval = DefaultAdvisoryLockRetryInterval
+	}
+
+	if o.Logger == nil {
+		o.Logger = zap.L()
+	}
+
+	return nil
+}
+
+// AdvisoryLockElector elects a leader through a session-level advisory lock:
+// pg_try_advisory_lock on Postgres and GET_LOCK on MySQL. The leader holds a
+// dedicated connection; the database releases the lock as soon as that
+// session ends, so a crashed leader is replaced within RetryInterval once
+// the database notices.
+type AdvisoryLockElector struct {
+	db      db.DB
+	options AdvisoryLockOptions
+}
+
+func NewAdvisoryLockElector(database db.DB, options *AdvisoryLockOptions) (*AdvisoryLockElector, error) {
+	if options == nil {
+		options = &AdvisoryLockOptions{}
+	}
+	opts := *options
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	return &AdvisoryLockElector{
+		db:      database,
+		options: opts,
+	}, nil
+}
+
+func (e *AdvisoryLockElector) Acquire(ctx context.Context) (Lease, error) {
+	lockQuery, unlockQuery, arg, err := e.queries()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		conn, acquired, err := e.tryLock(ctx, lockQuery, arg)
+		if acquired {
+			return e.lead(conn, unlockQuery, arg), nil
+		}
+		if err != nil && ctx.Err() == nil {
+			e.options.Logger.Sugar().Warnf("failed to campaign for leadership of %s: %s", e.options.Name, err.Error())
+		}
+
+		timer := time.NewTimer(e.options.RetryInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// queries returns the lock and unlock statements for the database and the
+// lock key they take.
+func (e *AdvisoryLockElector) queries() (string, string, any, error) {
+	switch driverName := e.db.Connection().DriverName(); driverName {
+	case "postgres":
+		hash := fnv.New64a()
+		_, _ = hash.Write([]byte(e.options.Name))
+		return "SELECT pg_try_advisory_lock(?)", "SELECT pg_advisory_unlock(?)", int64(hash.Sum64()), nil
+	case "mysql":
+		if len(e.options.Name) > mysqlMaxLockNameLength {
+			return "", "", nil, fmt.Errorf("%w: mysql lock names are limited to %d characters", ErrInvalidOptions, mysqlMaxLockNameLength)
+		}
+		return "SELECT GET_LOCK(?, 0) = 1", "SELECT RELEASE_LOCK(?)", e.options.Name, nil
+	default:
+		return "", "", nil, fmt.Errorf("unsupported database driver: %s", driverName)
+	}
+}
+
+// tryLock takes a connection from the pool and tries to lock on it. The
+// connection is returned only if the lock was acquired.
+func (e *AdvisoryLockElector) tryLock(ctx context.Context, lockQuery string, arg any) (*sqlx.Conn, bool, error) {
+	conn, err := e.db.Connection().Connx(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get connection: %w", err)
+	}
+
+	var acquired sql.NullBool
+	if err := conn.GetContext(ctx, &acquired, conn.Rebind(lockQuery), arg); err != nil {
+		_ = conn.Close()
+		return nil, false, fmt.Errorf("failed to take advisory lock: %w", err)
+	}
+
+	if !acquired.Bool {
+		_ = conn.Close()
+		return nil, false, nil
+	}
+
+	return conn, true, nil
+}
+
+func (e *AdvisoryLockElector) lead(conn *sqlx.Conn, unlockQuery string, arg any) Lease {
+	var l *lease
+	l = newLease(func(ctx context.Context) error {
+		defer func() {
+			_ = conn.Close()
+		}()
+
+		// a lost session already released the lock
+		select {
+		case <-l.Lost():
+			return nil
+		default:
+		}
+
+		if _, err := conn.ExecContext(ctx, conn.Rebind(unlockQuery), arg); err != nil {
+			return fmt.Errorf("failed to release advisory lock: %w", err)
+		}
+		return nil
+	})
+
+	l.keepAlive(func(releasing <-chan struct{}) {
+		ticker := time.NewTicker(e.options.RetryInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-releasing:
+				return
+			case <-ticker.C:
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), e.options.RetryInterval)
+			err := conn.PingContext(ctx)
+			cancel()
+
+			if err != nil {
+				if !errors.Is(err, context.DeadlineExceeded) {
+					e.options.Logger.Sugar().Warnf("lost leadership of %s: session ended: %s", e.options.Name, err.Error())
+				} else {
+					e.options.Logger.Sugar().Warnf("lost leadership of %s: session unresponsive", e.options.Name)
+				}
+				l.markLost()
+				// discards the connection, so the session ends and the lock is
+				// released even if it was only unresponsive
+				_ = conn.Raw(func(any) error {
+					return driver.ErrBadConn
+				})
+				return
+			}
+		}
+	})
+
+	return l
+}
@@ -0,0 +1,224 @@
+package leader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultKVBucket = "strongforce_leaders"
+	DefaultKVTTL    = 10 * time.Second
+)
+
+type KVOptions struct {
+	// Bucket is created on first use if it does not exist. Defaults to
+	// DefaultKVBucket.
+	Bucket string
+	// Key names the leadership, e.g. the outbox table. Candidates for the
+	// same key elect one leader.
+	Key string
+	// InstanceID is stored as the leader's value. Defaults to the hostname
+	// and a random suffix.
+	InstanceID string
+	// TTL bounds how long a crashed leader blocks failover. The lease is
+	// renewed every TTL/3 and given up once renewals fail for 2/3 of TTL.
+	// Defaults to DefaultKVTTL. All candidates must use the same TTL, as it
+	// is the bucket's max age.
+	TTL    time.Duration
+	Logger *zap.Logger
+}
+
+func (o *KVOptions) validate() error {
+	if o.Key == "" {
+		return fmt.Errorf("%w: key is required", ErrInvalidOptions)
+	}
+
+	if o.Bucket == "" {
+		o.Bucket = DefaultKVBucket
+	}
+
+	if o.InstanceID == "" {
+		o.InstanceID = defaultInstanceID()
+	}
+
+	if o.TTL <= 0 {
+		o.TTL = DefaultKVTTL
+	}
+
+	if o.Logger == nil {
+		o.Logger = zap.L()
+	}
+
+	return nil
+}
+
+// KVElector elects a leader through a NATS KV key that expires unless the
+// leader renews it. Released and expired keys are noticed through a watch,
+// so failover does not wait for a retry interval.
+type KVElector struct {
+	jetStream jetstream.JetStream
+	options   KVOptions
+
+	kvMu sync.Mutex
+	kv   jetstream.KeyValue
+}
+
+func NewKVElector(js jetstream.JetStream, options *KVOptions) (*KVElector, error) {
+	if options == nil {
+		options = &KVOptions{}
+	}
+	opts := *options
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	return &KVElector{
+		jetStream: js,
+		options:   opts,
+	}, nil
+}
+
+func (e *KVElector) Acquire(ctx context.Context) (Lease, error) {
+	kv, err := e.bucket(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	watcher, err := kv.Watch(ctx, e.options.Key, jetstream.UpdatesOnly())
+	if err != nil {
+		return nil, fmt.Errorf("failed to watch leader key: %w", err)
+	}
+	defer func() {
+		_ = watcher.Stop()
+	}()
+
+	// expiry by max age does not reach the watch, so retry periodically too
+	ticker := time.NewTicker(e.options.TTL / 3)
+	defer ticker.Stop()
+
+	for {
+		revision, err := kv.Create(ctx, e.options.Key, []byte(e.options.InstanceID))
+		if err == nil {
+			return e.lead(kv, revision), nil
+		}
+		if !errors.Is(err, jetstream.ErrKeyExists) {
+			e.options.Logger.Sugar().Warnf("failed to campaign for leadership of %s: %s", e.options.Key, err.Error())
+		}
+
+		if err := e.awaitVacancy(ctx, watcher, ticker); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// awaitVacancy returns when the leader key is deleted, purged or the retry
+// interval passed.
+func (e *KVElector) awaitVacancy(ctx context.Context, watcher jetstream.KeyWatcher, ticker *time.Ticker) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case entry := <-watcher.Updates():
+			if entry == nil || entry.Operation() == jetstream.KeyValuePut {
+				continue
+			}
+			return nil
+		case <-ticker.C:
+			return nil
+		}
+	}
+}
+
+func (e *KVElector) bucket(ctx context.Context) (jetstream.KeyValue, error) {
+	e.kvMu.Lock()
+	defer e.kvMu.Unlock()
+
+	if e.kv != nil {
+		return e.kv, nil
+	}
+
+	kv, err := e.jetStream.CreateKeyValue(ctx, jetstream.KeyValueConfig{
+		Bucket:      e.options.Bucket,
+		Description: "strongforce leader election",
+		History:     1,
+		TTL:         e.options.TTL,
+	})
+	if errors.Is(err, jetstream.ErrBucketExists) {
+		kv, err = e.jetStream.KeyValue(ctx, e.options.Bucket)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get leader bucket: %w", err)
+	}
+
+	e.kv = kv
+	return kv, nil
+}
+
+func (e *KVElector) lead(kv jetstream.KeyValue, revision uint64) Lease {
+	var revisionMu sync.Mutex
+
+	l := newLease(func(ctx context.Context) error {
+		revisionMu.Lock()
+		defer revisionMu.Unlock()
+
+		// only deletes the key if no other instance took over in between
+		if err := kv.Delete(ctx, e.options.Key, jetstream.LastRevision(revision)); err != nil && !errors.Is(err, jetstream.ErrKeyExists) {
+			return fmt.Errorf("failed to release leadership: %w", err)
+		}
+		return nil
+	})
+
+	l.keepAlive(func(releasing <-chan struct{}) {
+		interval := e.options.TTL / 3
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		// renewals must succeed before the key would expire, with a margin
+		// of one interval, so two leaders never overlap
+		deadline := time.Now().Add(e.options.TTL - interval)
+		for {
+			select {
+			case <-releasing:
+				return
+			case <-ticker.C:
+			}
+
+			if !time.Now().Before(deadline) {
+				e.options.Logger.Sugar().Warnf("lost leadership of %s: failed to renew lease", e.options.Key)
+				l.markLost()
+				return
+			}
+
+			attemptedAt := time.Now()
+			ctx, cancel := context.WithDeadline(context.Background(), deadline)
+			revisionMu.Lock()
+			newRevision, err := kv.Update(ctx, e.options.Key, []byte(e.options.InstanceID), revision)
+			if err == nil {
+				revision = newRevision
+			}
+			revisionMu.Unlock()
+			cancel()
+
+			if err == nil {
+				deadline = attemptedAt.Add(e.options.TTL - interval)
+				continue
+			}
+
+			if errors.Is(err, jetstream.ErrKeyExists) {
+				e.options.Logger.Sugar().Warnf("lost leadership of %s to another instance", e.options.Key)
+				l.markLost()
+				return
+			}
+
+			e.options.Logger.Sugar().Warnf("failed to renew leadership of %s: %s", e.options.Key, err.Error())
+		}
+	})
+
+	return l
+}
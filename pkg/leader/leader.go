@@ -0,0 +1,91 @@
+// Package leader elects a single leader among replicas, so work such as
+// polling the outbox runs on one instance at a time.
+package leader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/oklog/ulid/v2"
+)
+
+var ErrInvalidOptions = errors.New("invalid leader election options")
+
+// Elector campaigns for leadership. Implementations must be safe for
+// concurrent use.
+type Elector interface {
+	// Acquire blocks until this instance leads or ctx ends.
+	Acquire(ctx context.Context) (Lease, error)
+}
+
+// Lease is held by the leader.
+type Lease interface {
+	// Lost is closed when leadership is lost, e.g. because the lease could not
+	// be renewed. It is not closed by Release.
+	Lost() <-chan struct{}
+	// Release gives up leadership, so another instance can take over without
+	// waiting for the lease to expire.
+	Release(ctx context.Context) error
+}
+
+// lease implements Lease on top of a keep-alive goroutine.
+type lease struct {
+	lost        chan struct{}
+	lostOnce    sync.Once
+	releasing   chan struct{}
+	releaseOnce sync.Once
+	kept        sync.WaitGroup
+	release     func(ctx context.Context) error
+}
+
+func newLease(release func(ctx context.Context) error) *lease {
+	return &lease{
+		lost:      make(chan struct{}),
+		releasing: make(chan struct{}),
+		release:   release,
+	}
+}
+
+func (l *lease) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// Release stops the keep-alive, then releases the lease. Calls after the
+// first return nil.
+func (l *lease) Release(ctx context.Context) error {
+	err := error(nil)
+	l.releaseOnce.Do(func() {
+		close(l.releasing)
+		l.kept.Wait()
+		err = l.release(ctx)
+	})
+	return err
+}
+
+func (l *lease) markLost() {
+	l.lostOnce.Do(func() {
+		close(l.lost)
+	})
+}
+
+// keepAlive runs keep in the background until the lease is released. keep
+// must return when releasing is closed.
+func (l *lease) keepAlive(keep func(releasing <-chan struct{})) {
+	l.kept.Add(1)
+	go func() {
+		defer l.kept.Done()
+		keep(l.releasing)
+	}()
+}
+
+// defaultInstanceID identifies this process to other candidates.
+func defaultInstanceID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s-%s", hostname, ulid.Make().String())
+}
@@ -0,0 +1,43 @@
+package leader
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLeaseRelease(t *testing.T) {
+	var releases int
+	l := newLease(func(ctx context.Context) error {
+		releases++
+		return nil
+	})
+
+	stopped := make(chan struct{})
+	l.keepAlive(func(releasing <-chan struct{}) {
+		<-releasing
+		close(stopped)
+	})
+
+	assert.NoError(t, l.Release(context.Background()))
+	assert.NoError(t, l.Release(context.Background()))
+	assert.Equal(t, 1, releases)
+	<-stopped
+
+	select {
+	case <-l.Lost():
+		t.Fatal("release must not mark the lease lost")
+	default:
+	}
+}
+
+func TestLeaseMarkLost(t *testing.T) {
+	l := newLease(func(ctx context.Context) error {
+		return nil
+	})
+
+	l.markLost()
+	l.markLost()
+	<-l.Lost()
+}
@@ -11,10 +11,12 @@ var (
 )
 
 type EventEntity struct {
-	Id        sql.NullString `db:"id"`
-	Topic     sql.NullString `db:"topic"`
-	Payload   []byte         `db:"payload"`
-	CreatedAt sql.NullTime   `db:"created_at"`
+	Id            sql.NullString `db:"id"`
+	Topic         sql.NullString `db:"topic"`
+	Payload       []byte         `db:"payload"`
+	CreatedAt     sql.NullTime   `db:"created_at"`
+	CausationId   sql.NullString `db:"causation_id"`
+	CorrelationId sql.NullString `db:"correlation_id"`
 }
 
 func (ee *EventEntity) ToSerializedEvent() (*events.SerializedEvent, error) {
@@ -24,10 +26,18 @@ func (ee *EventEntity) ToSerializedEvent() (*events.SerializedEvent, error) {
 
 	return &events.SerializedEvent{
 		Metadata: &events.EventMetadata{
-			Id:        events.EventID(ee.Id.String),
-			Topic:     ee.Topic.String,
-			CreatedAt: ee.CreatedAt.Time,
+			Id:            events.EventID(ee.Id.String),
+			Topic:         ee.Topic.String,
+			CreatedAt:     ee.CreatedAt.Time,
+			CausationId:   ee.CausationId.String,
+			CorrelationId: ee.CorrelationId.String,
 		},
 		SerializedPayload: ee.Payload,
 	}, nil
 }
+
+// nullString maps an empty id to NULL so rows emitted outside a handler don't
+// carry empty-string causation ids.
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
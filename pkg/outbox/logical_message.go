@@ -0,0 +1,59 @@
+package outbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/vectrum-io/strongforce/pkg/events"
+)
+
+// logicalMessage is the content of the logical messages events are emitted
+// as, carrying what the outbox table's columns would.
+type logicalMessage struct {
+	Id            string    `json:"id"`
+	Topic         string    `json:"topic"`
+	Payload       []byte    `json:"payload"`
+	CreatedAt     time.Time `json:"created_at"`
+	CausationId   string    `json:"causation_id,omitempty"`
+	CorrelationId string    `json:"correlation_id,omitempty"`
+}
+
+// EncodeLogicalMessage encodes an event as the content of a logical message.
+func EncodeLogicalMessage(event *events.SerializedEvent) ([]byte, error) {
+	content, err := json.Marshal(logicalMessage{
+		Id:            event.Metadata.Id.String(),
+		Topic:         event.Metadata.Topic,
+		Payload:       event.SerializedPayload,
+		CreatedAt:     event.Metadata.CreatedAt,
+		CausationId:   event.Metadata.CausationId,
+		CorrelationId: event.Metadata.CorrelationId,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode event message: %w", err)
+	}
+	return content, nil
+}
+
+// DecodeLogicalMessage decodes the content of a logical message emitted by
+// an outbox.
+func DecodeLogicalMessage(content []byte) (*events.SerializedEvent, error) {
+	var message logicalMessage
+	if err := json.Unmarshal(content, &message); err != nil {
+		return nil, fmt.Errorf("failed to decode event message: %w", err)
+	}
+	if message.Id == "" {
+		return nil, ErrEventIdInvalid
+	}
+
+	return &events.SerializedEvent{
+		Metadata: &events.EventMetadata{
+			Id:            events.EventID(message.Id),
+			Topic:         message.Topic,
+			CreatedAt:     message.CreatedAt,
+			CausationId:   message.CausationId,
+			CorrelationId: message.CorrelationId,
+		},
+		SerializedPayload: message.Payload,
+	}, nil
+}
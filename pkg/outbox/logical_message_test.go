@@ -0,0 +1,37 @@
+package outbox
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vectrum-io/strongforce/pkg/events"
+)
+
+func TestLogicalMessageRoundTrip(t *testing.T) {
+	event := &events.SerializedEvent{
+		Metadata: &events.EventMetadata{
+			Id:            "01J",
+			Topic:         "orders.created",
+			CreatedAt:     time.Date(2024, 2, 20, 23, 21, 51, 123456789, time.UTC),
+			CausationId:   "01I",
+			CorrelationId: "01H",
+		},
+		SerializedPayload: []byte{0x45, 0x2a, 0x00},
+	}
+
+	content, err := EncodeLogicalMessage(event)
+	assert.NoError(t, err)
+
+	decoded, err := DecodeLogicalMessage(content)
+	assert.NoError(t, err)
+	assert.Equal(t, event, decoded)
+}
+
+func TestDecodeLogicalMessageInvalid(t *testing.T) {
+	_, err := DecodeLogicalMessage([]byte(`{"topic":"orders.created"}`))
+	assert.ErrorIs(t, err, ErrEventIdInvalid)
+
+	_, err = DecodeLogicalMessage([]byte("not json"))
+	assert.Error(t, err)
+}
@@ -4,10 +4,40 @@ import "github.com/vectrum-io/strongforce/pkg/serialization"
 
 const DefaultOutboxTableName = "event_outbox"
 
+// Options configures an Outbox. Its table needs the columns
+//
+//	id varchar(36) NOT NULL PRIMARY KEY,
+//	topic varchar(255) NOT NULL,
+//	payload blob NOT NULL, -- bytea on Postgres
+//	created_at datetime NULL DEFAULT CURRENT_TIMESTAMP, -- timestamp on Postgres
+//	causation_id varchar(255) NULL,
+//	correlation_id varchar(255) NULL
+//
+// causation_id and correlation_id hold EventMetadata.CausationId and
+// CorrelationId, which every forwarder publishes as message headers. Tables
+// created before they were added are upgraded with
+//
+//	ALTER TABLE event_outbox
+//	  ADD COLUMN causation_id varchar(255) NULL,
+//	  ADD COLUMN correlation_id varchar(255) NULL;
+//
+// before deploying this version; examples/postgres/atlas/migrations has it as
+// an Atlas migration.
 type Options struct {
 	TableName  string
 	Serializer serialization.Serializer
 	Notifier   CommitNotifier
+	// NotifyChannel makes EmitEvent notify this channel with pg_notify, so a
+	// forwarder listening on it (forwarder.Options.NotifyChannel) processes
+	// the event as soon as the transaction commits. Postgres only.
+	NotifyChannel string
+	// LogicalMessagePrefix makes EmitEvent write events to the WAL with
+	// pg_logical_emit_message under this prefix instead of inserting them
+	// into the outbox table, so no rows are left to delete and vacuum. Only a
+	// replication forwarder reading messages of the same prefix
+	// (forwarder.ReplicationOptions.MessagePrefix) forwards them. Postgres
+	// only.
+	LogicalMessagePrefix string
 }
 
 func (o *Options) validate() error {
@@ -11,9 +11,11 @@ import (
 )
 
 type Outbox struct {
-	tableName  string
-	serializer serialization.Serializer
-	notifier   atomic.Pointer[CommitNotifier]
+	tableName     string
+	serializer    serialization.Serializer
+	notifyChannel string
+	messagePrefix string
+	notifier      atomic.Pointer[CommitNotifier]
 }
 
 func New(options *Options) (*Outbox, error) {
@@ -22,8 +24,10 @@ func New(options *Options) (*Outbox, error) {
 	}
 
 	ob := &Outbox{
-		tableName:  options.TableName,
-		serializer: options.Serializer,
+		tableName:     options.TableName,
+		serializer:    options.Serializer,
+		notifyChannel: options.NotifyChannel,
+		messagePrefix: options.LogicalMessagePrefix,
 	}
 	if options.Notifier != nil {
 		ob.SetNotifier(options.Notifier)
@@ -35,6 +39,12 @@ func (o *Outbox) TableName() string {
 	return o.tableName
 }
 
+// LogicalMessagePrefix is the prefix events are emitted as logical messages
+// under, empty if they are inserted, see Options.LogicalMessagePrefix.
+func (o *Outbox) LogicalMessagePrefix() string {
+	return o.messagePrefix
+}
+
 // SetNotifier attaches a CommitNotifier. Safe to call at any time; replaces
 // any previously set notifier. Pass nil to detach.
 func (o *Outbox) SetNotifier(n CommitNotifier) {
@@ -59,8 +69,11 @@ func (o *Outbox) NotifyCommitted(ctx context.Context, evs []*events.SerializedEv
 }
 
 // EmitEvent serializes and inserts the event into the outbox table within the
-// provided transaction. It returns the SerializedEvent so callers can hand the
-// exact persisted bytes to a CommitNotifier without re-serializing.
+// provided transaction, or emits it as a logical message if
+// Options.LogicalMessagePrefix is set. It returns the SerializedEvent so
+// callers can hand the exact persisted bytes to a CommitNotifier without
+// re-serializing. When ctx descends from an inbound message ctx, the event is
+// linked to that message.
 func (o *Outbox) EmitEvent(ctx context.Context, tx *sqlx.Tx, event *events.EventSpec) (*events.SerializedEvent, error) {
 	serializedPayload, err := o.serializer.Serialize(event.Payload)
 	if err != nil {
@@ -68,17 +81,63 @@ func (o *Outbox) EmitEvent(ctx context.Context, tx *sqlx.Tx, event *events.Event
 	}
 
 	metadata := event.Metadata
+	if cause, ok := events.CauseFromContext(ctx); ok {
+		metadata.SetCause(cause.MessageId, cause.CorrelationId)
+	}
+
+	serialized := &events.SerializedEvent{
+		Metadata:          metadata,
+		SerializedPayload: serializedPayload,
+	}
+
+	if o.messagePrefix != "" {
+		if err := o.emitMessage(ctx, tx, serialized); err != nil {
+			return nil, err
+		}
+	} else if err := o.insert(ctx, tx, serialized); err != nil {
+		return nil, err
+	}
 
+	// notifications are delivered on commit and identical ones are folded,
+	// so listeners are woken once per transaction
+	if o.notifyChannel != "" {
+		if _, err := tx.ExecContext(ctx, tx.Rebind("SELECT pg_notify(?, ?)"), o.notifyChannel, o.tableName); err != nil {
+			return nil, fmt.Errorf("failed to notify outbox channel: %w", err)
+		}
+	}
+
+	return serialized, nil
+}
+
+func (o *Outbox) insert(ctx context.Context, tx *sqlx.Tx, event *events.SerializedEvent) error {
+	metadata := event.Metadata
+
+	//goland:noinspection SqlNoDataSourceInspection
 	query := tx.Rebind(fmt.Sprintf(`
-		INSERT INTO %s (id, topic, payload) VALUES (?, ?, ?)
+		INSERT INTO %s (id, topic, payload, causation_id, correlation_id) VALUES (?, ?, ?, ?, ?)
 	`, o.tableName))
+	args := []interface{}{
+		metadata.Id.String(), metadata.Topic, event.SerializedPayload,
+		nullString(metadata.CausationId), nullString(metadata.CorrelationId),
+	}
 
-	if _, err := tx.ExecContext(ctx, query, metadata.Id.String(), metadata.Topic, serializedPayload); err != nil {
-		return nil, fmt.Errorf("failed to store event to db: %w", err)
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to store event to db: %w", err)
 	}
+	return nil
+}
 
-	return &events.SerializedEvent{
-		Metadata:          metadata,
-		SerializedPayload: serializedPayload,
-	}, nil
+// emitMessage writes the event to the WAL as a transactional logical message,
+// which is decoded with the transaction's other changes once it commits.
+func (o *Outbox) emitMessage(ctx context.Context, tx *sqlx.Tx, event *events.SerializedEvent) error {
+	content, err := EncodeLogicalMessage(event)
+	if err != nil {
+		return err
+	}
+
+	// the cast picks the bytea variant of the function
+	if _, err := tx.ExecContext(ctx, tx.Rebind("SELECT pg_logical_emit_message(true, ?, ?::bytea)"), o.messagePrefix, content); err != nil {
+		return fmt.Errorf("failed to emit event message: %w", err)
+	}
+	return nil
 }
@@ -282,6 +282,82 @@ func TestSubscribeContextCancelation(t *testing.T) {
 	assert.Equal(t, false, subscription.IsRunning())
 }
 
+func TestDeadLetterAndRedrive(t *testing.T) {
+	streamName := "test-dead-letter"
+	subject := "test-5"
+	deadLetterStream := "test-dead-letter-dlq"
+	deadLetterSubject := "test-5-dlq"
+
+	assert.NoError(t, sharedtest.CreateNatsStream(sharedtest.NATS, streamName, subject))
+	assert.NoError(t, sharedtest.CreateNatsStream(sharedtest.NATS, deadLetterStream, deadLetterSubject))
+
+	natsBus, err := nats.New(&nats.Options{
+		NATSAddress: sharedtest.NATS,
+	})
+	assert.NoError(t, err)
+
+	subscription, err := natsBus.Subscribe(context.Background(), streamName+"-"+subject, streamName,
+		bus.WithFilterSubject(subject),
+		bus.WithMaxDeliveryTries(2),
+		bus.WithAckWait(time.Second),
+		bus.WithDeadLetter(deadLetterSubject),
+	)
+	assert.NoError(t, err)
+
+	assert.NoError(t, subscription.AddHandler(subject, func(ctx context.Context, message bus.InboundMessage) error {
+		return errors.New("always failing")
+	}))
+	subscription.Start(context.Background())
+
+	assert.NoError(t, natsBus.Publish(context.Background(), &bus.OutboundMessage{
+		Id:      "1",
+		Subject: subject,
+		Data:    []byte("dead letter"),
+	}))
+
+	assert.Eventually(t, func() bool {
+		info, err := sharedtest.GetNATSStream(sharedtest.NATS, deadLetterStream)
+		return err == nil && info.State.Msgs == 1
+	}, 10*time.Second, 100*time.Millisecond)
+	subscription.Stop()
+
+	redriven, err := natsBus.Redrive(context.Background(), deadLetterStream, "", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, redriven)
+
+	deadLetterInfo, err := sharedtest.GetNATSStream(sharedtest.NATS, deadLetterStream)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0), deadLetterInfo.State.Msgs)
+
+	streamInfo, err := sharedtest.GetNATSStream(sharedtest.NATS, streamName)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), streamInfo.State.Msgs)
+
+	// the redriven message keeps the original id, so inboxes deduplicate it
+	redrivenSubscription, err := natsBus.Subscribe(context.Background(), streamName+"-"+subject+"-redriven", streamName,
+		bus.WithFilterSubject(subject),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+	ids := make(chan string, 2)
+	assert.NoError(t, redrivenSubscription.AddHandler(subject, func(ctx context.Context, message bus.InboundMessage) error {
+		ids <- message.Id
+		return nil
+	}))
+	redrivenSubscription.Start(context.Background())
+	defer redrivenSubscription.Stop()
+
+	for range 2 {
+		select {
+		case id := <-ids:
+			assert.Equal(t, "1", id)
+		case <-time.After(5 * time.Second):
+			t.Fatal("redriven message not received")
+		}
+	}
+}
+
 type HandlerCall struct {
 	Ctx     context.Context
 	Message bus.InboundMessage
@@ -318,3 +394,195 @@ func waitForMessage(subscriptions ...*bus.Subscription) (context.Context, bus.In
 
 	return message.Ctx, message.Message, resChan
 }
+
+// TestBusSharedConnection asserts that a bus built on an injected connection
+// publishes and subscribes over it and leaves it open on Close.
+func TestBusSharedConnection(t *testing.T) {
+	streamName := "test-shared-connection"
+	subject := "test-shared-connection"
+
+	err := sharedtest.CreateNatsStream(sharedtest.NATS, streamName, subject)
+	assert.NoError(t, err)
+
+	conn, err := nats2.Connect(sharedtest.NATS)
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	natsBus, err := nats.New(&nats.Options{
+		Conn: conn,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, nats2.CONNECTED, natsBus.Status())
+
+	subscription, err := natsBus.Subscribe(context.Background(), streamName, streamName,
+		bus.WithFilterSubject(subject))
+	assert.NoError(t, err)
+
+	msgChan := make(chan bus.InboundMessage, 1)
+	assert.NoError(t, subscription.AddHandler(subject, func(ctx context.Context, message bus.InboundMessage) error {
+		msgChan <- message
+		return nil
+	}))
+	subscription.Start(context.Background())
+
+	assert.NoError(t, natsBus.Publish(context.Background(), &bus.OutboundMessage{
+		Id:      "shared",
+		Subject: subject,
+		Data:    []byte("shared"),
+	}))
+
+	select {
+	case message := <-msgChan:
+		assert.Equal(t, "shared", string(message.Data))
+	case <-time.After(5 * time.Second):
+		t.Fatal("message not received")
+	}
+
+	assert.NoError(t, natsBus.Close(context.Background()))
+	assert.Equal(t, nats2.CONNECTED, conn.Status())
+}
+
+func TestNATSMigrationPlan(t *testing.T) {
+	stream := fmt.Sprintf("migration-plan-%d", time.Now().UnixNano())
+	streamConfig := nats2.StreamConfig{
+		Name:     stream,
+		Subjects: []string{stream + ".>"},
+		Storage:  nats2.FileStorage,
+	}
+	consumerConfig := nats.ConsumerConfig{
+		Stream: stream,
+		ConsumerConfig: nats2.ConsumerConfig{
+			Durable:   "worker",
+			AckPolicy: nats2.AckExplicitPolicy,
+		},
+	}
+
+	natsBus, err := nats.New(&nats.Options{
+		NATSAddress: sharedtest.NATS,
+		Streams:     []nats2.StreamConfig{streamConfig},
+		Consumers:   []nats.ConsumerConfig{consumerConfig},
+	})
+	assert.NoError(t, err)
+
+	// a dry run plans the creation without applying it
+	plan, err := natsBus.MigrateWithOptions(context.Background(), nats.MigrationOptions{DryRun: true})
+	assert.NoError(t, err)
+	assert.Len(t, plan.Changes, 2)
+	_, err = sharedtest.GetNATSStream(sharedtest.NATS, stream)
+	assert.Error(t, err)
+
+	assert.NoError(t, natsBus.Migrate(context.Background()))
+
+	plan, err = natsBus.MigrateWithOptions(context.Background(), nats.MigrationOptions{DryRun: true})
+	assert.NoError(t, err)
+	assert.Empty(t, plan.Changes)
+
+	// storage cannot change in place
+	streamConfig.Storage = nats2.MemoryStorage
+	consumerConfig.MaxDeliver = 5
+	changedBus, err := nats.New(&nats.Options{
+		NATSAddress: sharedtest.NATS,
+		Streams:     []nats2.StreamConfig{streamConfig},
+		Consumers:   []nats.ConsumerConfig{consumerConfig},
+	})
+	assert.NoError(t, err)
+
+	_, err = changedBus.MigrateWithOptions(context.Background(), nats.MigrationOptions{})
+	assert.ErrorIs(t, err, nats.ErrChangeNotInPlace)
+
+	// a consumer created outside of Migrate
+	conn, err := nats2.Connect(sharedtest.NATS)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+	js, err := conn.JetStream()
+	assert.NoError(t, err)
+	_, err = js.AddConsumer(stream, &nats2.ConsumerConfig{Durable: "foreign", AckPolicy: nats2.AckExplicitPolicy})
+	assert.NoError(t, err)
+
+	streamConfig.Storage = nats2.FileStorage
+	prunedBus, err := nats.New(&nats.Options{
+		NATSAddress: sharedtest.NATS,
+		Streams:     []nats2.StreamConfig{streamConfig},
+	})
+	assert.NoError(t, err)
+
+	// undeclared durable consumers are pruned, unless Migrate did not create them
+	plan, err = prunedBus.MigrateWithOptions(context.Background(), nats.MigrationOptions{Prune: true, DryRun: true})
+	assert.NoError(t, err)
+	assert.Contains(t, plan.Changes, nats.MigrationChange{Action: nats.MigrationDelete, Stream: stream, Consumer: "worker"})
+	assert.NotContains(t, plan.Changes, nats.MigrationChange{Action: nats.MigrationDelete, Stream: stream, Consumer: "foreign"})
+}
+
+func TestNATSMigrationPrune(t *testing.T) {
+	prefix := fmt.Sprintf("migration-prune-%d", time.Now().UnixNano())
+	kept := nats2.StreamConfig{Name: prefix + "-kept", Subjects: []string{prefix + ".kept.>"}}
+	dropped := nats2.StreamConfig{Name: prefix + "-dropped", Subjects: []string{prefix + ".dropped.>"}}
+	consumer := func(name string) nats.ConsumerConfig {
+		return nats.ConsumerConfig{
+			Stream:         kept.Name,
+			ConsumerConfig: nats2.ConsumerConfig{Durable: name, AckPolicy: nats2.AckExplicitPolicy},
+		}
+	}
+
+	managedBus, err := nats.New(&nats.Options{
+		NATSAddress: sharedtest.NATS,
+		Streams:     []nats2.StreamConfig{kept, dropped},
+		Consumers:   []nats.ConsumerConfig{consumer("worker"), consumer("retired")},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	if !assert.NoError(t, managedBus.Migrate(context.Background())) {
+		return
+	}
+
+	// a stream and a consumer created outside of Migrate
+	conn, err := nats2.Connect(sharedtest.NATS)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+	js, err := conn.JetStream()
+	if !assert.NoError(t, err) {
+		return
+	}
+	foreign := prefix + "-foreign"
+	_, err = js.AddStream(&nats2.StreamConfig{Name: foreign, Subjects: []string{prefix + ".foreign.>"}})
+	assert.NoError(t, err)
+	defer func() {
+		_ = js.DeleteStream(foreign)
+	}()
+	_, err = js.AddConsumer(kept.Name, &nats2.ConsumerConfig{Durable: "foreign", AckPolicy: nats2.AckExplicitPolicy})
+	assert.NoError(t, err)
+
+	prunedBus, err := nats.New(&nats.Options{
+		NATSAddress: sharedtest.NATS,
+		Streams:     []nats2.StreamConfig{kept},
+		Consumers:   []nats.ConsumerConfig{consumer("worker")},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = prunedBus.MigrateWithOptions(context.Background(), nats.MigrationOptions{Prune: true})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		_ = js.DeleteStream(kept.Name)
+	}()
+
+	// only what Migrate created and no longer declares is deleted
+	_, err = js.StreamInfo(dropped.Name)
+	assert.ErrorIs(t, err, nats2.ErrStreamNotFound)
+	_, err = js.ConsumerInfo(kept.Name, "retired")
+	assert.ErrorIs(t, err, nats2.ErrConsumerNotFound)
+
+	_, err = js.StreamInfo(foreign)
+	assert.NoError(t, err)
+	_, err = js.ConsumerInfo(kept.Name, "foreign")
+	assert.NoError(t, err)
+	_, err = js.ConsumerInfo(kept.Name, "worker")
+	assert.NoError(t, err)
+}
@@ -1,7 +1,11 @@
 package tests
 
 import (
+	"context"
+	"fmt"
+	nats2 "github.com/nats-io/nats.go"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/vectrum-io/strongforce"
 	"github.com/vectrum-io/strongforce/pkg/bus/nats"
 	"github.com/vectrum-io/strongforce/pkg/db/mysql"
@@ -9,7 +13,10 @@ import (
 	"github.com/vectrum-io/strongforce/pkg/forwarder"
 	"github.com/vectrum-io/strongforce/pkg/outbox"
 	sharedtest "github.com/vectrum-io/strongforce/tests/shared"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 func TestClientCreationMySQL(t *testing.T) {
@@ -71,3 +78,102 @@ func TestClientCreationPostgres(t *testing.T) {
 
 	assert.NoError(t, client.DB().Connection().Ping())
 }
+
+func TestClientRunAndShutdown(t *testing.T) {
+	outboxTable := "client_lifecycle_1"
+
+	client, err := strongforce.New(
+		strongforce.WithMySQL(&mysql.Options{
+			DSN: sharedtest.MySQLDSN,
+			OutboxOptions: &outbox.Options{
+				TableName: outboxTable,
+			},
+		}),
+		strongforce.WithForwarder(&forwarder.Options{
+			OutboxTableName: outboxTable,
+			DirectEmit:      true,
+		}),
+		strongforce.WithNATS(&nats.Options{
+			NATSAddress: sharedtest.NATS,
+		}),
+	)
+	assert.NoError(t, err)
+
+	done := make(chan error)
+	go func() {
+		done <- client.Run(context.Background())
+	}()
+
+	require.Eventually(t, func() bool {
+		return forwarderRunning(client)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	assert.NoError(t, client.Shutdown(ctx))
+	assert.NoError(t, <-done)
+	assert.Error(t, client.DB().Connection().Ping())
+}
+
+func TestClientHealth(t *testing.T) {
+	outboxTable := "client_health_1"
+	// unique, so the stream starts out missing
+	stream := fmt.Sprintf("client-health-%d", time.Now().UnixNano())
+
+	natsOptions := &nats.Options{
+		NATSAddress: sharedtest.NATS,
+		Streams: []nats2.StreamConfig{
+			{
+				Name:     stream,
+				Subjects: []string{stream + ".>"},
+				Storage:  nats2.MemoryStorage,
+			},
+		},
+	}
+
+	client, err := strongforce.New(
+		strongforce.WithMySQL(&mysql.Options{
+			DSN: sharedtest.MySQLDSN,
+			OutboxOptions: &outbox.Options{
+				TableName: outboxTable,
+			},
+		}),
+		strongforce.WithForwarder(&forwarder.Options{
+			OutboxTableName: outboxTable,
+		}),
+		strongforce.WithNATS(natsOptions),
+	)
+	assert.NoError(t, err)
+
+	assert.NoError(t, client.Init())
+	assert.NoError(t, sharedtest.CreateOutboxTable(client.DB(), outboxTable))
+
+	require.Eventually(t, func() bool {
+		return forwarderRunning(client)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	report := client.Health(context.Background())
+	assert.Equal(t, strongforce.HealthUnhealthy, report.Status)
+	assert.Equal(t, []string{stream}, report.Bus.MissingStreams)
+
+	assert.NoError(t, client.Bus().(*nats.Bus).Migrate(context.Background()))
+
+	report = client.Health(context.Background())
+	assert.Equal(t, strongforce.HealthOK, report.Status)
+	assert.Equal(t, strongforce.HealthOK, report.DB.Status)
+	assert.True(t, report.Bus.JetStreamReachable)
+	assert.True(t, report.Forwarder.Running)
+	assert.Equal(t, int64(0), *report.Forwarder.OutboxDepth)
+
+	recorder := httptest.NewRecorder()
+	client.HealthHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	assert.NoError(t, client.Shutdown(context.Background()))
+}
+
+func forwarderRunning(client *strongforce.Client) bool {
+	report := client.Health(context.Background())
+	return report.Forwarder != nil && report.Forwarder.Running
+}
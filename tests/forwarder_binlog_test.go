@@ -0,0 +1,147 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/vectrum-io/strongforce/pkg/bus"
+	"github.com/vectrum-io/strongforce/pkg/db/mysql"
+	"github.com/vectrum-io/strongforce/pkg/forwarder"
+	"github.com/vectrum-io/strongforce/pkg/outbox"
+	"github.com/vectrum-io/strongforce/pkg/serialization"
+	"github.com/vectrum-io/strongforce/tests/mocks"
+	sharedtest "github.com/vectrum-io/strongforce/tests/shared"
+)
+
+func TestBinlogForwarder(t *testing.T) {
+	tableName := "event_outbox_binlog"
+	checkpointTableName := "binlog_checkpoint_test"
+
+	d, err := mysql.New(mysql.Options{
+		DSN: sharedtest.MySQLReplicationDSN,
+		OutboxOptions: &outbox.Options{
+			TableName:  tableName,
+			Serializer: serialization.NewJSONSerializer(),
+		},
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, d.Connect())
+	assert.NoError(t, sharedtest.CreateOutboxTable(d, tableName))
+	defer d.Close()
+
+	// start without a checkpoint
+	_, err = d.Connection().Exec("DROP TABLE IF EXISTS " + checkpointTableName)
+	assert.NoError(t, err)
+
+	options := &forwarder.BinlogOptions{
+		OutboxTableName:     tableName,
+		CheckpointTableName: checkpointTableName,
+		HeartbeatInterval:   500 * time.Millisecond,
+		RetryInterval:       50 * time.Millisecond,
+	}
+
+	// the first publish fails, so the stream is reopened at the checkpoint
+	mockBus := &mocks.Bus{}
+	mockBus.On("Publish", mock.Anything).Return(errors.New("bus down")).Once()
+	mockBus.On("Publish", mock.Anything).Return(nil).Times(2)
+
+	fw, err := forwarder.NewBinlogForwarder(d, mockBus, options)
+	assert.NoError(t, err)
+	stop := startBinlogForwarder(t, fw)
+
+	emitReplicatedEvents(t, d, "first", "second")
+	assertOutboxEmpty(t, d, tableName, 2*time.Second)
+	stop()
+	mockBus.AssertExpectations(t)
+
+	// a new forwarder resumes after the checkpoint
+	mockBus = &mocks.Bus{}
+	mockBus.On("Publish", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		assert.Equal(t, "replication.third", args.Get(0).(bus.OutboundMessage).Subject)
+	}).Once()
+
+	fw, err = forwarder.NewBinlogForwarder(d, mockBus, options)
+	assert.NoError(t, err)
+	stop = startBinlogForwarder(t, fw)
+
+	emitReplicatedEvents(t, d, "third")
+	assertOutboxEmpty(t, d, tableName, 2*time.Second)
+	stop()
+	mockBus.AssertExpectations(t)
+}
+
+func TestBinlogForwarderForwardsExistingEvents(t *testing.T) {
+	tableName := "event_outbox_binlog_existing"
+	checkpointTableName := "binlog_checkpoint_existing_test"
+
+	d, err := mysql.New(mysql.Options{
+		DSN: sharedtest.MySQLReplicationDSN,
+		OutboxOptions: &outbox.Options{
+			TableName:  tableName,
+			Serializer: serialization.NewJSONSerializer(),
+		},
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, d.Connect())
+	assert.NoError(t, sharedtest.CreateOutboxTable(d, tableName))
+	defer d.Close()
+
+	_, err = d.Connection().Exec("DROP TABLE IF EXISTS " + checkpointTableName)
+	assert.NoError(t, err)
+
+	// events inserted before the checkpoint exists are forwarded from the table
+	emitReplicatedEvents(t, d, "existing")
+
+	mockBus := &mocks.Bus{}
+	mockBus.On("Publish", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		assert.Equal(t, "replication.existing", args.Get(0).(bus.OutboundMessage).Subject)
+	}).Once()
+
+	fw, err := forwarder.NewBinlogForwarder(d, mockBus, &forwarder.BinlogOptions{
+		OutboxTableName:     tableName,
+		CheckpointTableName: checkpointTableName,
+		RetryInterval:       50 * time.Millisecond,
+	})
+	assert.NoError(t, err)
+	stop := startBinlogForwarder(t, fw)
+
+	assertOutboxEmpty(t, d, tableName, 2*time.Second)
+	stop()
+	mockBus.AssertExpectations(t)
+}
+
+func TestBinlogForwarderRequiresMySQL(t *testing.T) {
+	d := newDirectEmitDB(t, "postgres", "event_outbox_binlog")
+	assert.NoError(t, d.Connect())
+	defer d.Close()
+
+	fw, err := forwarder.NewBinlogForwarder(d, &mocks.Bus{}, nil)
+	assert.NoError(t, err)
+	assert.ErrorIs(t, fw.Start(context.Background()), forwarder.ErrFatal)
+}
+
+// startBinlogForwarder starts fw once its checkpoint is set up. The returned
+// func stops it and waits until its stream is closed.
+func startBinlogForwarder(t *testing.T, fw *forwarder.BinlogForwarder) func() {
+	t.Helper()
+
+	done := make(chan error)
+	go func() {
+		done <- fw.Start(context.Background())
+	}()
+
+	// the stream is open once it received its first event
+	assert.Eventually(t, func() bool {
+		status, _ := fw.Status(context.Background())
+		return !status.LastPollAt.IsZero()
+	}, 5*time.Second, 10*time.Millisecond)
+
+	return func() {
+		assert.NoError(t, fw.Stop())
+		assert.NoError(t, <-done)
+	}
+}
@@ -0,0 +1,385 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/vectrum-io/strongforce/pkg/bus"
+	"github.com/vectrum-io/strongforce/pkg/db"
+	"github.com/vectrum-io/strongforce/pkg/db/mysql"
+	"github.com/vectrum-io/strongforce/pkg/db/postgres"
+	"github.com/vectrum-io/strongforce/pkg/events"
+	"github.com/vectrum-io/strongforce/pkg/forwarder"
+	"github.com/vectrum-io/strongforce/pkg/outbox"
+	"github.com/vectrum-io/strongforce/pkg/serialization"
+	"github.com/vectrum-io/strongforce/tests/mocks"
+	sharedtest "github.com/vectrum-io/strongforce/tests/shared"
+)
+
+func TestReplicationForwarder(t *testing.T) {
+	tableName := "event_outbox_repl"
+	d := newReplicationDB(t, tableName)
+	assert.NoError(t, d.Connect())
+	assert.NoError(t, sharedtest.CreateOutboxTable(d, tableName))
+	defer d.Close()
+
+	name := fmt.Sprintf("strongforce_test_%d", time.Now().UnixNano())
+	defer dropReplication(t, d, name)
+
+	options := &forwarder.ReplicationOptions{
+		SlotName:        name,
+		PublicationName: name,
+		OutboxTableName: tableName,
+		PollingInterval: 50 * time.Millisecond,
+	}
+
+	// the first publish fails, so nothing is confirmed until it is retried
+	mockBus := &mocks.Bus{}
+	mockBus.On("Publish", mock.Anything).Return(errors.New("bus down")).Once()
+	mockBus.On("Publish", mock.Anything).Return(nil).Times(2)
+
+	fw, err := forwarder.NewReplicationForwarder(d, mockBus, options)
+	assert.NoError(t, err)
+	stop := startReplicationForwarder(t, fw)
+
+	emitReplicatedEvents(t, d, "first", "second")
+	assertOutboxEmpty(t, d, tableName, 2*time.Second)
+	stop()
+	mockBus.AssertExpectations(t)
+
+	// a new forwarder resumes after the confirmed changes
+	mockBus = &mocks.Bus{}
+	mockBus.On("Publish", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		assert.Equal(t, "replication.third", args.Get(0).(bus.OutboundMessage).Subject)
+	}).Once()
+
+	fw, err = forwarder.NewReplicationForwarder(d, mockBus, options)
+	assert.NoError(t, err)
+	stop = startReplicationForwarder(t, fw)
+
+	emitReplicatedEvents(t, d, "third")
+	assertOutboxEmpty(t, d, tableName, 2*time.Second)
+	stop()
+	mockBus.AssertExpectations(t)
+}
+
+func TestReplicationForwarderLogicalMessages(t *testing.T) {
+	name := fmt.Sprintf("strongforce_test_%d", time.Now().UnixNano())
+
+	// the outbox emits messages, so no outbox table exists
+	d, err := postgres.New(postgres.Options{
+		DSN: sharedtest.PostgresReplicationDSN,
+		OutboxOptions: &outbox.Options{
+			TableName:            name,
+			Serializer:           serialization.NewJSONSerializer(),
+			LogicalMessagePrefix: name,
+		},
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, d.Connect())
+	defer d.Close()
+	defer dropReplication(t, d, name)
+
+	var (
+		mu        sync.Mutex
+		published []bus.OutboundMessage
+	)
+	mockBus := &mocks.Bus{}
+	mockBus.On("Publish", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		mu.Lock()
+		published = append(published, args.Get(0).(bus.OutboundMessage))
+		mu.Unlock()
+	})
+
+	fw, err := forwarder.NewReplicationForwarder(d, mockBus, &forwarder.ReplicationOptions{
+		SlotName:        name,
+		PublicationName: name,
+		MessagePrefix:   name,
+		PollingInterval: 50 * time.Millisecond,
+	})
+	assert.NoError(t, err)
+	stop := startReplicationForwarder(t, fw)
+	defer stop()
+
+	ctx := events.ContextWithCause(context.Background(), "inbound-message", "chain")
+	eventBuilder := &events.Builder{}
+	ids, err := d.EventsTx(ctx, func(ctx context.Context, tx *sqlx.Tx) ([]*events.EventSpec, error) {
+		first, err := eventBuilder.New("messages.first", &jsonPayloadForDirect{Data: "first"})
+		if err != nil {
+			return nil, err
+		}
+		second, err := eventBuilder.New("messages.second", &jsonPayloadForDirect{Data: "second"})
+		if err != nil {
+			return nil, err
+		}
+		return []*events.EventSpec{first, second}, nil
+	})
+	if !assert.NoError(t, err) || !assert.Len(t, ids, 2) {
+		return
+	}
+
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(published) == 2
+	}, 2*time.Second, 20*time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !assert.Len(t, published, 2) {
+		return
+	}
+	for i, subject := range []string{"messages.first", "messages.second"} {
+		assert.Equal(t, ids[i].String(), published[i].Id)
+		assert.Equal(t, subject, published[i].Subject)
+		assert.Equal(t, "inbound-message", published[i].Headers[bus.CausationIdHeader])
+		assert.Equal(t, "chain", published[i].Headers[bus.CorrelationIdHeader])
+	}
+	assert.JSONEq(t, `{"data":"first"}`, string(published[0].Data))
+}
+
+func TestReplicationForwarderAdvancesIdleSlot(t *testing.T) {
+	tableName := "event_outbox_repl_idle"
+	d := newReplicationDB(t, tableName)
+	assert.NoError(t, d.Connect())
+	assert.NoError(t, sharedtest.CreateOutboxTable(d, tableName))
+	defer d.Close()
+
+	name := fmt.Sprintf("strongforce_test_%d", time.Now().UnixNano())
+	defer dropReplication(t, d, name)
+
+	fw, err := forwarder.NewReplicationForwarder(d, &mocks.Bus{}, &forwarder.ReplicationOptions{
+		SlotName:        name,
+		PublicationName: name,
+		OutboxTableName: tableName,
+		PollingInterval: 50 * time.Millisecond,
+	})
+	assert.NoError(t, err)
+	stop := startReplicationForwarder(t, fw)
+	defer stop()
+
+	// WAL written by anything but the outbox
+	var lsn string
+	assert.NoError(t, d.Connection().Get(&lsn, "SELECT pg_current_wal_lsn() FROM (SELECT pg_logical_emit_message(false, 'unrelated', 'x')) AS emitted"))
+
+	assert.Eventually(t, func() bool {
+		var advanced bool
+		err := d.Connection().Get(&advanced, "SELECT confirmed_flush_lsn >= $2::pg_lsn FROM pg_replication_slots WHERE slot_name = $1", name, lsn)
+		return err == nil && advanced
+	}, 2*time.Second, 20*time.Millisecond)
+}
+
+func TestReplicationForwarderStopsAtUndecodableMessages(t *testing.T) {
+	name := fmt.Sprintf("strongforce_test_%d", time.Now().UnixNano())
+
+	d, err := postgres.New(postgres.Options{
+		DSN: sharedtest.PostgresReplicationDSN,
+		OutboxOptions: &outbox.Options{
+			TableName:            name,
+			Serializer:           serialization.NewJSONSerializer(),
+			LogicalMessagePrefix: name,
+		},
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, d.Connect())
+	defer d.Close()
+	defer dropReplication(t, d, name)
+
+	published := make(chan bus.OutboundMessage, 2)
+	mockBus := &mocks.Bus{}
+	mockBus.On("Publish", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		published <- args.Get(0).(bus.OutboundMessage)
+	})
+
+	fw, err := forwarder.NewReplicationForwarder(d, mockBus, &forwarder.ReplicationOptions{
+		SlotName:        name,
+		PublicationName: name,
+		MessagePrefix:   name,
+		PollingInterval: 50 * time.Millisecond,
+	})
+	assert.NoError(t, err)
+
+	done := make(chan error)
+	go func() {
+		done <- fw.Start(context.Background())
+	}()
+	require.Eventually(t, func() bool {
+		status, _ := fw.Status(context.Background())
+		return status.Running
+	}, 5*time.Second, 10*time.Millisecond)
+
+	eventBuilder := &events.Builder{}
+	emit := func(topic string) *events.EventID {
+		id, err := d.EventTx(context.Background(), func(ctx context.Context, tx *sqlx.Tx) (*events.EventSpec, error) {
+			return eventBuilder.New(topic, &jsonPayloadForDirect{Data: topic})
+		})
+		require.NoError(t, err)
+		return id
+	}
+
+	before := emit("messages.before")
+	var lsn string
+	require.NoError(t, d.Connection().Get(&lsn, "SELECT pg_current_wal_lsn() FROM (SELECT pg_logical_emit_message(true, $1, '{')) AS emitted", name))
+	emit("messages.after")
+
+	select {
+	case err := <-done:
+		assert.ErrorIs(t, err, forwarder.ErrFatal)
+	case <-time.After(5 * time.Second):
+		_ = fw.Stop()
+		t.Fatal("forwarder did not stop at the undecodable message")
+	}
+
+	// the event before it is forwarded, the slot is not confirmed past it
+	if assert.Len(t, published, 1) {
+		assert.Equal(t, before.String(), (<-published).Id)
+	}
+	var confirmedPast bool
+	assert.NoError(t, d.Connection().Get(&confirmedPast, "SELECT confirmed_flush_lsn >= $2::pg_lsn FROM pg_replication_slots WHERE slot_name = $1", name, lsn))
+	assert.False(t, confirmedPast)
+}
+
+func TestReplicationForwarderStopsAtUndecodableInserts(t *testing.T) {
+	tableName := "event_outbox_repl_undecodable"
+	d := newReplicationDB(t, tableName)
+	assert.NoError(t, d.Connect())
+	assert.NoError(t, sharedtest.CreateOutboxTable(d, tableName))
+	defer d.Close()
+
+	// rows without an id cannot be turned into events
+	_, err := d.Connection().Exec(fmt.Sprintf("ALTER TABLE %[1]s DROP CONSTRAINT %[1]s_pkey, ALTER COLUMN id DROP NOT NULL", tableName))
+	require.NoError(t, err)
+
+	name := fmt.Sprintf("strongforce_test_%d", time.Now().UnixNano())
+	defer dropReplication(t, d, name)
+
+	published := make(chan bus.OutboundMessage, 2)
+	mockBus := &mocks.Bus{}
+	mockBus.On("Publish", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		published <- args.Get(0).(bus.OutboundMessage)
+	})
+
+	fw, err := forwarder.NewReplicationForwarder(d, mockBus, &forwarder.ReplicationOptions{
+		SlotName:        name,
+		PublicationName: name,
+		OutboxTableName: tableName,
+		PollingInterval: 50 * time.Millisecond,
+	})
+	assert.NoError(t, err)
+
+	done := make(chan error)
+	go func() {
+		done <- fw.Start(context.Background())
+	}()
+	require.Eventually(t, func() bool {
+		status, _ := fw.Status(context.Background())
+		return status.Running
+	}, 5*time.Second, 10*time.Millisecond)
+
+	eventBuilder := &events.Builder{}
+	emit := func(topic string) *events.EventID {
+		id, err := d.EventTx(context.Background(), func(ctx context.Context, tx *sqlx.Tx) (*events.EventSpec, error) {
+			return eventBuilder.New(topic, &jsonPayloadForDirect{Data: topic})
+		})
+		require.NoError(t, err)
+		return id
+	}
+
+	before := emit("inserts.before")
+	var lsn string
+	require.NoError(t, d.Connection().Get(&lsn, fmt.Sprintf("INSERT INTO %s (topic, payload) VALUES ('inserts.undecodable', '{') RETURNING pg_current_wal_lsn()", tableName)))
+	emit("inserts.after")
+
+	select {
+	case err := <-done:
+		assert.ErrorIs(t, err, forwarder.ErrFatal)
+	case <-time.After(5 * time.Second):
+		_ = fw.Stop()
+		t.Fatal("forwarder did not stop at the undecodable insert")
+	}
+
+	// the event before it is forwarded, the slot is not confirmed past it
+	if assert.Len(t, published, 1) {
+		assert.Equal(t, before.String(), (<-published).Id)
+	}
+	var confirmedPast bool
+	assert.NoError(t, d.Connection().Get(&confirmedPast, "SELECT confirmed_flush_lsn >= $2::pg_lsn FROM pg_replication_slots WHERE slot_name = $1", name, lsn))
+	assert.False(t, confirmedPast)
+}
+
+func TestLogicalMessagesUnsupportedMySQL(t *testing.T) {
+	_, err := mysql.New(mysql.Options{
+		DSN:           sharedtest.MySQLDSN,
+		OutboxOptions: &outbox.Options{LogicalMessagePrefix: "event_outbox"},
+	})
+	assert.ErrorIs(t, err, mysql.ErrLogicalMessagesUnsupported)
+}
+
+// newReplicationDB connects to the Postgres 16 instance, which has logical
+// replication enabled and supports logical messages.
+func newReplicationDB(t *testing.T, tableName string) db.DB {
+	t.Helper()
+	d, err := postgres.New(postgres.Options{
+		DSN: sharedtest.PostgresReplicationDSN,
+		OutboxOptions: &outbox.Options{
+			TableName:  tableName,
+			Serializer: serialization.NewJSONSerializer(),
+		},
+	})
+	assert.NoError(t, err)
+	return d
+}
+
+// startReplicationForwarder starts fw once its slot is set up. The returned
+// func stops it and waits until its session is closed.
+func startReplicationForwarder(t *testing.T, fw *forwarder.ReplicationForwarder) func() {
+	t.Helper()
+
+	done := make(chan error)
+	go func() {
+		done <- fw.Start(context.Background())
+	}()
+
+	assert.Eventually(t, func() bool {
+		status, _ := fw.Status(context.Background())
+		return status.Running
+	}, 5*time.Second, 10*time.Millisecond)
+
+	return func() {
+		assert.NoError(t, fw.Stop())
+		assert.NoError(t, <-done)
+	}
+}
+
+func emitReplicatedEvents(t *testing.T, d db.DB, names ...string) {
+	t.Helper()
+
+	eventBuilder := &events.Builder{}
+	_, err := d.EventsTx(context.Background(), func(ctx context.Context, tx *sqlx.Tx) ([]*events.EventSpec, error) {
+		specs := make([]*events.EventSpec, 0, len(names))
+		for _, name := range names {
+			e, err := eventBuilder.New("replication."+name, &jsonPayloadForDirect{Data: name})
+			if err != nil {
+				return nil, err
+			}
+			specs = append(specs, e)
+		}
+		return specs, nil
+	})
+	assert.NoError(t, err)
+}
+
+func dropReplication(t *testing.T, d db.DB, name string) {
+	_, err := d.Connection().Exec("SELECT pg_drop_replication_slot($1)", name)
+	assert.NoError(t, err)
+	_, err = d.Connection().Exec(fmt.Sprintf("DROP PUBLICATION %s", name))
+	assert.NoError(t, err)
+}
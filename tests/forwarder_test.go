@@ -4,15 +4,20 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"github.com/jmoiron/sqlx"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"github.com/vectrum-io/strongforce/pkg/bus"
 	"github.com/vectrum-io/strongforce/pkg/db"
 	"github.com/vectrum-io/strongforce/pkg/db/mysql"
 	"github.com/vectrum-io/strongforce/pkg/db/postgres"
+	"github.com/vectrum-io/strongforce/pkg/events"
 	"github.com/vectrum-io/strongforce/pkg/forwarder"
+	"github.com/vectrum-io/strongforce/pkg/outbox"
 	"github.com/vectrum-io/strongforce/pkg/serialization"
 	"github.com/vectrum-io/strongforce/tests/mocks"
 	sharedtest "github.com/vectrum-io/strongforce/tests/shared"
+	"sync"
 	"testing"
 	"time"
 )
@@ -83,6 +88,77 @@ func TestForwardFailedPostgres(t *testing.T) {
 	testForwardFailed(t, mockBus, db, tableName)
 }
 
+func TestForwardBatchesMySQL(t *testing.T) {
+	db, err := mysql.New(mysql.Options{
+		DSN: sharedtest.MySQLDSN,
+	})
+	assert.NoError(t, err)
+
+	testForwardBatches(t, db, "event_outbox_fw_3")
+}
+
+func TestForwardBatchesPostgres(t *testing.T) {
+	db, err := postgres.New(postgres.Options{
+		DSN: sharedtest.PostgresDSN,
+	})
+	assert.NoError(t, err)
+
+	testForwardBatches(t, db, "event_outbox_fw_3")
+}
+
+func TestForwardNotifyPostgres(t *testing.T) {
+	tableName := "event_outbox_fw_notify"
+	db, err := postgres.New(postgres.Options{
+		DSN: sharedtest.PostgresDSN,
+		OutboxOptions: &outbox.Options{
+			TableName:     tableName,
+			Serializer:    serialization.NewJSONSerializer(),
+			NotifyChannel: tableName,
+		},
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, db.Connect())
+	assert.NoError(t, sharedtest.CreateOutboxTable(db, tableName))
+	defer db.Close()
+
+	mockBus := &mocks.Bus{}
+	mockBus.On("Publish", mock.Anything).Return(nil).Once()
+
+	fw, err := forwarder.New(db, mockBus, &forwarder.Options{
+		// only a notification can forward the event in time
+		PollingInterval: 10 * time.Second,
+		Serializer:      serialization.NewJSONSerializer(),
+		OutboxTableName: tableName,
+		NotifyChannel:   tableName,
+	})
+	assert.NoError(t, err)
+
+	go func() {
+		fw.Start(context.Background())
+	}()
+	defer fw.Stop()
+
+	// give the listener time to connect
+	time.Sleep(200 * time.Millisecond)
+
+	eventBuilder := &events.Builder{}
+	_, err = db.EventTx(context.Background(), func(ctx context.Context, tx *sqlx.Tx) (*events.EventSpec, error) {
+		return eventBuilder.New("notify.topic", &jsonPayloadForDirect{Data: "wake up"})
+	})
+	assert.NoError(t, err)
+
+	assertOutboxEmpty(t, db, tableName, 2*time.Second)
+	mockBus.AssertExpectations(t)
+}
+
+func TestNotifyUnsupportedMySQL(t *testing.T) {
+	_, err := mysql.New(mysql.Options{
+		DSN:           sharedtest.MySQLDSN,
+		OutboxOptions: &outbox.Options{NotifyChannel: "event_outbox"},
+	})
+	assert.ErrorIs(t, err, mysql.ErrNotifyUnsupported)
+}
+
 func testForward(t *testing.T, mockBus *mocks.Bus, db db.DB, tableName string) {
 	assert.NoError(t, db.Connect())
 	assert.NoError(t, sharedtest.CreateOutboxTable(db, tableName))
@@ -166,3 +242,107 @@ func testForwardFailed(t *testing.T, mockBus *mocks.Bus, db db.DB, tableName str
 	assert.NoError(t, fw.Stop())
 	assert.NoError(t, db.Close())
 }
+
+// testForwardBatches has two forwarders drain a backlog of many batches
+// concurrently. Full batches are drained without waiting for the next tick,
+// and SKIP LOCKED keeps the forwarders from publishing the same row twice.
+func testForwardBatches(t *testing.T, db db.DB, tableName string) {
+	assert.NoError(t, db.Connect())
+	assert.NoError(t, sharedtest.CreateOutboxTable(db, tableName))
+
+	const backlog = 250
+
+	var (
+		mu        sync.Mutex
+		published = map[string]int{}
+	)
+	mockBus := &mocks.Bus{}
+	mockBus.On("Publish", mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		mu.Lock()
+		published[args.Get(0).(bus.OutboundMessage).Id]++
+		mu.Unlock()
+	})
+
+	for i := 0; i < backlog; i++ {
+		//goland:noinspection ALL
+		_, err := db.Connection().Exec(db.Connection().Rebind(
+			fmt.Sprintf("INSERT INTO %s (id, topic, payload, created_at) VALUES (?, ?, ?, ?)", tableName),
+		), fmt.Sprintf("test-event-%03d", i), "test", []byte{69, 42, 0}, time.Now())
+		assert.NoError(t, err)
+	}
+
+	forwarders := make([]*forwarder.DBForwarder, 2)
+	for i := range forwarders {
+		fw, err := forwarder.New(db, mockBus, &forwarder.Options{
+			PollingInterval: 500 * time.Millisecond,
+			BatchSize:       20,
+			Serializer:      serialization.NewJSONSerializer(),
+			OutboxTableName: tableName,
+		})
+		assert.NoError(t, err)
+		forwarders[i] = fw
+
+		go func() {
+			fw.Start(context.Background())
+		}()
+	}
+
+	// one tick per batch would take over 3s
+	time.Sleep(1500 * time.Millisecond)
+
+	obEvents, err := sharedtest.GetEventEntities(db, tableName)
+	assert.NoError(t, err)
+	assert.Len(t, obEvents, 0)
+
+	mu.Lock()
+	assert.Len(t, published, backlog)
+	for id, count := range published {
+		assert.Equal(t, 1, count, "event %s published more than once", id)
+	}
+	mu.Unlock()
+
+	for _, fw := range forwarders {
+		assert.NoError(t, fw.Stop())
+	}
+	assert.NoError(t, db.Close())
+}
+
+func TestForwarderStatusOutboxAge(t *testing.T) {
+	for _, driver := range dbDrivers {
+		t.Run(driver, func(t *testing.T) {
+			tableName := "event_outbox_fw_status"
+
+			db, err := createDB(driver, tableName, serialization.NewJSONSerializer())
+			assert.NoError(t, err)
+			assert.NoError(t, db.Connect())
+			assert.NoError(t, sharedtest.CreateOutboxTable(db, tableName))
+
+			fw, err := forwarder.New(db, &mocks.Bus{}, &forwarder.Options{
+				Serializer:      serialization.NewJSONSerializer(),
+				OutboxTableName: tableName,
+			})
+			assert.NoError(t, err)
+
+			// created on the database clock, so the age must not depend on
+			// the session time zone
+			age := "INTERVAL 2 HOUR"
+			if driver == "postgres" {
+				age = "INTERVAL '2 hours'"
+			}
+			//goland:noinspection ALL
+			_, err = db.Connection().Exec(db.Connection().Rebind(
+				fmt.Sprintf("INSERT INTO %s (id, topic, payload, created_at) VALUES (?, ?, ?, CURRENT_TIMESTAMP - %s)", tableName, age),
+			), "test-event", "test", []byte{69, 42, 0})
+			assert.NoError(t, err)
+
+			status, err := fw.Status(context.Background())
+			if !assert.NoError(t, err) || !assert.NotNil(t, status.Outbox) {
+				return
+			}
+			assert.Equal(t, int64(1), status.Outbox.Depth)
+			assert.InDelta(t, (2 * time.Hour).Seconds(), status.Outbox.OldestEventAge.Seconds(), 60)
+
+			assert.NoError(t, db.Close())
+		})
+	}
+}
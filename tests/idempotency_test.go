@@ -0,0 +1,179 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/vectrum-io/strongforce/pkg/db"
+	"github.com/vectrum-io/strongforce/pkg/db/mysql"
+	"github.com/vectrum-io/strongforce/pkg/db/postgres"
+	"github.com/vectrum-io/strongforce/pkg/events"
+	"github.com/vectrum-io/strongforce/pkg/idempotency"
+	"github.com/vectrum-io/strongforce/pkg/outbox"
+	"github.com/vectrum-io/strongforce/pkg/serialization"
+	sharedtest "github.com/vectrum-io/strongforce/tests/shared"
+)
+
+func createIdempotentDB(driver string, outboxTable string, keyTable string) (db.DB, error) {
+	outboxOptions := &outbox.Options{
+		TableName:  outboxTable,
+		Serializer: serialization.NewJSONSerializer(),
+	}
+	idempotencyOptions := &idempotency.Options{
+		TableName: keyTable,
+		Expiry:    time.Hour,
+	}
+
+	if driver == "mysql" {
+		return mysql.New(mysql.Options{
+			DSN:                sharedtest.MySQLDSN,
+			OutboxOptions:      outboxOptions,
+			IdempotencyOptions: idempotencyOptions,
+		})
+	} else if driver == "postgres" {
+		return postgres.New(postgres.Options{
+			DSN:                sharedtest.PostgresDSN,
+			OutboxOptions:      outboxOptions,
+			IdempotencyOptions: idempotencyOptions,
+		})
+	}
+
+	return nil, fmt.Errorf("unsupported driver: %s", driver)
+}
+
+func TestIdempotencyKeyReplaysEventIds(t *testing.T) {
+	outboxTable := "idempotency_outbox"
+	keyTable := "idempotency_keys"
+	eventBuilder := events.Builder{}
+
+	for _, driver := range dbDrivers {
+		t.Run(driver, func(t *testing.T) {
+			sfDB, err := createIdempotentDB(driver, outboxTable, keyTable)
+			assert.NoError(t, err)
+			assert.NoError(t, sfDB.Connect())
+			assert.NoError(t, sharedtest.CreateOutboxTable(sfDB, outboxTable))
+			assert.NoError(t, sharedtest.CreateIdempotencyTable(sfDB, keyTable))
+
+			calls := 0
+			emit := func() ([]events.EventID, error) {
+				return sfDB.EventsTx(context.Background(), func(ctx context.Context, tx *sqlx.Tx) ([]*events.EventSpec, error) {
+					calls++
+					e1, err := eventBuilder.New("topic.1", &jsonPayload{Data: "test1"})
+					assert.NoError(t, err)
+					e2, err := eventBuilder.New("topic.2", &jsonPayload{Data: "test2"})
+					assert.NoError(t, err)
+					return []*events.EventSpec{e1, e2}, nil
+				}, db.WithIdempotencyKey("command-1"))
+			}
+
+			firstIds, err := emit()
+			assert.NoError(t, err)
+			assert.Len(t, firstIds, 2)
+
+			retryIds, err := emit()
+			assert.NoError(t, err)
+			assert.Equal(t, firstIds, retryIds)
+			assert.Equal(t, 1, calls)
+
+			obEvents, err := sharedtest.GetEventEntities(sfDB, outboxTable)
+			assert.NoError(t, err)
+			assert.Len(t, obEvents, 2)
+
+			assert.NoError(t, sfDB.Close())
+		})
+	}
+}
+
+func TestIdempotencyKeyNotRecordedOnFailure(t *testing.T) {
+	outboxTable := "idempotency_outbox_2"
+	keyTable := "idempotency_keys_2"
+	eventBuilder := events.Builder{}
+
+	for _, driver := range dbDrivers {
+		t.Run(driver, func(t *testing.T) {
+			sfDB, err := createIdempotentDB(driver, outboxTable, keyTable)
+			assert.NoError(t, err)
+			assert.NoError(t, sfDB.Connect())
+			assert.NoError(t, sharedtest.CreateOutboxTable(sfDB, outboxTable))
+			assert.NoError(t, sharedtest.CreateIdempotencyTable(sfDB, keyTable))
+
+			_, err = sfDB.EventTx(context.Background(), func(ctx context.Context, tx *sqlx.Tx) (*events.EventSpec, error) {
+				return nil, fmt.Errorf("command failed")
+			}, db.WithIdempotencyKey("command-1"))
+			assert.Error(t, err)
+
+			// the key was rolled back together with the failed attempt, so the retry runs
+			eventId, err := sfDB.EventTx(context.Background(), func(ctx context.Context, tx *sqlx.Tx) (*events.EventSpec, error) {
+				return eventBuilder.New("topic.1", &jsonPayload{Data: "test1"})
+			}, db.WithIdempotencyKey("command-1"))
+			assert.NoError(t, err)
+			assert.NotNil(t, eventId)
+
+			assert.NoError(t, sfDB.Close())
+		})
+	}
+}
+
+func TestIdempotencyKeyExpires(t *testing.T) {
+	outboxTable := "idempotency_outbox_4"
+	keyTable := "idempotency_keys_4"
+	eventBuilder := events.Builder{}
+
+	for _, driver := range dbDrivers {
+		t.Run(driver, func(t *testing.T) {
+			sfDB, err := createIdempotentDB(driver, outboxTable, keyTable)
+			assert.NoError(t, err)
+			assert.NoError(t, sfDB.Connect())
+			assert.NoError(t, sharedtest.CreateOutboxTable(sfDB, outboxTable))
+			assert.NoError(t, sharedtest.CreateIdempotencyTable(sfDB, keyTable))
+
+			emit := func() (*events.EventID, error) {
+				return sfDB.EventTx(context.Background(), func(ctx context.Context, tx *sqlx.Tx) (*events.EventSpec, error) {
+					return eventBuilder.New("topic.1", &jsonPayload{Data: "test1"})
+				}, db.WithIdempotencyKey("command-1"))
+			}
+
+			firstId, err := emit()
+			assert.NoError(t, err)
+
+			// age the key past the one hour expiry without running cleanup
+			age := "INTERVAL 2 HOUR"
+			if driver == "postgres" {
+				age = "INTERVAL '2 hours'"
+			}
+			_, err = sfDB.Connection().Exec(fmt.Sprintf("UPDATE %s SET created_at = created_at - %s", keyTable, age))
+			assert.NoError(t, err)
+
+			retryId, err := emit()
+			assert.NoError(t, err)
+			assert.NotEqual(t, firstId, retryId)
+
+			obEvents, err := sharedtest.GetEventEntities(sfDB, outboxTable)
+			assert.NoError(t, err)
+			assert.Len(t, obEvents, 2)
+
+			assert.NoError(t, sfDB.Close())
+		})
+	}
+}
+
+func TestIdempotencyKeyRequiresStore(t *testing.T) {
+	for _, driver := range dbDrivers {
+		t.Run(driver, func(t *testing.T) {
+			sfDB, err := createDB(driver, "idempotency_outbox_3", serialization.NewJSONSerializer())
+			assert.NoError(t, err)
+			assert.NoError(t, sfDB.Connect())
+
+			_, err = sfDB.EventTx(context.Background(), func(ctx context.Context, tx *sqlx.Tx) (*events.EventSpec, error) {
+				return nil, nil
+			}, db.WithIdempotencyKey("command-1"))
+			assert.Error(t, err)
+
+			assert.NoError(t, sfDB.Close())
+		})
+	}
+}
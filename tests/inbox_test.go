@@ -0,0 +1,153 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/vectrum-io/strongforce/pkg/bus"
+	"github.com/vectrum-io/strongforce/pkg/events"
+	"github.com/vectrum-io/strongforce/pkg/inbox"
+	"github.com/vectrum-io/strongforce/pkg/outbox"
+	"github.com/vectrum-io/strongforce/pkg/serialization"
+	sharedtest "github.com/vectrum-io/strongforce/tests/shared"
+)
+
+func TestInboxDeduplicates(t *testing.T) {
+	for _, driver := range dbDrivers {
+		t.Run(driver, func(t *testing.T) {
+			inboxTable := "event_inbox_ib_1"
+
+			db, err := createDB(driver, "event_outbox_ib_1", serialization.NewJSONSerializer())
+			assert.NoError(t, err)
+			assert.NoError(t, db.Connect())
+			assert.NoError(t, sharedtest.CreateInboxTable(db, inboxTable))
+
+			ib, err := inbox.New(db, &inbox.Options{
+				TableName: inboxTable,
+				Consumer:  "inbox-test",
+			})
+			assert.NoError(t, err)
+
+			calls := 0
+			handler := ib.Handler("inbox.test", func(ctx context.Context, tx *sqlx.Tx, message bus.InboundMessage) error {
+				calls++
+				return nil
+			})
+
+			message := bus.InboundMessage{Id: "msg-1", Subject: "inbox.test"}
+			assert.NoError(t, handler(context.Background(), message))
+			assert.NoError(t, handler(context.Background(), message))
+			assert.Equal(t, 1, calls)
+
+			assert.NoError(t, handler(context.Background(), bus.InboundMessage{Id: "msg-2", Subject: "inbox.test"}))
+			assert.Equal(t, 2, calls)
+
+			// another handler matching the same message processes it too
+			otherCalls := 0
+			other := ib.Handler("inbox.*", func(ctx context.Context, tx *sqlx.Tx, message bus.InboundMessage) error {
+				otherCalls++
+				return nil
+			})
+			assert.NoError(t, other(context.Background(), message))
+			assert.NoError(t, other(context.Background(), message))
+			assert.Equal(t, 1, otherCalls)
+			assert.Equal(t, 2, calls)
+
+			assert.NoError(t, db.Close())
+		})
+	}
+}
+
+func TestInboxRollsBackOnHandlerError(t *testing.T) {
+	for _, driver := range dbDrivers {
+		t.Run(driver, func(t *testing.T) {
+			inboxTable := "event_inbox_ib_2"
+
+			db, err := createDB(driver, "event_outbox_ib_2", serialization.NewJSONSerializer())
+			assert.NoError(t, err)
+			assert.NoError(t, db.Connect())
+			assert.NoError(t, sharedtest.CreateInboxTable(db, inboxTable))
+
+			ib, err := inbox.New(db, &inbox.Options{
+				TableName: inboxTable,
+				Consumer:  "inbox-test",
+			})
+			assert.NoError(t, err)
+
+			handlerErr := errors.New("handler failed")
+			calls := 0
+			handler := ib.Handler("inbox.test", func(ctx context.Context, tx *sqlx.Tx, message bus.InboundMessage) error {
+				calls++
+				if calls == 1 {
+					return handlerErr
+				}
+				return nil
+			})
+
+			message := bus.InboundMessage{Id: "msg-1", Subject: "inbox.test"}
+			assert.ErrorIs(t, handler(context.Background(), message), handlerErr)
+
+			// the failed attempt must not have been recorded, so the redelivery runs the handler again
+			assert.NoError(t, handler(context.Background(), message))
+			assert.Equal(t, 2, calls)
+
+			var count int
+			assert.NoError(t, db.Connection().Get(&count, fmt.Sprintf("SELECT COUNT(*) FROM %s", inboxTable)))
+			assert.Equal(t, 1, count)
+
+			assert.NoError(t, db.Close())
+		})
+	}
+}
+
+func TestInboxEventsHandlerStampsCausation(t *testing.T) {
+	eventBuilder := events.Builder{}
+
+	for _, driver := range dbDrivers {
+		t.Run(driver, func(t *testing.T) {
+			inboxTable := "event_inbox_ib_3"
+			outboxTable := "event_outbox_ib_3"
+
+			db, err := createDBWithOutboxOptions(driver, &outbox.Options{
+				TableName:  outboxTable,
+				Serializer: serialization.NewJSONSerializer(),
+			})
+			assert.NoError(t, err)
+			assert.NoError(t, db.Connect())
+			assert.NoError(t, sharedtest.CreateInboxTable(db, inboxTable))
+			assert.NoError(t, sharedtest.CreateOutboxTable(db, outboxTable))
+
+			ib, err := inbox.New(db, &inbox.Options{
+				TableName: inboxTable,
+				Consumer:  "inbox-test",
+			})
+			assert.NoError(t, err)
+
+			handler := ib.EventsHandler("inbox.test", func(ctx context.Context, tx *sqlx.Tx, message bus.InboundMessage) ([]*events.EventSpec, error) {
+				event, err := eventBuilder.New("inbox.followup", &jsonPayload{Data: message.Id})
+				if err != nil {
+					return nil, err
+				}
+				return []*events.EventSpec{event}, nil
+			})
+
+			message := bus.InboundMessage{Id: "msg-1", Subject: "inbox.test", CorrelationId: "root"}
+			assert.NoError(t, handler(context.Background(), message))
+			// a redelivery must not emit the follow-up event again
+			assert.NoError(t, handler(context.Background(), message))
+
+			obEvents, err := sharedtest.GetEventEntities(db, outboxTable)
+			assert.NoError(t, err)
+			assert.Len(t, obEvents, 1)
+
+			assert.Equal(t, "msg-1", obEvents[0].CausationId.String)
+			assert.Equal(t, "root", obEvents[0].CorrelationId.String)
+
+			assert.NoError(t, db.Close())
+		})
+	}
+}
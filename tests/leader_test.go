@@ -0,0 +1,81 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	nats2 "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/stretchr/testify/assert"
+	"github.com/vectrum-io/strongforce/pkg/leader"
+	sharedtest "github.com/vectrum-io/strongforce/tests/shared"
+)
+
+// testLeaderHandover asserts that only one of two candidates leads at a time
+// and that the other takes over once the leader releases.
+func testLeaderHandover(t *testing.T, first, second leader.Elector) {
+	lease, err := first.Acquire(context.Background())
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	_, err = second.Acquire(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	acquired := make(chan leader.Lease)
+	go func() {
+		lease, err := second.Acquire(context.Background())
+		assert.NoError(t, err)
+		acquired <- lease
+	}()
+
+	assert.NoError(t, lease.Release(context.Background()))
+
+	select {
+	case secondLease := <-acquired:
+		assert.NoError(t, secondLease.Release(context.Background()))
+	case <-time.After(5 * time.Second):
+		t.Fatal("leadership was not handed over")
+	}
+}
+
+func TestKVLeaderElection(t *testing.T) {
+	conn, err := nats2.Connect(sharedtest.NATS)
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	js, err := jetstream.New(conn)
+	assert.NoError(t, err)
+
+	key := fmt.Sprintf("kv-leader-%d", time.Now().UnixNano())
+	first, err := leader.NewKVElector(js, &leader.KVOptions{Key: key, TTL: 3 * time.Second})
+	assert.NoError(t, err)
+	second, err := leader.NewKVElector(js, &leader.KVOptions{Key: key, TTL: 3 * time.Second})
+	assert.NoError(t, err)
+
+	testLeaderHandover(t, first, second)
+}
+
+func TestAdvisoryLockLeaderElectionMySQL(t *testing.T) {
+	testAdvisoryLockLeaderElection(t, "mysql")
+}
+
+func TestAdvisoryLockLeaderElectionPostgres(t *testing.T) {
+	testAdvisoryLockLeaderElection(t, "postgres")
+}
+
+func testAdvisoryLockLeaderElection(t *testing.T, driver string) {
+	d := newDirectEmitDB(t, driver, "leader_election_outbox")
+	assert.NoError(t, d.Connect())
+	defer d.Close()
+
+	name := fmt.Sprintf("advisory-leader-%d", time.Now().UnixNano())
+	first, err := leader.NewAdvisoryLockElector(d, &leader.AdvisoryLockOptions{Name: name, RetryInterval: 100 * time.Millisecond})
+	assert.NoError(t, err)
+	second, err := leader.NewAdvisoryLockElector(d, &leader.AdvisoryLockOptions{Name: name, RetryInterval: 100 * time.Millisecond})
+	assert.NoError(t, err)
+
+	testLeaderHandover(t, first, second)
+}
@@ -30,21 +30,22 @@ type jsonPayload struct {
 var dbDrivers = []string{"mysql", "postgres"}
 
 func createDB(driver string, tableName string, serializer serialization.Serializer) (db.DB, error) {
+	return createDBWithOutboxOptions(driver, &outbox.Options{
+		TableName:  tableName,
+		Serializer: serializer,
+	})
+}
+
+func createDBWithOutboxOptions(driver string, outboxOptions *outbox.Options) (db.DB, error) {
 	if driver == "mysql" {
 		return mysql.New(mysql.Options{
-			DSN: sharedtest.MySQLDSN,
-			OutboxOptions: &outbox.Options{
-				TableName:  tableName,
-				Serializer: serializer,
-			},
+			DSN:           sharedtest.MySQLDSN,
+			OutboxOptions: outboxOptions,
 		})
 	} else if driver == "postgres" {
 		return postgres.New(postgres.Options{
-			DSN: sharedtest.PostgresDSN,
-			OutboxOptions: &outbox.Options{
-				TableName:  tableName,
-				Serializer: serializer,
-			},
+			DSN:           sharedtest.PostgresDSN,
+			OutboxOptions: outboxOptions,
 		})
 	}
 
@@ -154,3 +155,33 @@ func TestMultiEventOutbox(t *testing.T) {
 		})
 	}
 }
+
+func TestOutboxCausationFromContext(t *testing.T) {
+	tableName := "causation_outbox"
+	eventBuilder := events.Builder{}
+
+	for _, driver := range dbDrivers {
+		t.Run(driver, func(t *testing.T) {
+			db, err := createDBWithOutboxOptions(driver, &outbox.Options{
+				TableName:  tableName,
+				Serializer: serialization.NewJSONSerializer(),
+			})
+			assert.NoError(t, err)
+			assert.NoError(t, db.Connect())
+			assert.NoError(t, sharedtest.CreateOutboxTable(db, tableName))
+
+			ctx := events.ContextWithCause(context.Background(), "inbound", "root")
+			_, err = db.EventTx(ctx, func(ctx context.Context, tx *sqlx.Tx) (*events.EventSpec, error) {
+				return eventBuilder.New("topic.1", &jsonPayload{Data: "test"})
+			})
+			assert.NoError(t, err)
+
+			obEvents, err := sharedtest.GetEventEntities(db, tableName)
+			assert.NoError(t, err)
+			assert.Len(t, obEvents, 1)
+
+			assert.Equal(t, "inbound", obEvents[0].CausationId.String)
+			assert.Equal(t, "root", obEvents[0].CorrelationId.String)
+		})
+	}
+}
@@ -14,6 +14,8 @@ const mysqlCreateTable = `
 		  topic varchar(255) NOT NULL,
 		  payload blob NOT NULL,
 		  created_at datetime NULL DEFAULT CURRENT_TIMESTAMP,
+		  causation_id varchar(255) NULL,
+		  correlation_id varchar(255) NULL,
 		  PRIMARY KEY (id)
 		)
 `
@@ -25,6 +27,8 @@ const postgresCreateTable = `
 		  topic VARCHAR(255) NOT NULL,
 		  payload BYTEA NOT NULL,
 		  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		  causation_id VARCHAR(255) NULL,
+		  correlation_id VARCHAR(255) NULL,
 		  PRIMARY KEY (id)
 		)
 `
@@ -52,6 +56,94 @@ func CreateOutboxTable(db db.DB, name string) error {
 	return err
 }
 
+//goland:noinspection SqlNoDataSourceInspection
+const mysqlCreateInboxTable = `
+		CREATE TABLE IF NOT EXISTS %s (
+		  consumer varchar(255) NOT NULL,
+		  handler varchar(255) NOT NULL,
+		  message_id varchar(255) NOT NULL,
+		  processed_at datetime NULL DEFAULT CURRENT_TIMESTAMP,
+		  PRIMARY KEY (consumer, handler, message_id)
+		)
+`
+
+//goland:noinspection SqlNoDataSourceInspection
+const postgresCreateInboxTable = `
+		CREATE TABLE IF NOT EXISTS %s (
+		  consumer VARCHAR(255) NOT NULL,
+		  handler VARCHAR(255) NOT NULL,
+		  message_id VARCHAR(255) NOT NULL,
+		  processed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		  PRIMARY KEY (consumer, handler, message_id)
+		)
+`
+
+//goland:noinspection SqlNoDataSourceInspection
+func CreateInboxTable(db db.DB, name string) error {
+	_, err := db.Connection().Exec(fmt.Sprintf(
+		"DROP TABLE IF EXISTS %s",
+		name,
+	))
+	if err != nil {
+		return err
+	}
+
+	var query string
+	if db.Connection().DriverName() == "mysql" {
+		query = fmt.Sprintf(mysqlCreateInboxTable, name)
+	} else if db.Connection().DriverName() == "postgres" {
+		query = fmt.Sprintf(postgresCreateInboxTable, name)
+	} else {
+		return fmt.Errorf("unsupported database driver: %s", db.Connection().DriverName())
+	}
+
+	_, err = db.Connection().Exec(query)
+	return err
+}
+
+//goland:noinspection SqlNoDataSourceInspection
+const mysqlCreateIdempotencyTable = `
+		CREATE TABLE IF NOT EXISTS %s (
+		  idempotency_key varchar(255) NOT NULL,
+		  event_ids text NOT NULL,
+		  created_at datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		  PRIMARY KEY (idempotency_key)
+		)
+`
+
+//goland:noinspection SqlNoDataSourceInspection
+const postgresCreateIdempotencyTable = `
+		CREATE TABLE IF NOT EXISTS %s (
+		  idempotency_key VARCHAR(255) NOT NULL,
+		  event_ids TEXT NOT NULL,
+		  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		  PRIMARY KEY (idempotency_key)
+		)
+`
+
+//goland:noinspection SqlNoDataSourceInspection
+func CreateIdempotencyTable(db db.DB, name string) error {
+	_, err := db.Connection().Exec(fmt.Sprintf(
+		"DROP TABLE IF EXISTS %s",
+		name,
+	))
+	if err != nil {
+		return err
+	}
+
+	var query string
+	if db.Connection().DriverName() == "mysql" {
+		query = fmt.Sprintf(mysqlCreateIdempotencyTable, name)
+	} else if db.Connection().DriverName() == "postgres" {
+		query = fmt.Sprintf(postgresCreateIdempotencyTable, name)
+	} else {
+		return fmt.Errorf("unsupported database driver: %s", db.Connection().DriverName())
+	}
+
+	_, err = db.Connection().Exec(query)
+	return err
+}
+
 func GetEventEntities(db db.DB, tableName string) ([]*outbox.EventEntity, error) {
 	var obEvents []*outbox.EventEntity
 	if err := db.Connection().Select(&obEvents, fmt.Sprintf("SELECT * FROM %s", tableName)); err != nil {